@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// tuneRequest is the body for PATCH /groups/{id}, the omitted fields are not changed
+type tuneRequest struct {
+	Step        *uint    `json:"step,omitempty"`
+	Value       *float64 `json:"value,omitempty"`
+	Deviation   *float64 `json:"deviation,omitempty"`
+	Probability *uint8   `json:"probability,omitempty"`
+}
+
+// api is the HTTP control API for the registry
+//
+//	GET    /groups              lists running groups
+//	POST   /groups              adds a new group from the Custom JSON, omitted fields are taken from the general config
+//	GET    /groups/{id}         returns the group
+//	PATCH  /groups/{id}         changes step, value, deviation and probability of the group
+//	DELETE /groups/{id}         stops and removes the group
+//	POST   /groups/{id}/pause   pauses the group
+//	POST   /groups/{id}/resume  resumes the group
+//	GET    /stats               returns the stats report
+type api struct {
+	registry *registry
+	defaults General
+}
+
+// newAPIHandler returns the http.Handler with the control API and prometheus /metrics endpoint
+func newAPIHandler(reg *registry, defaults General) http.Handler {
+	a := &api{registry: reg, defaults: defaults}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", newMetricsHandler(reg.stats))
+	mux.HandleFunc("/groups", a.groups)
+	mux.HandleFunc("/groups/", a.group)
+	mux.HandleFunc("/stats", a.stats)
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed for %s", r.Method, r.URL.Path))
+}
+
+func (a *api) groups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, a.registry.list())
+	case http.MethodPost:
+		custom := Custom{General: a.defaults}
+		if err := json.NewDecoder(r.Body).Decode(&custom); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unable to decode the group: %w", err))
+			return
+		}
+		rg, err := a.registry.add(custom)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, rg.info())
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+func (a *api) group(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/groups/"), "/"), "/")
+	id, err := strconv.Atoi(path[0])
+	if err != nil || 2 < len(path) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("path %s is not found", r.URL.Path))
+		return
+	}
+	rg, err := a.registry.get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if len(path) == 2 {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, r)
+			return
+		}
+		switch path[1] {
+		case "pause":
+			rg.setPaused(true)
+		case "resume":
+			rg.setPaused(false)
+		default:
+			writeError(w, http.StatusNotFound, fmt.Errorf("path %s is not found", r.URL.Path))
+			return
+		}
+		writeJSON(w, http.StatusOK, rg.info())
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, rg.info())
+	case http.MethodPatch:
+		req := tuneRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("unable to decode the request: %w", err))
+			return
+		}
+		current := rg.info()
+		step, value, deviation, probability := current.Step, current.Value, current.Deviation, current.Probability
+		if req.Step != nil {
+			step = *req.Step
+		}
+		if req.Value != nil {
+			value = *req.Value
+		}
+		if req.Deviation != nil {
+			deviation = *req.Deviation
+		}
+		if req.Probability != nil {
+			probability = *req.Probability
+		}
+		if err := rg.tune(step, value, deviation, probability); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rg.info())
+	case http.MethodDelete:
+		if err := a.registry.remove(id); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, errGroupNotFound) {
+				status = http.StatusNotFound
+			}
+			writeError(w, status, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+func (a *api) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, a.registry.stats.report())
+}
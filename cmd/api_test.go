@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func request(t *testing.T, method, url, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, v), string(data))
+	}
+	return resp.StatusCode
+}
+
+func TestAPI(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	carbon := &syncBuffer{}
+	reg := newRegistry(ctx, cancel, carbon, newStats(carbon))
+	server := httptest.NewServer(newAPIHandler(reg, General{Step: 60, Value: 10, Probability: 100}))
+	defer server.Close()
+
+	groups := []groupInfo{}
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/groups", "", &groups))
+	assert.Empty(t, groups)
+
+	group := groupInfo{}
+	status := request(t, http.MethodPost, server.URL+"/groups", `{"name": "metric.{1..3}", "type": "counter", "step": 10}`, &group)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, 1, group.ID)
+	assert.Equal(t, 3, group.Generators)
+	assert.Equal(t, uint(10), group.Step)
+	assert.Equal(t, float64(10), group.Value)
+	assert.Equal(t, uint8(100), group.Probability)
+
+	errBody := map[string]string{}
+	status = request(t, http.MethodPost, server.URL+"/groups", `{"name": "metric", "type": "invalid"}`, &errBody)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, errBody["error"], "type is not valid")
+	status = request(t, http.MethodPost, server.URL+"/groups", `{"name": "metric", "type": "const", "step": 0}`, &errBody)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status = request(t, http.MethodPost, server.URL+"/groups", `not a json`, &errBody)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/groups", "", &groups))
+	assert.Len(t, groups, 1)
+	assert.Equal(t, "metric.{1..3}", groups[0].Name)
+
+	status = request(t, http.MethodPatch, server.URL+"/groups/1", `{"step": 5, "probability": 50}`, &group)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, uint(5), group.Step)
+	assert.Equal(t, uint8(50), group.Probability)
+	assert.Equal(t, float64(10), group.Value)
+	status = request(t, http.MethodPatch, server.URL+"/groups/1", `{"probability": 0}`, &errBody)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	assert.Equal(t, http.StatusOK, request(t, http.MethodPost, server.URL+"/groups/1/pause", "", &group))
+	assert.True(t, group.Paused)
+	assert.Equal(t, http.StatusOK, request(t, http.MethodPost, server.URL+"/groups/1/resume", "", &group))
+	assert.False(t, group.Paused)
+	assert.Equal(t, http.StatusMethodNotAllowed, request(t, http.MethodGet, server.URL+"/groups/1/pause", "", nil))
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodPost, server.URL+"/groups/1/unknown", "", nil))
+
+	r := report{}
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/stats", "", &r))
+	assert.Equal(t, 3, r.Series)
+
+	assert.Equal(t, http.StatusNoContent, request(t, http.MethodDelete, server.URL+"/groups/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodGet, server.URL+"/groups/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodDelete, server.URL+"/groups/1", "", nil))
+	assert.Equal(t, http.StatusNotFound, request(t, http.MethodGet, server.URL+"/groups/abc", "", nil))
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/groups", "", &groups))
+	assert.Empty(t, groups)
+	assert.Equal(t, http.StatusOK, request(t, http.MethodGet, server.URL+"/stats", "", &r))
+	assert.Zero(t, r.Series)
+	assert.Empty(t, r.Groups, "the stats of the removed group are removed")
+
+	// the group with the same name is added again and reported once
+	status = request(t, http.MethodPost, server.URL+"/groups", `{"name": "metric.{1..3}", "type": "counter", "step": 10}`, &group)
+	assert.Equal(t, http.StatusCreated, status)
+	metrics := httptest.NewServer(newMetricsHandler(reg.stats))
+	defer metrics.Close()
+	resp, err := http.Get(metrics.URL + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, strings.Count(string(body), "coal_mine_generators{"))
+
+	cancel(nil)
+	reg.wait()
+}
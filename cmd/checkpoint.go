@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+)
+
+var (
+	checkpointPath     string
+	checkpointInterval time.Duration
+	resumePath         string
+)
+
+// errLazyCheckpoint is returned when checkpoints are requested for lazy generators
+var errLazyCheckpoint = errors.New("--checkpoint and --resume are not supported with --lazy")
+
+// errWrappedCheckpoint is returned when checkpoints are requested for generators, which keep points out of the state
+var errWrappedCheckpoint = errors.New("--checkpoint and --resume are not supported with gaps, disorder or retentions")
+
+// checkCheckpoint returns errWrappedCheckpoint when the generators of the custom can't be restored from the saved state
+func (c *Custom) checkCheckpoint() error {
+	s, err := c.Spec()
+	if err != nil {
+		return err
+	}
+	if !s.Restorable() {
+		return fmt.Errorf("%w: %s", errWrappedCheckpoint, c.Name)
+	}
+	return nil
+}
+
+// checkpoint is the state of all groups of generators saved to the file
+type checkpoint struct {
+	Saved  int64        `json:"saved"`
+	Groups []groupState `json:"groups"`
+}
+
+// groupState is the state of generators in the group. The groups are matched by name, type and randomize like on
+// the config reload.
+type groupState struct {
+	Name       string            `json:"name"`
+	Type       string            `json:"type"`
+	Randomize  bool              `json:"randomize"`
+	Generators []generator.State `json:"generators"`
+}
+
+func newGroupState(gg *generator.Generators) groupState {
+	return groupState{
+		Name:       gg.Name(),
+		Type:       gg.TypeName(),
+		Randomize:  gg.Randomized(),
+		Generators: gg.States(),
+	}
+}
+
+func (gs *groupState) key() groupKey {
+	return groupKey{name: gs.Name, typeName: gs.Type, randomize: gs.Randomize}
+}
+
+// loadCheckpoint reads the checkpoint from the JSON file
+func loadCheckpoint(path string) (*checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read checkpoint: %w", err)
+	}
+	cp := &checkpoint{}
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, fmt.Errorf("unable to parse checkpoint %s: %w", path, err)
+	}
+	logger.Info("checkpoint is loaded", "file", path, "saved", time.Unix(cp.Saved, 0), "groups", len(cp.Groups))
+	return cp, nil
+}
+
+// save writes the checkpoint to the temporary file and renames it to the path, so the previous checkpoint is kept
+// if the process dies during the write
+func (cp *checkpoint) save(path string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to save checkpoint: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("unable to save checkpoint: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to save checkpoint: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("unable to save checkpoint: %w", err)
+	}
+	logger.Debug("checkpoint is saved", "file", path, "groups", len(cp.Groups))
+	return nil
+}
+
+// resumeStates are states of the checkpoint by group keys. The groups with the same key are taken in order.
+type resumeStates map[groupKey][]map[string]generator.State
+
+func (cp *checkpoint) states() resumeStates {
+	rs := make(resumeStates, len(cp.Groups))
+	for i := range cp.Groups {
+		gs := &cp.Groups[i]
+		states := make(map[string]generator.State, len(gs.Generators))
+		for _, s := range gs.Generators {
+			states[s.Name] = s
+		}
+		rs[gs.key()] = append(rs[gs.key()], states)
+	}
+	return rs
+}
+
+// take returns states for the group and removes them, so each group of the checkpoint is resumed once
+func (rs resumeStates) take(key groupKey) (map[string]generator.State, bool) {
+	if len(rs[key]) == 0 {
+		return nil, false
+	}
+	states := rs[key][0]
+	rs[key] = rs[key][1:]
+	return states, true
+}
+
+// checkpoint returns the state of all running groups sorted by ID
+func (r *registry) checkpoint() *checkpoint {
+	r.mu.Lock()
+	groups := make([]*runningGroup, 0, len(r.groups))
+	for _, rg := range r.groups {
+		groups = append(groups, rg)
+	}
+	r.mu.Unlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].id < groups[j].id })
+	cp := &checkpoint{Saved: time.Now().Unix(), Groups: make([]groupState, 0, len(groups))}
+	for _, rg := range groups {
+		rg.mu.Lock()
+		cp.Groups = append(cp.Groups, newGroupState(&rg.gg))
+		rg.mu.Unlock()
+	}
+	return cp
+}
+
+// runCheckpoints saves the registry state to the path each interval. The returned function stops it and saves the
+// final state, it should be called after the registry is finished.
+func runCheckpoints(ctx context.Context, reg *registry, path string, interval time.Duration) func() {
+	if path == "" {
+		return func() {}
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := reg.checkpoint().save(path); err != nil {
+					logger.Warn("unable to save checkpoint", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		if err := reg.checkpoint().save(path); err != nil {
+			logger.Error("unable to save the final checkpoint", "error", err)
+			return
+		}
+		logger.Info("checkpoint is saved", "file", path)
+	}
+}
+
+// resumeOnline restores states of generators for the online generation. The values, probabilities and random
+// sources continue from the checkpoint, and the time is moved to the last step before ts, so the points missed
+// between runs are skipped, but the phase of the randomized start is kept.
+func resumeOnline(gg *generator.Generators, states map[string]generator.State, ts uint) (int, error) {
+	step := gg.Step()
+	for name, s := range states {
+		if s.Time < ts && step != 0 {
+			s.Time += (ts - s.Time) / step * step
+			states[name] = s
+		}
+	}
+	return gg.Restore(states)
+}
+
+// resumeBackfill restores states of generators including time, and returns generators continuing from the next
+// point. The ones without the next point before the stop are skipped, but keep their state in gg for the checkpoint.
+func resumeBackfill(gg *generator.Generators, states map[string]generator.State) (generator.Generators, error) {
+	restored, err := gg.Restore(states)
+	if err != nil {
+		return generator.Generators{}, err
+	}
+	gens := make([]generator.Generator, 0, len(gg.List()))
+	for _, g := range gg.List() {
+		if s, ok := g.(generator.Stater); ok {
+			if _, ok := states[s.State().Name]; ok && g.Next() != nil {
+				continue
+			}
+		}
+		gens = append(gens, g)
+	}
+	valid := *gg
+	valid.SetList(gens)
+	logger.Info("generators are resumed", "group", gg.Name(), "type", gg.TypeName(), "restored", restored,
+		"generators", len(gens))
+	return valid, nil
+}
+
+// resumedGroups returns generators for each group of the config resumed from states, and all generators to save
+// the checkpoint after the generation. The groups with nothing to extend are not returned as backfillGroup.
+func (c *Config) resumedGroups(resume resumeStates) ([]backfillGroup, []generator.Generators, error) {
+	for _, custom := range c.Customs() {
+		if err := custom.checkCheckpoint(); err != nil {
+			return nil, nil, err
+		}
+	}
+	ggg, err := c.ToGenerators()
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := make([]backfillGroup, 0, len(ggg))
+	for i := range ggg {
+		gg := &ggg[i]
+		states, ok := resume.take(groupKey{name: gg.Name(), typeName: gg.TypeName(), randomize: gg.Randomized()})
+		if !ok {
+			groups = append(groups, gg)
+			continue
+		}
+		valid, err := resumeBackfill(gg, states)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to resume %s generators for %s: %w", gg.TypeName(), gg.Name(), err)
+		}
+		if len(valid.List()) == 0 {
+			logger.Info("nothing to extend, generators are after the stop", "group", gg.Name(), "type", gg.TypeName())
+			continue
+		}
+		groups = append(groups, &valid)
+	}
+	return groups, ggg, nil
+}
+
+// backfillCheckpoint returns the checkpoint for generators after the generation
+func backfillCheckpoint(ggg []generator.Generators) *checkpoint {
+	cp := &checkpoint{Saved: time.Now().Unix(), Groups: make([]groupState, 0, len(ggg))}
+	for i := range ggg {
+		cp.Groups = append(cp.Groups, newGroupState(&ggg[i]))
+	}
+	return cp
+}
+
+// resumeFrom loads states of the checkpoint from the path for groups added later. The empty path is ignored.
+func (r *registry) resumeFrom(path string) error {
+	if path == "" {
+		return nil
+	}
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.resume = cp.states()
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// groupLines returns sorted lines of points
+func groupLines(t *testing.T, groups []backfillGroup) []string {
+	buf := new(bytes.Buffer)
+	for _, gg := range groups {
+		_, err := gg.WriteAllToWithContext(context.Background(), buf)
+		require.NoError(t, err)
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestCheckpoint(t *testing.T) {
+	defer generator.ResetSeed()
+	generator.SetSeed(1)
+	general := General{Step: 60, Value: 1, Deviation: 5, Probability: 100, start: 1700000000, stop: 1700000600}
+	c := Config{General: general, Counter: []string{"a.{1..3}"}, Random: []string{"b"}}
+	c.stop = 1700001200
+	full, _, err := c.resumedGroups(nil)
+	require.NoError(t, err)
+	expected := groupLines(t, full)
+
+	c.stop = 1700000600
+	groups, ggg, err := c.resumedGroups(nil)
+	require.NoError(t, err)
+	first := groupLines(t, groups)
+	path := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, backfillCheckpoint(ggg).save(path))
+	cp, err := loadCheckpoint(path)
+	require.NoError(t, err)
+	require.Len(t, cp.Groups, 2)
+	assert.Equal(t, groupState{Name: "b", Type: "random", Generators: ggg[1].States()}, cp.Groups[1])
+
+	// the backfill is extended forward
+	c.stop = 1700001200
+	groups, ggg, err = c.resumedGroups(cp.states())
+	require.NoError(t, err)
+	lines := append(first, groupLines(t, groups)...)
+	sort.Strings(expected)
+	sort.Strings(lines)
+	assert.Equal(t, expected, lines)
+
+	// nothing to extend, but the state is kept for the checkpoint
+	require.NoError(t, backfillCheckpoint(ggg).save(path))
+	cp, err = loadCheckpoint(path)
+	require.NoError(t, err)
+	groups, ggg, err = c.resumedGroups(cp.states())
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+	kept := backfillCheckpoint(ggg)
+	kept.Saved = cp.Saved
+	assert.Equal(t, cp, kept)
+
+	_, err = loadCheckpoint(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+
+	// the pending points of gaps, disorder and retentions aren't in the state
+	disordered := general
+	disordered.Disorder = Disorder{Shuffle: 120}
+	for _, custom := range []Custom{
+		{Name: "gaps", Type: "const", General: general, Gaps: Gaps{Delay: 60}},
+		{Name: "disorder", Type: "const", General: disordered},
+		{Name: "rollup", Type: "const", General: general, Rollup: Rollup{Retentions: "60s:1h,5m:1d"}},
+	} {
+		c := Config{General: general, Custom: []Custom{custom}}
+		_, _, err = c.resumedGroups(nil)
+		assert.ErrorIs(t, err, errWrappedCheckpoint, custom.Name)
+	}
+}
+
+func TestResumeStates(t *testing.T) {
+	cp := &checkpoint{Groups: []groupState{
+		{Name: "a", Type: "const", Generators: []generator.State{{Name: "a", Time: 60}}},
+		{Name: "a", Type: "const", Generators: []generator.State{{Name: "a", Time: 120}}},
+		{Name: "a", Type: "const", Randomize: true},
+	}}
+	rs := cp.states()
+	key := groupKey{name: "a", typeName: "const"}
+	states, ok := rs.take(key)
+	require.True(t, ok)
+	assert.Equal(t, uint(60), states["a"].Time)
+	states, ok = rs.take(key)
+	require.True(t, ok)
+	assert.Equal(t, uint(120), states["a"].Time)
+	_, ok = rs.take(key)
+	assert.False(t, ok)
+	_, ok = resumeStates(nil).take(key)
+	assert.False(t, ok)
+}
+
+func TestResumeOnline(t *testing.T) {
+	gg, err := generator.NewExpand("counter", "a.{1..2}", 1000, 1000, 10, false, 1, 0, 100)
+	require.NoError(t, err)
+	restored, err := resumeOnline(&gg, map[string]generator.State{
+		"a.1": {Name: "a.1", Time: 503, Value: 42},
+		"a.2": {Name: "a.2", Time: 1005, Value: 43},
+	}, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, 2, restored)
+	states := gg.States()
+	// the phase of the old time is kept, and the missed points are skipped
+	assert.Equal(t, uint(993), states[0].Time)
+	assert.Equal(t, 42.0, states[0].Value)
+	assert.Equal(t, uint(1005), states[1].Time)
+}
@@ -0,0 +1,321 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+)
+
+// Level offsets and the date of tree rows in graphite_index table, the same as carbon-clickhouse and
+// graphite-clickhouse use
+const (
+	reverseLevelOffset     = 10000
+	treeLevelOffset        = 20000
+	reverseTreeLevelOffset = 30000
+	// defaultTreeDate is 1970-02-12
+	defaultTreeDate = 42
+)
+
+// clickhouseWriter writes points of generators as rows of carbon-clickhouse tables in TSV or RowBinary
+// format: points for graphite table, and optionally graphite_index rows for plain series and graphite_tagged rows for
+// tagged ones. The files are ready to be inserted with clickhouse-client.
+type clickhouseWriter struct {
+	format string
+	now    func() time.Time
+
+	mu      sync.Mutex
+	points  *clickhouseFile
+	index   *clickhouseFile
+	tagged  *clickhouseFile
+	indexed map[string]bool
+	row     []byte
+}
+
+// clickhouseFile is the buffered output file, STDOUT isn't closed
+type clickhouseFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func createClickhouseFile(path string) (*clickhouseFile, error) {
+	if path == "-" {
+		return &clickhouseFile{Writer: bufio.NewWriter(os.Stdout), file: os.Stdout}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &clickhouseFile{Writer: bufio.NewWriterSize(f, 1<<20), file: f}, nil
+}
+
+func (f *clickhouseFile) Close() error {
+	if f == nil {
+		return nil
+	}
+	err := f.Flush()
+	if f.file == os.Stdout {
+		return err
+	}
+	return errors.Join(err, f.file.Close())
+}
+
+// newClickhouseWriter returns the writer for URL 'clickhouse://path/to/points?format=rowbinary&index=path&tagged=path'.
+// The path '-' is STDOUT, the format is 'tsv' by default.
+func newClickhouseWriter(u *url.URL) (*clickhouseWriter, error) {
+	path := u.Host + u.Path
+	if path == "" {
+		return nil, fmt.Errorf("the points file is empty in %s, use '-' for STDOUT", u.Redacted())
+	}
+	q := u.Query()
+	w := &clickhouseWriter{format: q.Get("format"), now: time.Now, indexed: make(map[string]bool)}
+	if w.format == "" {
+		w.format = "tsv"
+	}
+	if w.format != "tsv" && w.format != "rowbinary" {
+		return nil, fmt.Errorf("format %s is not in [tsv rowbinary]", w.format)
+	}
+	var err error
+	files := []struct {
+		path string
+		file **clickhouseFile
+	}{{path, &w.points}, {q.Get("index"), &w.index}, {q.Get("tagged"), &w.tagged}}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if *f.file, err = createClickhouseFile(f.path); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Write returns errPointsOnly, the generators write points to the clickhouseWriter with WritePoints
+func (w *clickhouseWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("%w: clickhouse", errPointsOnly)
+}
+
+// WritePoints converts the points to rows and returns the size of written points rows. The sub-second timestamps are
+// truncated to seconds.
+func (w *clickhouseWriter) WritePoints(points []generator.Point) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := 0
+	for _, p := range points {
+		add, err := w.add(p)
+		n += add
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (w *clickhouseWriter) add(p generator.Point) (int, error) {
+	if uint(^uint32(0)) < p.Timestamp {
+		return 0, fmt.Errorf("timestamp of %s is out of UInt32 range", p)
+	}
+	version := uint32(w.now().Unix())
+	ts := uint32(p.Timestamp)
+	day := uint16(ts / 86400)
+	path, tags := clickhouseTagged(p)
+
+	w.row = w.row[:0]
+	w.appendString(path)
+	w.appendFloat(p.Value)
+	w.appendUint32(ts)
+	w.appendDate(day)
+	w.appendUint32(version)
+	w.endRow()
+	n, err := w.points.Write(w.row)
+	if err != nil {
+		return n, err
+	}
+
+	switch {
+	case tags == nil && w.index != nil:
+		return n, w.addIndex(path, day, version)
+	case tags != nil && w.tagged != nil:
+		return n, w.addTagged(path, tags, day, version)
+	}
+	return n, nil
+}
+
+// clickhouseTagged returns the path in carbon-clickhouse format 'name?tag1=value1&tag2=value2' with sorted tags, and
+// tags for graphite_tagged table including '__name__'. The plain series have the name as the path and no tags.
+func clickhouseTagged(p generator.Point) (string, []string) {
+	if len(p.Tags) == 0 {
+		return p.Name, nil
+	}
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys)+1)
+	tags = append(tags, "__name__="+p.Name)
+	query := make([]string, 0, len(keys))
+	for _, k := range keys {
+		tags = append(tags, k+"="+p.Tags[k])
+		query = append(query, url.QueryEscape(k)+"="+url.QueryEscape(p.Tags[k]))
+	}
+	return url.PathEscape(p.Name) + "?" + strings.Join(query, "&"), tags
+}
+
+// addIndex writes graphite_index rows once per series: tree rows for the path and its parent nodes, and daily rows
+// for each new day
+func (w *clickhouseWriter) addIndex(path string, day uint16, version uint32) error {
+	parts := strings.Split(path, ".")
+	level := uint32(len(parts))
+	reversed := make([]string, len(parts))
+	for i, part := range parts {
+		reversed[len(parts)-1-i] = part
+	}
+	reversedPath := strings.Join(reversed, ".")
+
+	w.row = w.row[:0]
+	if !w.indexed[path] {
+		w.indexed[path] = true
+		w.appendIndexRow(defaultTreeDate, treeLevelOffset+level, path, version)
+		w.appendIndexRow(defaultTreeDate, reverseTreeLevelOffset+level, reversedPath, version)
+		for i := 1; i < len(parts); i++ {
+			node := strings.Join(parts[:i], ".") + "."
+			if w.indexed[node] {
+				continue
+			}
+			w.indexed[node] = true
+			w.appendIndexRow(defaultTreeDate, treeLevelOffset+uint32(i), node, version)
+		}
+	}
+	dayKey := strconv.Itoa(int(day)) + ":" + path
+	if !w.indexed[dayKey] {
+		w.indexed[dayKey] = true
+		w.appendIndexRow(day, level, path, version)
+		w.appendIndexRow(day, reverseLevelOffset+level, reversedPath, version)
+	}
+	_, err := w.index.Write(w.row)
+	return err
+}
+
+// addTagged writes graphite_tagged rows once per series and day, a row for each tag
+func (w *clickhouseWriter) addTagged(path string, tags []string, day uint16, version uint32) error {
+	dayKey := strconv.Itoa(int(day)) + ":" + path
+	if w.indexed[dayKey] {
+		return nil
+	}
+	w.indexed[dayKey] = true
+	w.row = w.row[:0]
+	for _, tag := range tags {
+		w.appendDate(day)
+		w.appendString(tag)
+		w.appendString(path)
+		w.appendArray(tags)
+		w.appendUint32(version)
+		w.endRow()
+	}
+	_, err := w.tagged.Write(w.row)
+	return err
+}
+
+func (w *clickhouseWriter) appendIndexRow(day uint16, level uint32, path string, version uint32) {
+	w.appendDate(day)
+	w.appendUint32(level)
+	w.appendString(path)
+	w.appendUint32(version)
+	w.endRow()
+}
+
+// The append functions add the column value in RowBinary format, or the TSV field terminated by a tab
+
+func (w *clickhouseWriter) appendString(s string) {
+	if w.format == "rowbinary" {
+		w.row = binary.AppendUvarint(w.row, uint64(len(s)))
+		w.row = append(w.row, s...)
+		return
+	}
+	w.row = appendTSVString(w.row, s)
+	w.row = append(w.row, '\t')
+}
+
+func (w *clickhouseWriter) appendFloat(v float64) {
+	if w.format == "rowbinary" {
+		w.row = binary.LittleEndian.AppendUint64(w.row, math.Float64bits(v))
+		return
+	}
+	w.row = strconv.AppendFloat(w.row, v, 'f', -1, 64)
+	w.row = append(w.row, '\t')
+}
+
+func (w *clickhouseWriter) appendUint32(v uint32) {
+	if w.format == "rowbinary" {
+		w.row = binary.LittleEndian.AppendUint32(w.row, v)
+		return
+	}
+	w.row = strconv.AppendUint(w.row, uint64(v), 10)
+	w.row = append(w.row, '\t')
+}
+
+// endRow replaces the tab after the last TSV column by the newline
+func (w *clickhouseWriter) endRow() {
+	if w.format == "tsv" {
+		w.row[len(w.row)-1] = '\n'
+	}
+}
+
+func (w *clickhouseWriter) appendDate(day uint16) {
+	if w.format == "rowbinary" {
+		w.row = binary.LittleEndian.AppendUint16(w.row, day)
+		return
+	}
+	w.row = time.Unix(int64(day)*86400, 0).UTC().AppendFormat(w.row, time.DateOnly)
+	w.row = append(w.row, '\t')
+}
+
+func (w *clickhouseWriter) appendArray(values []string) {
+	if w.format == "rowbinary" {
+		w.row = binary.AppendUvarint(w.row, uint64(len(values)))
+		for _, v := range values {
+			w.row = binary.AppendUvarint(w.row, uint64(len(v)))
+			w.row = append(w.row, v...)
+		}
+		return
+	}
+	w.row = append(w.row, '[')
+	for i, v := range values {
+		if i != 0 {
+			w.row = append(w.row, ',')
+		}
+		w.row = append(w.row, '\'')
+		w.row = append(w.row, quotedEscaper.Replace(v)...)
+		w.row = append(w.row, '\'')
+	}
+	w.row = append(w.row, ']', '\t')
+}
+
+var (
+	tsvEscaper    = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n")
+	quotedEscaper = strings.NewReplacer("\\", "\\\\", "'", "\\'", "\t", "\\t", "\n", "\\n")
+)
+
+func appendTSVString(b []byte, s string) []byte {
+	return append(b, tsvEscaper.Replace(s)...)
+}
+
+// Close flushes and closes files
+func (w *clickhouseWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return errors.Join(w.points.Close(), w.index.Close(), w.tagged.Close())
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"encoding/binary"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClickhouseWriter(t *testing.T, query string) (*clickhouseWriter, string) {
+	t.Helper()
+	dir := t.TempDir()
+	u, err := url.Parse("clickhouse://" + filepath.Join(dir, "points") + "?index=" + filepath.Join(dir, "index") +
+		"&tagged=" + filepath.Join(dir, "tagged") + query)
+	require.NoError(t, err)
+	w, err := newClickhouseWriter(u)
+	require.NoError(t, err)
+	w.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return w, dir
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestClickhouseWriterTSV(t *testing.T) {
+	w, dir := newTestClickhouseWriter(t, "")
+	_, err := w.Write([]byte("a.b.c 1.5 1699999940\n"))
+	assert.ErrorIs(t, err, errPointsOnly)
+	n, err := w.WritePoints([]generator.Point{
+		generator.NewPoint("a.b.c", 1.5, 1699999940),
+		generator.NewPoint("a.b.c", 2, 1700000000),
+		generator.NewPoint("a.b.d", 3, 1699999940),
+	})
+	require.NoError(t, err)
+	rows := "a.b.c\t1.5\t1699999940\t2023-11-14\t1700000000\n" +
+		"a.b.c\t2\t1700000000\t2023-11-14\t1700000000\n" +
+		"a.b.d\t3\t1699999940\t2023-11-14\t1700000000\n"
+	assert.Equal(t, len(rows), n, "only points rows are counted")
+	_, err = w.WritePoints([]generator.Point{
+		generator.NewPoint("m;z=1;y=a\\b", 4, 1699999940),
+		generator.NewPoint("m;y=a\\b;z=1", 5, 1700000000),
+	})
+	require.NoError(t, err)
+	_, err = w.WritePoints([]generator.Point{generator.NewPoint("a.b.c", 6, 1<<32)})
+	assert.Error(t, err, "the timestamp is out of UInt32 range")
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, `a.b.c	1.5	1699999940	2023-11-14	1700000000
+a.b.c	2	1700000000	2023-11-14	1700000000
+a.b.d	3	1699999940	2023-11-14	1700000000
+m?y=a%5Cb&z=1	4	1699999940	2023-11-14	1700000000
+m?y=a%5Cb&z=1	5	1700000000	2023-11-14	1700000000
+`, readFile(t, filepath.Join(dir, "points")))
+
+	assert.Equal(t, `1970-02-12	20003	a.b.c	1700000000
+1970-02-12	30003	c.b.a	1700000000
+1970-02-12	20001	a.	1700000000
+1970-02-12	20002	a.b.	1700000000
+2023-11-14	3	a.b.c	1700000000
+2023-11-14	10003	c.b.a	1700000000
+1970-02-12	20003	a.b.d	1700000000
+1970-02-12	30003	d.b.a	1700000000
+2023-11-14	3	a.b.d	1700000000
+2023-11-14	10003	d.b.a	1700000000
+`, readFile(t, filepath.Join(dir, "index")))
+
+	assert.Equal(t, `2023-11-14	__name__=m	m?y=a%5Cb&z=1	['__name__=m','y=a\\b','z=1']	1700000000
+2023-11-14	y=a\\b	m?y=a%5Cb&z=1	['__name__=m','y=a\\b','z=1']	1700000000
+2023-11-14	z=1	m?y=a%5Cb&z=1	['__name__=m','y=a\\b','z=1']	1700000000
+`, readFile(t, filepath.Join(dir, "tagged")))
+}
+
+func TestClickhouseWriterRowBinary(t *testing.T) {
+	w, dir := newTestClickhouseWriter(t, "&format=rowbinary")
+	_, err := w.WritePoints([]generator.Point{generator.NewPoint("a.b", 1.5, 1699999940), generator.NewPoint("m;t=v", 2, 1699999940)})
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	expected := []byte{3, 'a', '.', 'b'}
+	expected = binary.LittleEndian.AppendUint64(expected, math.Float64bits(1.5))
+	expected = binary.LittleEndian.AppendUint32(expected, 1699999940)
+	expected = binary.LittleEndian.AppendUint16(expected, 19675)
+	expected = binary.LittleEndian.AppendUint32(expected, 1700000000)
+	expected = append(expected, 5, 'm', '?', 't', '=', 'v')
+	expected = binary.LittleEndian.AppendUint64(expected, math.Float64bits(2))
+	expected = binary.LittleEndian.AppendUint32(expected, 1699999940)
+	expected = binary.LittleEndian.AppendUint16(expected, 19675)
+	expected = binary.LittleEndian.AppendUint32(expected, 1700000000)
+	assert.Equal(t, string(expected), readFile(t, filepath.Join(dir, "points")))
+
+	index := readFile(t, filepath.Join(dir, "index"))
+	// tree rows for a.b, b.a and a., daily rows for a.b and b.a
+	assert.Len(t, index, 5*(2+4+1+4)+len("a.bb.aa.a.bb.a"))
+	assert.Equal(t, []byte{42, 0, 0x22, 0x4e, 0, 0, 3, 'a', '.', 'b'}, []byte(index[:10]))
+
+	tagged := readFile(t, filepath.Join(dir, "tagged"))
+	row := binary.LittleEndian.AppendUint16(nil, 19675)
+	row = append(row, 10)
+	row = append(row, "__name__=m"...)
+	row = append(row, 5, 'm', '?', 't', '=', 'v', 2, 10)
+	row = append(row, "__name__=m"...)
+	row = append(row, 3, 't', '=', 'v')
+	row = binary.LittleEndian.AppendUint32(row, 1700000000)
+	assert.Equal(t, string(row), tagged[:len(row)])
+	assert.Len(t, tagged, 2*len(row)-7)
+}
+
+func TestNewClickhouseWriter(t *testing.T) {
+	for _, bad := range []string{"clickhouse://", "clickhouse://-?format=json", "clickhouse://" + t.TempDir() + "/missing/points"} {
+		u, err := url.Parse(bad)
+		require.NoError(t, err)
+		_, err = newClickhouseWriter(u)
+		assert.Error(t, err, bad)
+	}
+	c := Config{Carbon: "clickhouse://-?format=rowbinary"}
+	w, err := c.GetCarbonWriter()
+	require.NoError(t, err)
+	assert.Equal(t, "rowbinary", w.(*clickhouseWriter).format)
+	require.NoError(t, closeWriter(w))
+}
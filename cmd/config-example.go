@@ -46,7 +46,7 @@ func printConfig(cmd *cobra.Command, args []string) error {
 		Type: "random",
 		General: General{
 			From:        "-2d",
-			Until:       "1d",
+			Until:       "-1d",
 			Step:        300,
 			Randomize:   false,
 			Value:       1000,
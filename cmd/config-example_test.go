@@ -9,11 +9,9 @@ import (
 
 func TestConfigExample(t *testing.T) {
 	buf := &strings.Builder{}
-	rootCmd.SetOut(buf)
-	rootCmd.SetArgs([]string{"config-example"})
-	err := rootCmd.Execute()
+	err := executeRoot(t, buf, &strings.Builder{}, "config-example")
 	assert.NoError(t, err)
-	body := `# carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port' or 'udp://server:port'
+	body := `# carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port', 'udp://server:port', 'file:///path/out-%Y%m%d.txt', 'whisper://path/to/storage' or 'clickhouse://path/to/points.tsv'
 carbon = ''
 # names for constant generators, braces are expanded like in shell
 #  values are generated with deviation around starting value
@@ -46,7 +44,7 @@ deviation = 15.15
  # from in graphite-web format, the local TZ is used
  from = '-2d'
  # until in graphite-web format, the local TZ is used
- until = '1d'
+ until = '-1d'
  # step in seconds
  step = 300
  # randomize starting time with [0,step)
@@ -4,117 +4,380 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/internal/storage"
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/spf13/viper"
 )
 
 // General is the general part of configs
 type General struct {
-	From        string `toml:"from,omitempty" json:"from,omitempty" comment:"from in graphite-web format, the local TZ is used"`
-	start       uint
-	Until       string `toml:"until,omitempty" json:"until,omitempty" comment:"until in graphite-web format, the local TZ is used"`
-	stop        uint
-	Step        uint    `toml:"step,omitempty" json:"step,omitempty" comment:"step in seconds"`
-	Randomize   bool    `toml:"randomize" json:"randomize" comment:"randomize starting time with [0,step)"`
-	Value       float64 `toml:"value,omitempty" json:"value,omitempty" comment:"first value for all generators"`
-	Deviation   float64 `toml:"deviation,omitempty" json:"deviation,omitempty" comment:"deviation of the values, const will be generated around, counter will add [0,value+deviation), random will calculate next value around previous"`
-	Probability uint8   `toml:"probability,omitempty" json:"probability,omitempty" comment:"probability of points to being sent. A valid value is [1,100]. It has randomized starting value, but is calculated as 'current + probability > 100', so has consistent behavior"`
+	From               string `toml:"from,omitempty" json:"from,omitempty" comment:"from in graphite-web format, the local TZ is used"`
+	start              uint
+	Until              string `toml:"until,omitempty" json:"until,omitempty" comment:"until in graphite-web format, the local TZ is used"`
+	stop               uint
+	Step               uint    `toml:"step,omitempty" json:"step,omitempty" comment:"step in seconds"`
+	Interval           string  `toml:"interval,omitempty" json:"interval,omitempty" comment:"step with sub-second precision as go duration, e.g. '500ms' or '1.5s', it replaces step and timestamps have milliseconds"`
+	Jitter             string  `toml:"jitter,omitempty" json:"jitter,omitempty" comment:"deviation of each step as go duration, e.g. '2s' for 10s ± 2s, timestamps have milliseconds"`
+	JitterDistribution string  `mapstructure:"jitter-distribution" toml:"jitter-distribution,omitempty" json:"jitter-distribution,omitempty" comment:"distribution of the jitter, 'uniform' (default) in [step-jitter,step+jitter] or 'normal' with jitter as the standard deviation"`
+	Randomize          bool    `toml:"randomize" json:"randomize" comment:"randomize starting time with [0,step)"`
+	Value              float64 `toml:"value,omitempty" json:"value,omitempty" comment:"first value for all generators"`
+	Deviation          float64 `toml:"deviation,omitempty" json:"deviation,omitempty" comment:"deviation of the values, const will be generated around, counter will add [0,value+deviation), random will calculate next value around previous"`
+	Probability        uint8   `toml:"probability,omitempty" json:"probability,omitempty" comment:"probability of points to being sent. A valid value is [1,100]. It has randomized starting value, but is calculated as 'current + probability > 100', so has consistent behavior"`
+	Disorder           `mapstructure:",squash"`
 }
 
 // Custom is a config for a generators with special parameters. Is readed only from a config file.
 type Custom struct {
 	Name    string `toml:"name,omitempty" json:"name,omitempty" comment:"names for generator, braces are expanded like in shell"`
 	Type    string `toml:"type,omitempty" json:"type,omitempty" comment:"type of generator"`
+	Source  string `toml:"source,omitempty" json:"source,omitempty" comment:"file with the series for replay type, graphite-web JSON, CSV or carbon plain-text, '#name' suffix selects the series"`
+	Loop    bool   `toml:"loop,omitempty" json:"loop,omitempty" comment:"repeat the replayed series with its own step instead of rescaling it to from/until"`
+	Rollup  `mapstructure:",squash"`
+	Gaps    `mapstructure:",squash"`
 	General `mapstructure:",squash"`
 }
 
+// Rollup is a config for the resolution of custom generators changing with the age of points
+type Rollup struct {
+	Retentions  string `toml:"retentions,omitempty" json:"retentions,omitempty" comment:"retentions like in storage-schemas.conf, e.g. '10s:1d,1m:7d,1h:1y', the older points are aggregated into the lower precision, and the first precision replaces step"`
+	Aggregation string `toml:"aggregation,omitempty" json:"aggregation,omitempty" comment:"method to aggregate points for retentions like in storage-aggregation.conf, 'average' (default), 'sum', 'last', 'max', 'min', 'avg_zero', 'absmax' or 'absmin'"`
+}
+
+// spec returns generator.Rollup with parsed retentions and aggregation
+func (r *Rollup) spec() (generator.Rollup, error) {
+	var rollup generator.Rollup
+	var errs []error
+	if r.Retentions != "" {
+		retentions, err := storage.ParseRetentions(r.Retentions)
+		if err != nil {
+			errs = append(errs, &fieldError{"retentions", err})
+		}
+		rollup.Retentions = retentions
+	}
+	if r.Aggregation != "" {
+		aggregation, err := storage.ParseAggregation(r.Aggregation)
+		if err != nil {
+			errs = append(errs, &fieldError{"aggregation", err})
+		}
+		rollup.Aggregation = aggregation
+	}
+	return rollup, errors.Join(errs...)
+}
+
+// Gaps is a config for the missing and late points of custom generators
+type Gaps struct {
+	Outages           []Outage `toml:"outages,omitempty" json:"outages,omitempty" comment:"scheduled windows without points of the whole group"`
+	OutageInterval    uint     `mapstructure:"outage-interval" toml:"outage-interval,omitempty" json:"outage-interval,omitempty" comment:"mean interval between random outages of the whole group in seconds, 0 disables them"`
+	OutageLength      uint     `mapstructure:"outage-length" toml:"outage-length,omitempty" json:"outage-length,omitempty" comment:"mean length of random outages in seconds"`
+	SilenceInterval   uint     `mapstructure:"silence-interval" toml:"silence-interval,omitempty" json:"silence-interval,omitempty" comment:"mean interval between random silence periods of each series in seconds, 0 disables them"`
+	SilenceLength     uint     `mapstructure:"silence-length" toml:"silence-length,omitempty" json:"silence-length,omitempty" comment:"mean length of silence periods in seconds"`
+	Delay             uint     `toml:"delay,omitempty" json:"delay,omitempty" comment:"mean delay in seconds between the timestamp of a point and the time it's sent at"`
+	DelayDistribution string   `mapstructure:"delay-distribution" toml:"delay-distribution,omitempty" json:"delay-distribution,omitempty" comment:"distribution of delays, 'fixed' (default), 'uniform' in [0,2*delay] or 'exponential'"`
+}
+
+// Disorder is a config for the messy timestamps of generators
+type Disorder struct {
+	Duplicates uint8 `toml:"duplicates,omitempty" json:"duplicates,omitempty" comment:"percent of points sent twice with the same timestamp and a different value"`
+	Shuffle    uint  `toml:"shuffle,omitempty" json:"shuffle,omitempty" comment:"window in seconds, inside which points are reordered, it should be bigger than the step"`
+	ClockSkew  uint  `mapstructure:"clock-skew" toml:"clock-skew,omitempty" json:"clock-skew,omitempty" comment:"maximal clock skew in seconds, each series has a constant skew in [-clock-skew,clock-skew]"`
+}
+
+// Outage is the scheduled window without points
+type Outage struct {
+	From  string `toml:"from" json:"from" comment:"start of the outage in graphite-web format"`
+	Until string `toml:"until" json:"until" comment:"end of the outage in graphite-web format, the point at until is sent"`
+}
+
+// spec returns generator.Gaps with parsed outages
+func (g *Gaps) spec() (generator.Gaps, error) {
+	gaps := generator.Gaps{
+		OutageInterval:    g.OutageInterval,
+		OutageLength:      g.OutageLength,
+		SilenceInterval:   g.SilenceInterval,
+		SilenceLength:     g.SilenceLength,
+		Delay:             g.Delay,
+		DelayDistribution: g.DelayDistribution,
+	}
+	var errs []error
+	for i, o := range g.Outages {
+		start, errFrom := parseDate(o.From)
+		if errFrom != nil {
+			errs = append(errs, &fieldError{fmt.Sprintf("outages[%d].from", i), errFrom})
+		}
+		stop, errUntil := parseDate(o.Until)
+		if errUntil != nil {
+			errs = append(errs, &fieldError{fmt.Sprintf("outages[%d].until", i), errUntil})
+		}
+		gaps.Outages = append(gaps.Outages, generator.Window{Start: start, Stop: stop})
+	}
+	return gaps, errors.Join(errs...)
+}
+
+// Spec returns generator.Spec for a given custom config. An error is returned if dates of outages, the interval, the
+// jitter, retentions or the aggregation can't be parsed.
+func (c *Custom) Spec() (generator.Spec, error) {
+	gaps, err := c.Gaps.spec()
+	if err != nil {
+		return generator.Spec{}, err
+	}
+	interval, jitter, err := c.intervals()
+	if err != nil {
+		return generator.Spec{}, err
+	}
+	rollup, err := c.Rollup.spec()
+	if err != nil {
+		return generator.Spec{}, err
+	}
+	step := c.step(interval)
+	if len(rollup.Retentions) != 0 {
+		step = uint(rollup.Retentions[0].SecondsPerPoint)
+	}
+	return generator.Spec{
+		Type:               c.Type,
+		Name:               c.Name,
+		Start:              c.start,
+		Stop:               c.stop,
+		Step:               step,
+		Interval:           interval,
+		Jitter:             jitter,
+		JitterDistribution: c.JitterDistribution,
+		Randomize:          c.Randomize,
+		Value:              c.Value,
+		Deviation:          c.Deviation,
+		Probability:        c.Probability,
+		Source:             c.Source,
+		Loop:               c.Loop,
+		Gaps:               gaps,
+		Rollup:             rollup,
+		Disorder: generator.Disorder{
+			Duplicates: c.Duplicates,
+			Shuffle:    c.Shuffle,
+			ClockSkew:  c.ClockSkew,
+		},
+		Logger: generatorLogger(),
+	}, nil
+}
+
 // ToGenerators returns generator.Generators for a given custom config
 func (c *Custom) ToGenerators() (generator.Generators, error) {
-	return generator.NewExpand(c.Type, c.Name, c.start, c.stop, c.Step, c.Randomize, c.Value, c.Deviation, c.Probability)
+	s, err := c.Spec()
+	if err != nil {
+		return generator.Generators{}, err
+	}
+	return generator.NewExpandFromSpec(s)
+}
+
+// ToLazyGenerators returns generator.LazyGenerators for a given custom config
+func (c *Custom) ToLazyGenerators() (generator.LazyGenerators, error) {
+	s, err := c.Spec()
+	if err != nil {
+		return generator.LazyGenerators{}, err
+	}
+	return generator.NewLazyFromSpec(s)
 }
 
 // Config is a general application config. Everything besides Generators can be set both from flags and config file.
 type Config struct {
-	Carbon  string   `toml:"carbon" json:"carbon" comment:"carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port' or 'udp://server:port'"`
-	Const   []string `toml:"const,omitempty" json:"const,omitempty" comment:"names for constant generators, braces are expanded like in shell\n values are generated with deviation around starting value"`
-	Counter []string `toml:"counter,omitempty" json:"counter,omitempty" comment:"names for counter generators, braces are expanded like in shell\n values are incremented by value with deviation, but not less then the previous value"`
-	Random  []string `toml:"random,omitempty" json:"random,omitempty" comment:"names for random generators, braces are expanded like in shell\n values are generated with deviation around the previous value"`
-	General `mapstructure:",squash"`
-	Custom  []Custom `toml:"custom,omitempty" json:"custom,omitempty" comment:"generators with custom parameters can be specified separately"`
+	Carbon     string   `toml:"carbon" json:"carbon" comment:"carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port', 'udp://server:port', 'file:///path/out-%Y%m%d.txt', 'whisper://path/to/storage' or 'clickhouse://path/to/points.tsv'"`
+	Seed       int64    `toml:"seed,omitempty" json:"seed,omitempty" comment:"seed for reproducible generation, the same config and seed produce the same points. 0 means the random data on each run"`
+	Const      []string `toml:"const,omitempty" json:"const,omitempty" comment:"names for constant generators, braces are expanded like in shell\n values are generated with deviation around starting value"`
+	Counter    []string `toml:"counter,omitempty" json:"counter,omitempty" comment:"names for counter generators, braces are expanded like in shell\n values are incremented by value with deviation, but not less then the previous value"`
+	Random     []string `toml:"random,omitempty" json:"random,omitempty" comment:"names for random generators, braces are expanded like in shell\n values are generated with deviation around the previous value"`
+	Generators []string `toml:"generators,omitempty" json:"generators,omitempty" comment:"generators of any type, including registered by generator.Register, in 'type:name' format"`
+	General    `mapstructure:",squash"`
+	Custom     []Custom `toml:"custom,omitempty" json:"custom,omitempty" comment:"generators with custom parameters can be specified separately"`
 }
 
 var now = time.Now().Unix()
 
-// SetStartStop process graphite-web from/until and sets start and stop fields
-func (c *Config) SetStartStop() {
-	c.start = uint(date.DateParamToEpoch(c.From, "", now, nil))
-	c.stop = uint(date.DateParamToEpoch(c.Until, "", now, nil))
-	for _, g := range c.Custom {
-		g.start = uint(date.DateParamToEpoch(g.From, "", now, nil))
-		g.stop = uint(date.DateParamToEpoch(g.Until, "", now, nil))
+// parseDate returns the epoch for the date in graphite-web format, the empty date is now. The date.DateParamToEpoch returns the default
+// value for unparseable dates, so two different defaults are used to detect it.
+func parseDate(s string) (uint, error) {
+	if s == "" {
+		return uint(now), nil
+	}
+	ts := date.DateParamToEpoch(s, "", 0, nil)
+	if ts == 0 && date.DateParamToEpoch(s, "", 1, nil) == 1 {
+		return 0, fmt.Errorf("unable to parse %q as graphite-web date", s)
+	}
+	if ts < 0 {
+		return 0, fmt.Errorf("date %q is before the epoch", s)
+	}
+	return uint(ts), nil
+}
+
+// intervals returns parsed interval and jitter
+func (g *General) intervals() (interval, jitter time.Duration, err error) {
+	var errs []error
+	if g.Interval != "" {
+		if interval, err = time.ParseDuration(g.Interval); err != nil {
+			errs = append(errs, &fieldError{"interval", err})
+		}
+	}
+	if g.Jitter != "" {
+		if jitter, err = time.ParseDuration(g.Jitter); err != nil {
+			errs = append(errs, &fieldError{"jitter", err})
+		}
+	}
+	return interval, jitter, errors.Join(errs...)
+}
+
+// step returns the step in seconds, the sub-second interval is rounded up
+func (g *General) step(interval time.Duration) uint {
+	if interval <= 0 {
+		return g.Step
+	}
+	return uint((interval + time.Second - 1) / time.Second)
+}
+
+// setStartStop parses from and until and sets start and stop fields
+func (g *General) setStartStop() error {
+	var err, errFrom, errUntil error
+	g.start, errFrom = parseDate(g.From)
+	if errFrom != nil {
+		err = errors.Join(err, &fieldError{"from", errFrom})
+	}
+	g.stop, errUntil = parseDate(g.Until)
+	if errUntil != nil {
+		err = errors.Join(err, &fieldError{"until", errUntil})
 	}
+	return err
+}
+
+// inheritDates sets the empty from and until to the ones of the general config
+func (g *General) inheritDates(general *General) {
+	if g.From == "" {
+		g.From = general.From
+	}
+	if g.Until == "" {
+		g.Until = general.Until
+	}
+}
+
+// SetStartStop process graphite-web from/until and sets start and stop fields. The custom configs without from or
+// until inherit them from the general config.
+func (c *Config) SetStartStop() error {
+	var errs []error
+	if err := c.General.setStartStop(); err != nil {
+		errs = append(errs, err)
+	}
+	for i := range c.Custom {
+		c.Custom[i].inheritDates(&c.General)
+		if err := c.Custom[i].setStartStop(); err != nil {
+			errs = append(errs, prefixErrors(fmt.Sprintf("custom[%d]", i), err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // ResetStartStop sets all start and stop values of the general and cutom configs to the current timestamp
 func (c *Config) ResetStartStop() {
-	c.start = uint(now)
-	c.stop = uint(now)
-	for _, g := range c.Custom {
-		g.start = uint(now)
-		g.stop = uint(now)
+	c.General.resetStartStop(now)
+	for i := range c.Custom {
+		c.Custom[i].resetStartStop(now)
 	}
 }
 
-// ToGenerators returns slice of generator.Generators for main config and each Config.Custom
-func (c *Config) ToGenerators() ([]generator.Generators, error) {
-	result := make([]generator.Generators, 0, len(c.Custom)+3)
+func (g *General) resetStartStop(ts int64) {
+	g.start = uint(ts)
+	g.stop = uint(ts)
+}
+
+// Customs returns the Custom for each name of const, counter, random and 'type:name' generators with general
+// parameters, and then all Config.Custom
+func (c *Config) Customs() []Custom {
+	result := make([]Custom, 0, len(c.Const)+len(c.Counter)+len(c.Random)+len(c.Custom))
 	for _, n := range c.Const {
-		gen, err := generator.NewExpand("const", n, c.start, c.stop, c.Step, c.Randomize, c.Value, c.Deviation, c.Probability)
-		if err != nil {
-			return nil, fmt.Errorf("unable to create new constant generators: %w", err)
-		}
-		result = append(result, gen)
+		result = append(result, Custom{Name: n, Type: "const", General: c.General})
 	}
 	for _, n := range c.Counter {
-		gen, err := generator.NewExpand("counter", n, c.start, c.stop, c.Step, c.Randomize, c.Value, c.Deviation, c.Probability)
-		if err != nil {
-			return nil, fmt.Errorf("unable to create new counter generators: %w", err)
-		}
-		result = append(result, gen)
+		result = append(result, Custom{Name: n, Type: "counter", General: c.General})
 	}
 	for _, n := range c.Random {
-		gen, err := generator.NewExpand("random", n, c.start, c.stop, c.Step, c.Randomize, c.Value, c.Deviation, c.Probability)
+		result = append(result, Custom{Name: n, Type: "random", General: c.General})
+	}
+	for _, g := range c.Generators {
+		typeName, name, _ := strings.Cut(g, ":")
+		result = append(result, Custom{Name: name, Type: typeName, General: c.General})
+	}
+	return append(result, c.Custom...)
+}
+
+// ToGenerators returns slice of generator.Generators for main config and each Config.Custom
+func (c *Config) ToGenerators() ([]generator.Generators, error) {
+	customs := c.Customs()
+	result := make([]generator.Generators, 0, len(customs))
+	for _, custom := range customs {
+		gen, err := custom.ToGenerators()
 		if err != nil {
-			return nil, fmt.Errorf("unable to create new random generators: %w", err)
+			return nil, fmt.Errorf("unable to create new %s generators for %s: %w", custom.Type, custom.Name, err)
 		}
 		result = append(result, gen)
 	}
-	for _, custom := range c.Custom {
-		gen, err := custom.ToGenerators()
+	for _, gg := range result {
+		logger.Info("generators are created", "group", gg.Name(), "type", gg.TypeName(), "generators", len(gg.List()))
+	}
+	return result, nil
+}
+
+// ToLazyGenerators returns slice of generator.LazyGenerators for main config and each Config.Custom
+func (c *Config) ToLazyGenerators() ([]generator.LazyGenerators, error) {
+	customs := c.Customs()
+	result := make([]generator.LazyGenerators, 0, len(customs))
+	for _, custom := range customs {
+		lg, err := custom.ToLazyGenerators()
 		if err != nil {
-			return nil, fmt.Errorf("unable to create new custom generators for %v: %w", custom, err)
+			return nil, fmt.Errorf("unable to create new %s generators for %s: %w", custom.Type, custom.Name, err)
 		}
-		result = append(result, gen)
+		result = append(result, lg)
+	}
+	for _, lg := range result {
+		logger.Info("lazy generators are created", "group", lg.Name(), "type", lg.TypeName(), "generators", lg.Len())
 	}
 	return result, nil
 }
 
-// GetCarbonWriter returns net.Conn. If it's unable to parse the Carbon field, an error is not nil.
+// GetCarbonWriter returns net.Conn, or the writer of files, whisper files or carbon-clickhouse tables. If it's unable to parse
+// the Carbon field, an error is not nil.
 func (c *Config) GetCarbonWriter() (io.Writer, error) {
 	if c.Carbon == "-" {
 		return os.Stdout, nil
 	}
+	if strings.HasPrefix(c.Carbon, "file://") {
+		w, err := newFileWriter(c.Carbon)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file output %s: %w", c.Carbon, err)
+		}
+		return w, nil
+	}
 	u, err := url.Parse(c.Carbon)
 	if err != nil {
 		return nil, fmt.Errorf("unable to parse URL from %s: %w", config.Carbon, err)
 	}
+	if u.Scheme == "whisper" {
+		w, err := newWhisperWriter(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid whisper output %s: %w", c.Carbon, err)
+		}
+		logger.Info("writing to whisper files", "root", w.root, "retentions", w.retentions, "aggregation", w.aggregation.String())
+		return w, nil
+	}
+	if u.Scheme == "clickhouse" {
+		w, err := newClickhouseWriter(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid clickhouse output %s: %w", c.Carbon, err)
+		}
+		return w, nil
+	}
 	if u.Scheme != "tcp" && u.Scheme != "udp" {
 		return nil, fmt.Errorf("scheme %s in %s is not valid", u.Scheme, config.Carbon)
 	}
@@ -123,7 +386,65 @@ func (c *Config) GetCarbonWriter() (io.Writer, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to carbon: %w", err)
 	}
-	return conn, nil
+	cc := &carbonConn{network: u.Scheme, address: u.Host, conn: conn}
+	cc.connected.Store(true)
+	logger.Info("connected to carbon", "destination", cc.Destination())
+	return cc, nil
+}
+
+// carbonConn writes to the carbon connection. On a write error it reconnects and retries the rest of data once.
+type carbonConn struct {
+	mu         sync.Mutex
+	network    string
+	address    string
+	conn       net.Conn
+	connected  atomic.Bool
+	reconnects atomic.Uint64
+}
+
+func (c *carbonConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, err := c.conn.Write(p)
+	if err == nil {
+		return n, nil
+	}
+	c.conn.Close()
+	c.connected.Store(false)
+	logger.Warn("write to carbon failed, reconnecting", "destination", c.Destination(), "error", err)
+	conn, dialErr := net.Dial(c.network, c.address)
+	if dialErr != nil {
+		logger.Error("unable to reconnect to carbon", "destination", c.Destination(), "error", dialErr)
+		return n, fmt.Errorf("%w, unable to reconnect to carbon: %v", err, dialErr)
+	}
+	c.conn = conn
+	c.connected.Store(true)
+	c.reconnects.Add(1)
+	logger.Info("reconnected to carbon", "destination", c.Destination())
+	add, err := c.conn.Write(p[n:])
+	return n + add, err
+}
+
+// Unwrap returns the current connection
+func (c *carbonConn) Unwrap() io.Writer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn
+}
+
+// Connected returns true if the last write or reconnect succeeded
+func (c *carbonConn) Connected() bool {
+	return c.connected.Load()
+}
+
+// Destination returns the carbon address in the URL form
+func (c *carbonConn) Destination() string {
+	return c.network + "://" + c.address
+}
+
+// Reconnects returns the amount of reconnects
+func (c *carbonConn) Reconnects() uint64 {
+	return c.reconnects.Load()
 }
 
 var (
@@ -131,12 +452,39 @@ var (
 	config  *Config
 )
 
-func unmarshalConfig() {
-	config = &Config{}
-	if err := viper.Unmarshal(config); err != nil {
-		log.Fatalf("Fail to unmarshal config %v", viper.AllSettings())
+func unmarshalConfig() error {
+	c, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	config = c
+	config.applySeed()
+	return nil
+}
+
+// applySeed sets the seed for generators if it's not 0
+func (c *Config) applySeed() {
+	if c.Seed == 0 {
+		generator.ResetSeed()
+		return
 	}
-	config.SetStartStop()
+	generator.SetSeed(c.Seed)
+	logger.Info("generation is seeded", "seed", c.Seed)
+}
+
+// loadConfig returns the new Config from the current viper settings
+func loadConfig() (*Config, error) {
+	c := &Config{}
+	if err := viper.Unmarshal(c); err != nil {
+		return nil, fmt.Errorf("fail to unmarshal config %v: %w", viper.AllSettings(), err)
+	}
+	if err := c.SetStartStop(); err != nil {
+		return nil, err
+	}
+	logger.Debug("config is resolved", "carbon", c.Carbon, "from", c.From, "until", c.Until,
+		"step", c.Step, "const", len(c.Const), "counter", len(c.Counter), "random", len(c.Random),
+		"generators", len(c.Generators), "custom", len(c.Custom))
+	return c, nil
 }
 
 func setDefaultConfig() {
@@ -151,22 +499,25 @@ func setDefaultConfig() {
 	viper.SetDefault("value", 10)
 	viper.SetDefault("deviation", 5)
 	viper.SetDefault("probability", 100)
-	viper.SetDefault("generators", []Custom{})
+	viper.SetDefault("generators", []string{})
 }
 
-func readConfig() {
+func readConfig() error {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	if cfgFile == "" {
-		return
+		return nil
 	}
 	viper.SetConfigFile(cfgFile)
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return
+			logger.Warn("config file does not exist", "file", cfgFile)
+			return nil
 		}
-		log.Fatalf("Error while reading from %s: %v", viper.ConfigFileUsed(), err)
+		return fmt.Errorf("error while reading from %s: %w", viper.ConfigFileUsed(), err)
 	}
+	logger.Info("config file is read", "file", viper.ConfigFileUsed())
+	return nil
 }
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dummy is the generator type registered in tests, it always produces 42
+type dummy struct {
+	name string
+	time uint
+	stop uint
+	step uint
+}
+
+func (d *dummy) Next() error {
+	if d.time > d.stop {
+		return generator.ErrGenOver
+	}
+	d.time += d.step
+	return nil
+}
+
+func (d *dummy) Point() []byte { return []byte(fmt.Sprintf("%s 42 %d\n", d.name, d.time)) }
+func (d *dummy) Current() generator.Point {
+	return generator.Point{Name: d.name, Value: 42, Timestamp: d.time}
+}
+func (d *dummy) SetStop(stop uint) { d.stop = stop }
+func (d *dummy) Stop() uint        { return d.stop }
+func (d *dummy) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(d.Point())
+	return int64(n), err
+}
+
+var registerDummy sync.Once
+
+func registerDummyType(t *testing.T) {
+	registerDummy.Do(func() {
+		require.NoError(t, generator.Register("dummy", func(s generator.Spec) (generator.Generator, error) {
+			return &dummy{name: s.Name, time: s.Start, stop: s.Stop, step: s.Step}, nil
+		}))
+	})
+}
+
+func TestRegisteredType(t *testing.T) {
+	registerDummyType(t)
+	assert.ErrorIs(t, generator.Register("dummy", nil), generator.ErrWrongType)
+
+	dir := t.TempDir()
+	cfg := filepath.Join(dir, "dummy.toml")
+	require.NoError(t, os.WriteFile(cfg, []byte(`from = "1700000000"
+until = "1700000060"
+step = 60
+generators = ["dummy:gen.{1..2}"]
+
+[[custom]]
+name = "custom"
+type = "dummy"
+from = "1700000000"
+until = "1700000060"
+step = 60
+probability = 100
+`), 0o644))
+	defer func() {
+		viper.Reset()
+		setDefaultConfig()
+	}()
+	cfgFile = cfg
+	defer func() { cfgFile = "" }()
+	require.NoError(t, readConfig())
+	c, err := loadConfig()
+	require.NoError(t, err)
+	assert.NoError(t, c.Validate())
+
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	require.Len(t, ggg, 2)
+	buf := new(bytes.Buffer)
+	for _, gg := range ggg {
+		assert.Equal(t, "dummy", gg.TypeName())
+		_, err = gg.WriteAllTo(buf)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "gen.1 42 1700000000\ngen.2 42 1700000000\n"+
+		"gen.1 42 1700000060\ngen.2 42 1700000060\n"+
+		"gen.1 42 1700000120\ngen.2 42 1700000120\n"+
+		"custom 42 1700000000\ncustom 42 1700000060\ncustom 42 1700000120\n", buf.String())
+}
+
+func TestRegisteredTypeFlag(t *testing.T) {
+	registerDummyType(t)
+	buf := &strings.Builder{}
+	require.NoError(t, executeRoot(t, buf, &strings.Builder{}, "list", "--generator", "dummy:flag.{1..2}", "--format", "flat"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "flag.1\tdummy\t"), lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "flag.2\tdummy\t"), lines[1])
+
+	c := Config{
+		General:    General{From: "-1h", Until: "now", Step: 60, Probability: 100},
+		Generators: []string{"unknown:metric", "dummy:"},
+	}
+	problems := flattenErrors(c.Validate())
+	require.Len(t, problems, 2, problems)
+	assert.ErrorIs(t, problems[0], generator.ErrWrongType)
+	assert.True(t, strings.HasPrefix(problems[1].Error(), "generators[1].name: "), problems[1])
+}
+
+func TestCustomGaps(t *testing.T) {
+	cfg := filepath.Join(t.TempDir(), "gaps.toml")
+	require.NoError(t, os.WriteFile(cfg, []byte(`[[custom]]
+name = "metric"
+type = "const"
+from = "1700000000"
+until = "1700000240"
+step = 60
+value = 1
+deviation = 0
+probability = 100
+delay = 60
+delay-distribution = "fixed"
+outage-interval = 3600
+outage-length = 1
+outages = [{from = "1700000060", until = "1700000120"}]
+duplicates = 10
+shuffle = 120
+clock-skew = 5
+`), 0o644))
+	defer func() {
+		viper.Reset()
+		setDefaultConfig()
+	}()
+	cfgFile = cfg
+	defer func() { cfgFile = "" }()
+	require.NoError(t, readConfig())
+	c, err := loadConfig()
+	require.NoError(t, err)
+	require.NoError(t, c.Validate())
+	assert.Equal(t, Gaps{
+		Outages:           []Outage{{From: "1700000060", Until: "1700000120"}},
+		OutageInterval:    3600,
+		OutageLength:      1,
+		Delay:             60,
+		DelayDistribution: "fixed",
+	}, c.Custom[0].Gaps)
+	assert.Equal(t, Disorder{Duplicates: 10, Shuffle: 120, ClockSkew: 5}, c.Custom[0].Disorder)
+
+	// the outage is set, and the random one and disorder are not
+	c.Custom[0].OutageInterval = 0
+	c.Custom[0].Disorder = Disorder{}
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = ggg[0].WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "metric 1 1700000000\nmetric 1 1700000120\nmetric 1 1700000180\nmetric 1 1700000240\n"+
+		"metric 1 1700000300\n", buf.String())
+	assert.Equal(t, uint64(1), ggg[0].Dropped())
+
+	c.Custom[0].Outages[0].Until = "invalid"
+	_, err = c.ToGenerators()
+	assert.ErrorContains(t, err, "outages[0].until")
+}
+
+func TestGeneralDisorder(t *testing.T) {
+	require.NoError(t, executeRoot(t, &strings.Builder{}, &strings.Builder{}, "list", "--const", "metric",
+		"--duplicates", "100", "--shuffle", "120", "--clock-skew", "30"))
+	assert.Equal(t, Disorder{Duplicates: 100, Shuffle: 120, ClockSkew: 30}, config.Disorder)
+
+	// the disorder of the general config is used by const, counter and random generators
+	general := General{From: "1700000000", Until: "1700000120", Step: 60, Value: 1, Probability: 100,
+		Disorder: Disorder{Duplicates: 100}}
+	c := Config{General: general, Const: []string{"metric"}}
+	require.NoError(t, c.Validate())
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	timestamps := make(map[uint]int)
+	for p := range ggg[0].Points() {
+		timestamps[p.Timestamp]++
+	}
+	assert.Equal(t, map[uint]int{1700000000: 2, 1700000060: 2, 1700000120: 2, 1700000180: 2}, timestamps)
+}
+
+func TestCustomInheritDates(t *testing.T) {
+	general := General{From: "1700000000", Until: "1700000600"}
+	c := Config{General: general, Custom: []Custom{{Name: "a"}, {Name: "b", General: General{Until: "1700000060"}}}}
+	require.NoError(t, c.SetStartStop())
+	assert.Equal(t, [2]uint{1700000000, 1700000600}, [2]uint{c.Custom[0].start, c.Custom[0].stop})
+	assert.Equal(t, [2]uint{1700000000, 1700000060}, [2]uint{c.Custom[1].start, c.Custom[1].stop})
+}
+
+func TestCustomInterval(t *testing.T) {
+	general := General{From: "1700000000", Until: "1700000001", Interval: "500ms", Value: 1, Probability: 100}
+	c := Config{General: general, Custom: []Custom{{Name: "metric", Type: "const", General: general}}}
+	require.NoError(t, c.Validate())
+	spec, err := c.Custom[0].Spec()
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), spec.Step)
+	assert.Equal(t, 500*time.Millisecond, spec.Interval)
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = ggg[0].WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "metric 1 1700000000\nmetric 1 1700000000.500\nmetric 1 1700000001\nmetric 1 1700000001.500\n",
+		buf.String())
+
+	c.Custom[0].Interval = "invalid"
+	_, err = c.ToGenerators()
+	assert.ErrorContains(t, err, "interval")
+}
+
+func TestCustomRollup(t *testing.T) {
+	general := General{From: "1700000000", Until: "1700002800", Step: 60, Value: 1, Probability: 100}
+	c := Config{General: general, Custom: []Custom{{
+		Name:    "metric",
+		Type:    "const",
+		Rollup:  Rollup{Retentions: "10s:1m,1m:5m,5m:30m", Aggregation: "sum"},
+		General: general,
+	}}}
+	require.NoError(t, c.Validate())
+	spec, err := c.Custom[0].Spec()
+	require.NoError(t, err)
+	assert.Equal(t, uint(10), spec.Step)
+	assert.Equal(t, generator.AggregationSum, spec.Rollup.Aggregation)
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = ggg[0].WriteAllTo(buf)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 17)
+	assert.Equal(t, "metric 30 1700001000", lines[0])
+	assert.Equal(t, "metric 6 1700002500", lines[5])
+	assert.Equal(t, "metric 1 1700002810", lines[16])
+
+	r, err := c.estimate(0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(17), r.Groups[0].PointsPerSeries)
+	assert.InDelta(t, 0.1, r.Groups[0].OnlineRate, 1e-9)
+
+	c.Custom[0].Aggregation = "median"
+	_, err = c.ToGenerators()
+	assert.ErrorContains(t, err, "aggregation")
+}
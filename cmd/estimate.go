@@ -0,0 +1,353 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/whisper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// estimateCmd represents the estimate command
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimates amount of series, points and bytes without generation",
+	Long: `Expands every name, and counts series and points per group
+from from, until, step and probability. Then the output size
+is estimated for each output format: carbon plain-text, gzip
+and zstd files, whisper files with the retentions of the
+whisper output, and clickhouse points in TSV and RowBinary.
+The values of deviated generators are estimated as 17
+significant digits. The compression is measured on a sample
+of points generated for the first names of each group.
+
+With --rate the expected time of the generation is calculated.
+The online rate is the amount of points per second in the
+online mode.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		bindCommonFlags(cmd)
+		f := cmd.Flags()
+		viper.BindPFlag("from", f.Lookup("from"))
+		viper.BindPFlag("until", f.Lookup("until"))
+
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
+	},
+	RunE: estimation,
+}
+
+var estimateOpts struct {
+	rate   float64
+	format string
+}
+
+func init() {
+	rootCmd.AddCommand(estimateCmd)
+
+	f := estimateCmd.Flags()
+	f.SortFlags = false
+
+	commonFlags(estimateCmd)
+	f.String("from", viper.GetString("from"), "starting point for generators in graphtie-web format")
+	f.String("until", viper.GetString("until"), "final point for generators in graphtie-web format")
+	f.Float64Var(&estimateOpts.rate, "rate", 0, "rate limit in points per second to calculate the expected time")
+	f.StringVar(&estimateOpts.format, "format", "text", "output format, 'text' or 'json'")
+}
+
+// estimateFormat is the output format with the size of a group in bytes
+type estimateFormat struct {
+	name string
+	size func(g groupSize) uint64
+}
+
+// groupSize is the input of the size estimation of a group
+type groupSize struct {
+	// series is the amount of series, and namesLen is the total length of their names
+	series, namesLen uint64
+	// points is the amount of points per series after the probability
+	points float64
+	// value and timestamp are the lengths of formatted values and timestamps, seconds is the timestamp without
+	// milliseconds
+	value, timestamp, seconds int
+	// whisperFile is the size of a single whisper file
+	whisperFile uint64
+	// compression is the ratio of the compressed carbon plain-text size to the original one for each compress
+	compression map[string]float64
+}
+
+// rows returns the size of points with the name and rowSize bytes of other columns
+func (g groupSize) rows(rowSize int) uint64 {
+	return uint64(float64(g.namesLen+g.series*uint64(rowSize)) * g.points)
+}
+
+func (g groupSize) carbon() uint64 {
+	return g.rows(g.value + g.timestamp + 3)
+}
+
+// estimateFormats are the outputs with the estimated size. The clickhouse formats count the points table only, the
+// RowBinary strings are prefixed by the length of a single byte for names shorter than 128 bytes.
+var estimateFormats = []estimateFormat{
+	{"carbon", groupSize.carbon},
+	{"gzip", func(g groupSize) uint64 { return uint64(float64(g.carbon()) * g.compression["gzip"]) }},
+	{"zstd", func(g groupSize) uint64 { return uint64(float64(g.carbon()) * g.compression["zstd"]) }},
+	{"whisper", func(g groupSize) uint64 { return g.series * g.whisperFile }},
+	// path, value, timestamp, date, version and 5 separators
+	{"clickhouse-tsv", func(g groupSize) uint64 { return g.rows(g.value + g.seconds + 10 + 10 + 5) }},
+	// path length, Float64, UInt32 timestamp, Date and UInt32 version
+	{"clickhouse-rowbinary", func(g groupSize) uint64 { return g.rows(1 + 8 + 4 + 2 + 4) }},
+}
+
+// estimateSampleSeries and estimateSamplePoints limit the points generated to estimate the compression
+const (
+	estimateSampleSeries = 16
+	estimateSamplePoints = 256
+)
+
+// deviatedValueLength is the length of float64 with 17 significant digits and the decimal point
+const deviatedValueLength = 18
+
+// groupEstimate is the estimation for a single group of generators
+type groupEstimate struct {
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	Series          uint64            `json:"series"`
+	PointsPerSeries uint64            `json:"points_per_series"`
+	Points          uint64            `json:"points"`
+	Bytes           map[string]uint64 `json:"bytes"`
+	OnlineRate      float64           `json:"online_rate"`
+}
+
+type estimateReport struct {
+	Series     uint64            `json:"series"`
+	Points     uint64            `json:"points"`
+	Bytes      map[string]uint64 `json:"bytes"`
+	OnlineRate float64           `json:"online_rate"`
+	Rate       float64           `json:"rate,omitempty"`
+	Duration   float64           `json:"duration,omitempty"`
+	Groups     []groupEstimate   `json:"groups"`
+}
+
+// valueLength returns the estimated length of formatted values
+func valueLength(typeName string, value, deviation float64, points uint64) int {
+	if deviation != 0 {
+		return deviatedValueLength
+	}
+	if typeName == "counter" {
+		// the counter grows up to value*points, the longest value is used
+		value *= float64(points)
+	}
+	return len(strconv.FormatFloat(value, 'f', -1, 64))
+}
+
+// estimate returns the estimation for the custom without creating generators except the sample for the compression.
+// The whisperFile is the size of a single whisper file.
+func (c *Custom) estimate(whisperFile uint64) (groupEstimate, error) {
+	if _, err := generator.GetType(c.Type); err != nil {
+		return groupEstimate{}, err
+	}
+	names, err := generator.NewExpansion(c.Name)
+	if err != nil {
+		return groupEstimate{}, err
+	}
+	if names.Len() == 0 {
+		return groupEstimate{}, fmt.Errorf("%w: %s", generator.ErrEmptyGens, c.Name)
+	}
+	interval, _, err := c.intervals()
+	if err != nil {
+		return groupEstimate{}, err
+	}
+	rollup, err := c.Rollup.spec()
+	if err != nil {
+		return groupEstimate{}, err
+	}
+	ge := groupEstimate{
+		Name:            c.Name,
+		Type:            c.Type,
+		Series:          names.Len(),
+		PointsPerSeries: generator.CountPoints(c.start, c.stop, c.Step),
+		Bytes:           make(map[string]uint64, len(estimateFormats)),
+	}
+	switch {
+	case len(rollup.Retentions) != 0:
+		// the online mode sends the points of the first retention only
+		interval = time.Duration(rollup.Retentions[0].SecondsPerPoint) * time.Second
+		ge.PointsPerSeries = generator.CountPointsRollup(c.start, c.stop, rollup)
+	case interval <= 0:
+		interval = time.Duration(c.Step) * time.Second
+	default:
+		ge.PointsPerSeries = generator.CountPointsInterval(c.start, c.stop, interval)
+	}
+	probability := float64(c.Probability) / 100
+	ge.Points = uint64(float64(ge.Series*ge.PointsPerSeries) * probability)
+	if interval != 0 {
+		ge.OnlineRate = float64(ge.Series) * probability / interval.Seconds()
+	}
+	compression, err := c.compression(names)
+	if err != nil {
+		return groupEstimate{}, err
+	}
+	g := groupSize{
+		series:      ge.Series,
+		namesLen:    names.NamesLen(),
+		points:      float64(ge.PointsPerSeries) * probability,
+		value:       valueLength(c.Type, c.Value, c.Deviation, ge.PointsPerSeries),
+		seconds:     len(strconv.FormatUint(uint64(c.stop), 10)),
+		whisperFile: whisperFile,
+		compression: compression,
+	}
+	g.timestamp = g.seconds
+	if interval%time.Second != 0 {
+		// the fractional timestamps have 3 digits of milliseconds
+		g.timestamp += 4
+	}
+	for _, f := range estimateFormats {
+		ge.Bytes[f.name] = f.size(g)
+	}
+	return ge, nil
+}
+
+// compression returns the compression ratios of the carbon plain-text for the first estimateSamplePoints points of
+// the first estimateSampleSeries names. The points are written by timestamps like the generation does.
+func (c *Custom) compression(names *generator.Expansion) (map[string]float64, error) {
+	s, err := c.Spec()
+	if err != nil {
+		return nil, err
+	}
+	var pulls []func() (generator.Point, bool)
+	for i := range min(names.Len(), estimateSampleSeries) {
+		s.Name = names.Name(i)
+		g, err := generator.NewFromSpec(s)
+		if err != nil {
+			return nil, err
+		}
+		next, stop := iter.Pull(generator.Points(g))
+		defer stop()
+		pulls = append(pulls, next)
+	}
+	var sample []byte
+	for range estimateSamplePoints {
+		for _, next := range pulls {
+			if p, ok := next(); ok {
+				sample = p.AppendCarbon(sample)
+			}
+		}
+	}
+	ratios := make(map[string]float64, 2)
+	if len(sample) == 0 {
+		return ratios, nil
+	}
+	for _, compress := range []string{"gzip", "zstd"} {
+		buf := new(bytes.Buffer)
+		w, err := newCompressor(buf, compress)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(sample); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		ratios[compress] = float64(buf.Len()) / float64(len(sample))
+	}
+	return ratios, nil
+}
+
+// whisperFileSize returns the size of whisper files with the retentions of the whisper output, or the default ones
+func (c *Config) whisperFileSize() (uint64, error) {
+	q := url.Values{}
+	if u, err := url.Parse(c.Carbon); err == nil && u.Scheme == "whisper" {
+		q = u.Query()
+	}
+	retentions, err := whisperRetentions(q)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(whisper.FileSize(retentions)), nil
+}
+
+// estimate returns the estimation for all generators in the config, the rate is used to calculate the duration
+func (c *Config) estimate(rate float64) (estimateReport, error) {
+	r := estimateReport{Bytes: make(map[string]uint64, len(estimateFormats)), Rate: rate}
+	whisperFile, err := c.whisperFileSize()
+	if err != nil {
+		return r, fmt.Errorf("invalid whisper output %s: %w", c.Carbon, err)
+	}
+	for _, custom := range c.Customs() {
+		ge, err := custom.estimate(whisperFile)
+		if err != nil {
+			return r, fmt.Errorf("unable to estimate %s generators for %s: %w", custom.Type, custom.Name, err)
+		}
+		r.Series += ge.Series
+		r.Points += ge.Points
+		r.OnlineRate += ge.OnlineRate
+		for format, size := range ge.Bytes {
+			r.Bytes[format] += size
+		}
+		r.Groups = append(r.Groups, ge)
+	}
+	if rate != 0 {
+		r.Duration = float64(r.Points) / rate
+	}
+	return r, nil
+}
+
+func (r *estimateReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "group\ttype\tseries\tpoints/series\tpoints\t")
+	for _, f := range estimateFormats {
+		fmt.Fprintf(tw, "%s bytes\t", f.name)
+	}
+	fmt.Fprintln(tw, "online rate/s\t")
+	for _, ge := range r.Groups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t", ge.Name, ge.Type, ge.Series, ge.PointsPerSeries, ge.Points)
+		for _, f := range estimateFormats {
+			fmt.Fprintf(tw, "%d\t", ge.Bytes[f.name])
+		}
+		fmt.Fprintf(tw, "%.2f\t\n", ge.OnlineRate)
+	}
+	fmt.Fprintf(tw, "total\t\t%d\t\t%d\t", r.Series, r.Points)
+	for _, f := range estimateFormats {
+		fmt.Fprintf(tw, "%d\t", r.Bytes[f.name])
+	}
+	fmt.Fprintf(tw, "%.2f\t\n", r.OnlineRate)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if r.Rate != 0 {
+		duration := time.Duration(r.Duration * float64(time.Second)).Round(time.Second)
+		_, err := fmt.Fprintf(w, "expected time at %g points/s: %s\n", r.Rate, duration)
+		return err
+	}
+	return nil
+}
+
+func estimation(cmd *cobra.Command, args []string) error {
+	if estimateOpts.format != "text" && estimateOpts.format != "json" {
+		return fmt.Errorf("format %s is not in [text json]", estimateOpts.format)
+	}
+	if estimateOpts.rate < 0 {
+		return fmt.Errorf("rate %g must not be negative", estimateOpts.rate)
+	}
+	r, err := config.estimate(estimateOpts.rate)
+	if err != nil {
+		return err
+	}
+	return r.write(cmd.OutOrStdout(), estimateOpts.format)
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValueLength(t *testing.T) {
+	assert.Equal(t, 1, valueLength("const", 1, 0, 100))
+	assert.Equal(t, 3, valueLength("const", 1.5, 0, 100))
+	assert.Equal(t, 3, valueLength("counter", 1, 0, 100))
+	assert.Equal(t, deviatedValueLength, valueLength("random", 1, 5, 100))
+}
+
+func TestConfigEstimate(t *testing.T) {
+	general := General{Step: 60, Value: 1, Probability: 100, start: 1700000000, stop: 1700000600}
+	c := Config{
+		General: general,
+		Const:   []string{"a.{1..3}"},
+		Custom: []Custom{
+			{Name: "b.{01..10}", Type: "counter", General: general},
+		},
+	}
+	c.Custom[0].Probability = 50
+	c.Custom[0].Deviation = 2
+
+	r, err := c.estimate(100)
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 2)
+
+	// 12 points per series including the one after stop, "a.1 1 1700000600\n" is 17 bytes
+	a := r.Groups[0]
+	assert.Equal(t, groupEstimate{
+		Name: "a.{1..3}", Type: "const", Series: 3, PointsPerSeries: 12, Points: 36, Bytes: a.Bytes, OnlineRate: 0.05,
+	}, a)
+	assert.Equal(t, uint64(3*12*17), a.Bytes["carbon"])
+	// the file with the default 60:1440 retentions
+	assert.Equal(t, uint64(3*(16+12+1440*12)), a.Bytes["whisper"])
+	// "a.1\t1\t1700000600\t2023-11-14\t1700000000\n" is 39 bytes
+	assert.Equal(t, uint64(3*12*39), a.Bytes["clickhouse-tsv"])
+	assert.Equal(t, uint64(3*12*(1+3+18)), a.Bytes["clickhouse-rowbinary"])
+	for _, compress := range []string{"gzip", "zstd"} {
+		assert.NotZero(t, a.Bytes[compress], compress)
+		assert.Less(t, a.Bytes[compress], a.Bytes["carbon"], compress)
+	}
+	// "b.01 " + 18 chars of value + " 1700000600\n" is 35 bytes, a half is dropped
+	b := r.Groups[1]
+	assert.Equal(t, groupEstimate{
+		Name: "b.{01..10}", Type: "counter", Series: 10, PointsPerSeries: 12, Points: 60, Bytes: b.Bytes,
+		OnlineRate: 10 * 0.5 / 60,
+	}, b)
+	assert.Equal(t, uint64(10*12*35/2), b.Bytes["carbon"])
+	assert.Equal(t, uint64(10*(16+12+1440*12)), b.Bytes["whisper"], "the whisper files don't depend on the probability")
+	assert.Len(t, b.Bytes, len(estimateFormats))
+	assert.Equal(t, uint64(13), r.Series)
+	assert.Equal(t, uint64(96), r.Points)
+	assert.Equal(t, uint64(3*12*17+10*12*35/2), r.Bytes["carbon"])
+	assert.Equal(t, a.Bytes["gzip"]+b.Bytes["gzip"], r.Bytes["gzip"])
+	assert.InDelta(t, 0.96, r.Duration, 1e-9)
+
+	// "c 1 1700000000.500\n" is 19 bytes, 1202 points including the one after stop
+	c.Custom = append(c.Custom, Custom{Name: "c", Type: "const", General: general})
+	c.Custom[1].Interval = "500ms"
+	r, err = c.estimate(100)
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 3)
+	assert.Equal(t, groupEstimate{
+		Name: "c", Type: "const", Series: 1, PointsPerSeries: 1202, Points: 1202, Bytes: r.Groups[2].Bytes, OnlineRate: 2,
+	}, r.Groups[2])
+	assert.Equal(t, uint64(1202*19), r.Groups[2].Bytes["carbon"])
+	// clickhouse truncates milliseconds
+	assert.Equal(t, uint64(1202*(1+1+10+10+10+5)), r.Groups[2].Bytes["clickhouse-tsv"])
+
+	// the retentions of the whisper output
+	c.Carbon = "whisper://" + t.TempDir() + "?retentions=10s:1h,1m:1d"
+	r, err = c.estimate(0)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(16+2*12+(360+1440)*12), r.Groups[2].Bytes["whisper"])
+	c.Carbon = "whisper://storage?retentions=1m"
+	_, err = c.estimate(0)
+	assert.ErrorContains(t, err, "invalid whisper output")
+	c.Carbon = ""
+
+	c.Custom[1].Interval = "invalid"
+	_, err = c.estimate(0)
+	assert.ErrorContains(t, err, "interval")
+
+	c.Custom[0].Type = "unknown"
+	_, err = c.estimate(0)
+	assert.ErrorIs(t, err, generator.ErrWrongType)
+}
+
+func TestEstimateReportWrite(t *testing.T) {
+	general := General{Step: 60, Value: 1, Probability: 100, start: 1700000000, stop: 1700000600}
+	c := Config{General: general, Random: []string{"r.{1..2}"}}
+	r, err := c.estimate(10)
+	require.NoError(t, err)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, r.write(buf, "text"))
+	assert.Contains(t, buf.String(), "carbon bytes")
+	assert.Contains(t, buf.String(), "clickhouse-rowbinary bytes")
+	assert.Contains(t, buf.String(), "expected time at 10 points/s: 2s\n")
+
+	buf.Reset()
+	require.NoError(t, r.write(buf, "json"))
+	decoded := estimateReport{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, r, decoded)
+}
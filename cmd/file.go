@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// fileGroupPlaceholder in the file template is replaced by the group name
+const fileGroupPlaceholder = "{group}"
+
+// fileDefaultGroup is the group name for writes outside of generators groups, e.g. the own statistic
+const fileDefaultGroup = "default"
+
+// fileWriter writes carbon plain-text lines to files by the template. The template is expanded with strftime-like
+// verbs by the current time, and with the group name for '{group}'. The files are rotated when the expanded name
+// changes, by size and by interval. Each group writes only complete lines, so lines aren't mixed between groups
+// writing to the same file.
+type fileWriter struct {
+	template string
+	size     int64
+	interval time.Duration
+	compress string
+	now      func() time.Time
+
+	mu     sync.Mutex
+	files  map[string]*rotatingFile
+	groups []*fileGroupWriter
+	main   *fileGroupWriter
+}
+
+// newFileWriter returns the writer for 'file:///path/out-%Y%m%d-{group}.txt?rotate-size=1GB&rotate-interval=1h&compress=zstd'.
+// The path is relative for 'file://path' and absolute for 'file:///path'. It isn't parsed as URL, because the
+// template verbs aren't valid URL escapes.
+func newFileWriter(address string) (*fileWriter, error) {
+	template, query, _ := strings.Cut(strings.TrimPrefix(address, "file://"), "?")
+	if template == "" {
+		return nil, fmt.Errorf("the file template is empty in %s", address)
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	w := &fileWriter{template: template, compress: q.Get("compress"), now: time.Now, files: make(map[string]*rotatingFile)}
+	if v := q.Get("rotate-size"); v != "" {
+		size, err := parseSize(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rotate-size: %w", err)
+		}
+		w.size = size
+	}
+	if v := q.Get("rotate-interval"); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("rotate-interval %q must be a positive duration", v)
+		}
+		w.interval = interval
+	}
+	switch w.compress {
+	case "", "gzip", "zstd":
+	default:
+		return nil, fmt.Errorf("compress %s is not in [gzip zstd]", w.compress)
+	}
+	w.main = w.addGroup(fileDefaultGroup)
+	return w, nil
+}
+
+// parseSize parses the size in bytes with the optional suffix K, M, G or T, and optional 'B', e.g. '512MB'
+func parseSize(s string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	multiplier := int64(1)
+	for i, unit := range "KMGT" {
+		if strings.HasSuffix(number, string(unit)) {
+			number = strings.TrimSuffix(number, string(unit))
+			multiplier = 1 << (10 * (i + 1))
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("size %q must be a positive number with the optional K, M, G or T suffix", s)
+	}
+	return n * multiplier, nil
+}
+
+// expandFileTemplate replaces '{group}' by the group name and strftime-like verbs %Y, %m, %d, %H, %M, %S and %% by
+// the time. The group name is sanitized to be a single path element.
+func expandFileTemplate(template, group string, t time.Time) string {
+	group = strings.Map(func(r rune) rune {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, group)
+	template = strings.ReplaceAll(template, fileGroupPlaceholder, group)
+	if !strings.Contains(template, "%") {
+		return template
+	}
+	b := make([]byte, 0, len(template)+8)
+	for i := 0; i < len(template); i++ {
+		if template[i] != '%' || i+1 == len(template) {
+			b = append(b, template[i])
+			continue
+		}
+		i++
+		switch template[i] {
+		case 'Y':
+			b = t.AppendFormat(b, "2006")
+		case 'm':
+			b = t.AppendFormat(b, "01")
+		case 'd':
+			b = t.AppendFormat(b, "02")
+		case 'H':
+			b = t.AppendFormat(b, "15")
+		case 'M':
+			b = t.AppendFormat(b, "04")
+		case 'S':
+			b = t.AppendFormat(b, "05")
+		case '%':
+			b = append(b, '%')
+		default:
+			b = append(b, '%', template[i])
+		}
+	}
+	return string(b)
+}
+
+// Write writes complete lines to the file of the default group
+func (w *fileWriter) Write(p []byte) (int, error) {
+	return w.main.Write(p)
+}
+
+// group returns the writer for the generators group. Groups write to the same file unless the template contains
+// '{group}'.
+func (w *fileWriter) group(name string) io.Writer {
+	return w.addGroup(name)
+}
+
+func (w *fileWriter) addGroup(name string) *fileGroupWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	key := fileDefaultGroup
+	if strings.Contains(w.template, fileGroupPlaceholder) {
+		key = name
+	}
+	f, ok := w.files[key]
+	if !ok {
+		f = &rotatingFile{w: w, group: name}
+		w.files[key] = f
+	}
+	gw := &fileGroupWriter{file: f}
+	w.groups = append(w.groups, gw)
+	return gw
+}
+
+// Close writes incomplete lines of all groups, and closes files
+func (w *fileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var errs []error
+	for _, gw := range w.groups {
+		errs = append(errs, gw.flush())
+	}
+	for _, f := range w.files {
+		errs = append(errs, f.close())
+	}
+	return errors.Join(errs...)
+}
+
+// fileGroupWriter passes only complete lines to the file, so concurrent groups don't break lines of each other
+type fileGroupWriter struct {
+	mu    sync.Mutex
+	lines lineBuffer
+	file  *rotatingFile
+	chunk []byte
+}
+
+func (gw *fileGroupWriter) Write(p []byte) (int, error) {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	gw.chunk = gw.chunk[:0]
+	gw.lines.lines(p, func(line []byte) error {
+		gw.chunk = append(append(gw.chunk, line...), '\n')
+		return nil
+	})
+	if len(gw.chunk) == 0 {
+		return len(p), nil
+	}
+	if err := gw.file.write(gw.chunk); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush writes the incomplete line with the newline
+func (gw *fileGroupWriter) flush() error {
+	gw.mu.Lock()
+	defer gw.mu.Unlock()
+	return gw.lines.rest(func(line []byte) error {
+		return gw.file.write(append(line, '\n'))
+	})
+}
+
+// rotatingFile is the currently opened file of the template, it's reopened on rotation
+type rotatingFile struct {
+	w     *fileWriter
+	group string
+
+	mu       sync.Mutex
+	name     string
+	opened   time.Time
+	written  int64
+	file     *os.File
+	buffer   *bufio.Writer
+	compress io.WriteCloser
+	out      io.Writer
+}
+
+func (f *rotatingFile) write(p []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.w.now()
+	name := expandFileTemplate(f.w.template, f.group, now)
+	if f.file == nil || name != f.name || (f.w.size != 0 && f.written >= f.w.size) ||
+		(f.w.interval != 0 && !now.Before(f.opened.Truncate(f.w.interval).Add(f.w.interval))) {
+		if err := f.rotate(name, now); err != nil {
+			return err
+		}
+	}
+	n, err := f.out.Write(p)
+	f.written += int64(n)
+	return err
+}
+
+// rotate closes the current file and opens the new one. The existing files aren't overwritten, the name gets the
+// next free '.N' suffix instead.
+func (f *rotatingFile) rotate(name string, now time.Time) error {
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	ext := ""
+	switch f.w.compress {
+	case "gzip":
+		ext = ".gz"
+	case "zstd":
+		ext = ".zst"
+	}
+	var file *os.File
+	for i := 0; file == nil; i++ {
+		path := name + ext
+		if i != 0 {
+			path = name + "." + strconv.Itoa(i) + ext
+		}
+		var err error
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+	}
+	f.file, f.name, f.opened, f.written = file, name, now, 0
+	f.buffer = bufio.NewWriterSize(file, 1<<20)
+	f.out = f.buffer
+	compress, err := newCompressor(f.buffer, f.w.compress)
+	if err != nil {
+		return err
+	}
+	if compress != nil {
+		f.compress, f.out = compress, compress
+	}
+	logger.Info("output file is opened", "file", file.Name())
+	return nil
+}
+
+// newCompressor returns the gzip or zstd writer to w, and nil for the empty compress
+func newCompressor(w io.Writer, compress string) (io.WriteCloser, error) {
+	switch compress {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+	return nil, nil
+}
+
+func (f *rotatingFile) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	var errs []error
+	if f.compress != nil {
+		errs = append(errs, f.compress.Close())
+		f.compress = nil
+	}
+	errs = append(errs, f.buffer.Flush(), f.file.Close())
+	f.file = nil
+	return errors.Join(errs...)
+}
+
+func (f *rotatingFile) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closeFile()
+}
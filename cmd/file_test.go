@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestFileWriter(t *testing.T, template string) (*fileWriter, string) {
+	t.Helper()
+	dir := t.TempDir()
+	w, err := newFileWriter("file://" + filepath.Join(dir, template))
+	require.NoError(t, err)
+	return w, dir
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func TestExpandFileTemplate(t *testing.T) {
+	ts := time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	assert.Equal(t, "/data/out-20240203-040506-100%-%x.txt", expandFileTemplate("/data/out-%Y%m%d-%H%M%S-100%%-%x.txt", "", ts))
+	assert.Equal(t, "/data/a.b_1..3_/x%", expandFileTemplate("/data/{group}/x%", "a.b{1..3}", ts))
+}
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{"100": 100, "2k": 2048, "512MB": 512 << 20, "1G": 1 << 30, "1TB": 1 << 40} {
+		size, err := parseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, size, s)
+	}
+	for _, s := range []string{"", "0", "-1", "1X", "MB"} {
+		_, err := parseSize(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestNewFileWriter(t *testing.T) {
+	for _, bad := range []string{"file://", "file:///tmp/x?rotate-size=1X", "file:///tmp/x?rotate-interval=1", "file:///tmp/x?compress=lz4", "file:///tmp/x?%x"} {
+		_, err := newFileWriter(bad)
+		assert.Error(t, err, bad)
+	}
+	c := Config{Carbon: "file://" + t.TempDir() + "/out-%Y%m%d.txt?compress=gzip"}
+	w, err := c.GetCarbonWriter()
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", w.(*fileWriter).compress)
+	require.NoError(t, closeWriter(w))
+}
+
+func TestFileWriterRotation(t *testing.T) {
+	w, dir := newTestFileWriter(t, "%H%M/out.txt?rotate-size=10&rotate-interval=1h")
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	w.now = func() time.Time { return now }
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "1000"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1000", "out.txt"), []byte("existing\n"), 0o644))
+
+	write := func(s string) {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+	}
+	write("a 1 1\nb 2 2\n") // 1000/out.txt.1, 12 bytes
+	write("c 3 3\n")        // 1000/out.txt.2 by size
+	now = now.Add(time.Minute)
+	write("d 4 4\n") // 1001/out.txt by the name
+	w.template = filepath.Join(dir, "out.txt")
+	write("e 5 5\n") // out.txt by the name
+	now = now.Add(59 * time.Minute)
+	write("f 6 ") // the incomplete line is written on the next write
+	write("6\ng") // out.txt.1 by interval, the last line is written on close
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"1000/out.txt", "1000/out.txt.1", "1000/out.txt.2", "1001/out.txt", "out.txt", "out.txt.1"}, listFiles(t, dir))
+	for file, content := range map[string]string{
+		"1000/out.txt": "existing\n", "1000/out.txt.1": "a 1 1\nb 2 2\n", "1000/out.txt.2": "c 3 3\n",
+		"1001/out.txt": "d 4 4\n", "out.txt": "e 5 5\n", "out.txt.1": "f 6 6\ng\n",
+	} {
+		assert.Equal(t, content, readFile(t, filepath.Join(dir, file)), file)
+	}
+}
+
+func TestFileWriterCompression(t *testing.T) {
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for compress, ext := range map[string]string{"gzip": ".gz", "zstd": ".zst"} {
+		w, dir := newTestFileWriter(t, "out.txt?compress="+compress)
+		_, err := w.Write([]byte("a 1 1\nb 2 2\n"))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		f, err := os.Open(filepath.Join(dir, "out.txt"+ext))
+		require.NoError(t, err)
+		r, err := readers[compress](f)
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		f.Close()
+		assert.Equal(t, "a 1 1\nb 2 2\n", string(data), compress)
+	}
+}
+
+func TestFileWriterGroups(t *testing.T) {
+	w, dir := newTestFileWriter(t, "{group}.txt")
+	lw := newLimitWriter(w, limits{MaxPoints: 3}, func(error) {})
+	a := lw.group("a.{1..2}")
+	b := lw.group("b")
+	_, err := a.Write([]byte("a.1 1 1\na.2 1 1\n"))
+	require.NoError(t, err)
+	_, err = b.Write([]byte("b 1 1\nb 2 2\n"))
+	assert.ErrorIs(t, err, errLimitReached)
+	_, err = w.Write([]byte("stats 1 1\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []string{"a._1..2_.txt", "b.txt", "default.txt"}, listFiles(t, dir))
+	assert.Equal(t, "a.1 1 1\na.2 1 1\n", readFile(t, filepath.Join(dir, "a._1..2_.txt")))
+	assert.Equal(t, "b 1 1\n", readFile(t, filepath.Join(dir, "b.txt")))
+
+	plain := newLimitWriter(io.Discard, limits{}, nil)
+	assert.Equal(t, io.Writer(plain), plain.group("x"), "the output doesn't separate groups")
+}
+
+func TestFileWriterLineAtomicity(t *testing.T) {
+	w, dir := newTestFileWriter(t, "out.txt?rotate-size=1000")
+	s := newStats(w)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		gg, err := generator.NewExpand("const", fmt.Sprint("group", g), 1, 1, 1, false, 1, 0, 100)
+		require.NoError(t, err)
+		gw := s.addGroup(&gg, w)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				line := fmt.Sprintf("group%d.metric%d %d %d\n", g, i, i, i)
+				// the line is split between writes
+				for _, part := range []string{line[:5], line[5:]} {
+					_, err := gw.Write([]byte(part))
+					require.NoError(t, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, w.Close())
+	assert.Equal(t, uint64(8*200), s.report().Points)
+
+	var lines []string
+	for _, file := range listFiles(t, dir) {
+		content := readFile(t, filepath.Join(dir, file))
+		assert.True(t, strings.HasSuffix(content, "\n"), file)
+		lines = append(lines, strings.Split(strings.TrimSuffix(content, "\n"), "\n")...)
+	}
+	require.Len(t, lines, 8*200)
+	for _, line := range lines {
+		var g, i, v, ts int
+		_, err := fmt.Sscanf(line, "group%d.metric%d %d %d", &g, &i, &v, &ts)
+		require.NoError(t, err, line)
+		assert.Equal(t, i, v, line)
+	}
+}
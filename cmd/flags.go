@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"time"
+
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -8,15 +10,38 @@ import (
 func commonFlags(cmd *cobra.Command) {
 	f := cmd.Flags()
 	f.StringVarP(&cfgFile, "config", "c", "", "config file")
-	f.String("carbon", viper.GetString("carbon"), "carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port' or 'udp://server:port'")
+	f.String("carbon", viper.GetString("carbon"), "carbon-server address or '-' for STDOUT, should be set as '-', 'tcp://server:port', 'udp://server:port', 'file:///path/out-%Y%m%d-{group}.txt?rotate-size=1GB&rotate-interval=1h&compress=gzip', 'whisper://path/to/storage?retentions=60:1440&aggregation=average' or 'clickhouse://path/to/points.tsv?format=tsv&index=path&tagged=path'")
 	f.StringArray("const", []string{}, "constant generators")
 	f.StringArray("counter", []string{}, "counter generators")
 	f.StringArray("random", []string{}, "random generators")
+	f.StringArray("generator", []string{}, "generators of any type in 'type:name' format, e.g. 'counter:metric.{1..3}', the types registered by generator.Register are accepted as well")
 	f.Bool("randomize", viper.GetBool("randomize"), "toggle if starting point of generators should be randomized")
 	f.Float64("value", viper.GetFloat64("value"), "starting value for generators")
 	f.Float64("deviation", viper.GetFloat64("deviation"), "deviation for the next point in generator")
 	f.Uint8("probability", uint8(viper.GetUint("probability")), "probability of the points being sent, values in [1,100]")
 	f.Uint("step", viper.GetUint("step"), "generators interval in seconds")
+	f.Uint8("duplicates", uint8(viper.GetUint("duplicates")), "percent of points sent twice with the same timestamp and a different value")
+	f.Uint("shuffle", viper.GetUint("shuffle"), "window in seconds, inside which points are reordered, it should be bigger than the step")
+	f.Uint("clock-skew", viper.GetUint("clock-skew"), "maximal clock skew in seconds, each series has a constant skew in [-clock-skew,clock-skew]")
+	f.Int64("seed", viper.GetInt64("seed"), "seed for reproducible values, randomized start and probability, 0 means random on each run")
+}
+
+// runFlags are flags for commands sending points to carbon
+func runFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&reportOpts.Format, "report-format", "text", "format of the summary report printed to STDERR at exit, 'text' or 'json'")
+	f.StringVar(&reportOpts.Prefix, "stats-prefix", "", "if set, the own statistic is sent to carbon under the prefix")
+	f.StringVar(&listenAddr, "listen", "", "address for HTTP server with prometheus /metrics endpoint, e.g. ':9100'")
+	f.StringVar(&checkpointPath, "checkpoint", "", "JSON file to save the state of generators at exit, and periodically in online modes")
+	f.StringVar(&resumePath, "resume", "", "JSON file saved by --checkpoint to continue the generation from, it may be the same file")
+}
+
+// onlineFlags are flags for commands generating points for the current time
+func onlineFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.BoolVar(&watchConfig, "watch", false, "reload the config file on changes, it's reloaded on SIGHUP as well")
+	f.DurationVar(&reportOpts.Interval, "stats-interval", time.Minute, "interval of rate reports in logs and of sending the own statistic to carbon with --stats-prefix")
+	f.DurationVar(&checkpointInterval, "checkpoint-interval", time.Minute, "interval of saving the state of generators with --checkpoint")
 }
 
 func bindCommonFlags(cmd *cobra.Command) {
@@ -25,8 +50,14 @@ func bindCommonFlags(cmd *cobra.Command) {
 	viper.BindPFlag("const", f.Lookup("const"))
 	viper.BindPFlag("counter", f.Lookup("counter"))
 	viper.BindPFlag("random", f.Lookup("random"))
+	viper.BindPFlag("generators", f.Lookup("generator"))
 	viper.BindPFlag("randomize", f.Lookup("randomize"))
 	viper.BindPFlag("value", f.Lookup("value"))
 	viper.BindPFlag("deviation", f.Lookup("deviation"))
+	viper.BindPFlag("probability", f.Lookup("probability"))
 	viper.BindPFlag("step", f.Lookup("step"))
+	viper.BindPFlag("duplicates", f.Lookup("duplicates"))
+	viper.BindPFlag("shuffle", f.Lookup("shuffle"))
+	viper.BindPFlag("clock-skew", f.Lookup("clock-skew"))
+	viper.BindPFlag("seed", f.Lookup("seed"))
 }
@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/go-graphite/carbonapi/date"
+)
+
+// errLimitReached is the cause of the context cancellation when one of the run limits is reached
+var errLimitReached = errors.New("limit is reached")
+
+// limits are the bounds for the run, zero values mean unlimited
+type limits struct {
+	Duration  string
+	MaxPoints uint64
+	MaxBytes  uint64
+}
+
+// deadline returns the time when the run must be stopped. The duration is parsed as the go duration first,
+// then as the graphite-web date. The zero time means there is no deadline.
+func (l *limits) deadline(now time.Time) (time.Time, error) {
+	if l.Duration == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(l.Duration); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("duration %s must be positive", l.Duration)
+		}
+		return now.Add(d), nil
+	}
+	ts := date.DateParamToEpoch(l.Duration, "", 0, nil)
+	if ts <= now.Unix() {
+		return time.Time{}, fmt.Errorf("unable to parse duration %s as the go duration or the graphite-web date in the future", l.Duration)
+	}
+	return time.Unix(ts, 0), nil
+}
+
+// limitWriter counts the points and bytes passing through it. The writes are serialized, and each write is
+// truncated to complete lines, so the output never exceeds the limits. When one of limits is reached, the
+// context is canceled with errLimitReached cause.
+type limitWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	maxPoints uint64
+	maxBytes  uint64
+	points    uint64
+	bytes     uint64
+	cancel    context.CancelCauseFunc
+}
+
+func newLimitWriter(w io.Writer, l limits, cancel context.CancelCauseFunc) *limitWriter {
+	return &limitWriter{w: w, maxPoints: l.MaxPoints, maxBytes: l.MaxBytes, cancel: cancel}
+}
+
+// Write writes complete lines from p until one of the limits is reached
+func (lw *limitWriter) Write(p []byte) (n int, err error) {
+	return lw.writeTo(lw.w, p)
+}
+
+func (lw *limitWriter) writeTo(w io.Writer, p []byte) (n int, err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	allowed := lw.allowed(p)
+	if 0 < allowed {
+		n, err = w.Write(p[:allowed])
+		lw.bytes += uint64(n)
+		lw.points += uint64(bytes.Count(p[:n], []byte{'\n'}))
+		if err != nil {
+			return n, err
+		}
+	}
+	if allowed < len(p) || lw.reached() {
+		lw.cancel(errLimitReached)
+	}
+	if allowed < len(p) {
+		return n, errLimitReached
+	}
+	return n, nil
+}
+
+// WritePoints writes the points to the underlying generator.PointWriter until one of the limits is reached
+func (lw *limitWriter) WritePoints(points []generator.Point) (int, error) {
+	return lw.writePointsTo(lw.w, points)
+}
+
+// writePointsTo is writeTo for points. The size of points in the output format is known after the write, so the
+// bytes limit is checked before it.
+func (lw *limitWriter) writePointsTo(w io.Writer, points []generator.Point) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	allowed := len(points)
+	if lw.maxPoints != 0 {
+		allowed = int(min(uint64(allowed), lw.maxPoints-min(lw.points, lw.maxPoints)))
+	}
+	if lw.maxBytes != 0 && lw.maxBytes <= lw.bytes {
+		allowed = 0
+	}
+	var n int64
+	if 0 < allowed {
+		var err error
+		n, err = generator.WritePoints(w, points[:allowed])
+		lw.bytes += uint64(n)
+		lw.points += uint64(allowed)
+		if err != nil {
+			return int(n), err
+		}
+	}
+	if allowed < len(points) || lw.reached() {
+		lw.cancel(errLimitReached)
+	}
+	if allowed < len(points) {
+		return int(n), errLimitReached
+	}
+	return int(n), nil
+}
+
+// allowed returns the length of the p prefix, which consists of complete lines and fits into limits
+func (lw *limitWriter) allowed(p []byte) int {
+	if lw.maxPoints == 0 && lw.maxBytes == 0 {
+		return len(p)
+	}
+	allowed, points := 0, lw.points
+	for allowed < len(p) {
+		next := len(p)
+		if i := bytes.IndexByte(p[allowed:], '\n'); i != -1 {
+			next = allowed + i + 1
+		}
+		if lw.maxPoints != 0 && lw.maxPoints <= points {
+			break
+		}
+		if lw.maxBytes != 0 && lw.maxBytes < lw.bytes+uint64(next) {
+			break
+		}
+		allowed, points = next, points+1
+	}
+	return allowed
+}
+
+func (lw *limitWriter) reached() bool {
+	return (lw.maxPoints != 0 && lw.maxPoints <= lw.points) || (lw.maxBytes != 0 && lw.maxBytes <= lw.bytes)
+}
+
+// Unwrap returns the underlying io.Writer
+func (lw *limitWriter) Unwrap() io.Writer {
+	return lw.w
+}
+
+// group returns the writer of the group sharing the limits, if the underlying output separates groups
+func (lw *limitWriter) group(name string) io.Writer {
+	if g, ok := lw.w.(groupOutput); ok {
+		return &limitGroupWriter{limits: lw, w: g.group(name)}
+	}
+	return lw
+}
+
+// limitGroupWriter writes to the group output of the underlying writer within the shared limits
+type limitGroupWriter struct {
+	limits *limitWriter
+	w      io.Writer
+}
+
+func (lg *limitGroupWriter) Write(p []byte) (int, error) {
+	return lg.limits.writeTo(lg.w, p)
+}
+
+// WritePoints writes the points to the group output within the shared limits
+func (lg *limitGroupWriter) WritePoints(points []generator.Point) (int, error) {
+	return lg.limits.writePointsTo(lg.w, points)
+}
+
+// Unwrap returns the underlying io.Writer
+func (lg *limitGroupWriter) Unwrap() io.Writer {
+	return lg.w
+}
+
+// Sent returns the amount of points and bytes written
+func (lw *limitWriter) Sent() (points, bytes uint64) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.points, lw.bytes
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsDeadline(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := limits{}
+	d, err := l.deadline(now)
+	assert.NoError(t, err)
+	assert.True(t, d.IsZero())
+
+	l.Duration = "1h30m"
+	d, err = l.deadline(now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Minute), d)
+
+	l.Duration = "-1m"
+	_, err = l.deadline(now)
+	assert.Error(t, err)
+
+	l.Duration = "1800000000"
+	d, err = l.deadline(now)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1800000000, 0), d)
+
+	l.Duration = "1600000000"
+	_, err = l.deadline(now)
+	assert.Error(t, err)
+
+	l.Duration = "invalid"
+	_, err = l.deadline(now)
+	assert.Error(t, err)
+}
+
+func TestLimitWriter(t *testing.T) {
+	lines := "metric.1 1 1\nmetric.2 2 2\nmetric.3 3 3\n"
+
+	// unlimited
+	ctx, cancel := context.WithCancelCause(context.Background())
+	buf := &strings.Builder{}
+	lw := newLimitWriter(buf, limits{}, cancel)
+	n, err := lw.Write([]byte(lines))
+	assert.NoError(t, err)
+	assert.Equal(t, len(lines), n)
+	assert.NoError(t, ctx.Err())
+	points, bytes := lw.Sent()
+	assert.Equal(t, uint64(3), points)
+	assert.Equal(t, uint64(len(lines)), bytes)
+
+	// points
+	ctx, cancel = context.WithCancelCause(context.Background())
+	buf.Reset()
+	lw = newLimitWriter(buf, limits{MaxPoints: 4}, cancel)
+	_, err = lw.Write([]byte(lines))
+	assert.NoError(t, err)
+	assert.NoError(t, ctx.Err())
+	n, err = lw.Write([]byte(lines))
+	assert.ErrorIs(t, err, errLimitReached)
+	assert.Equal(t, 13, n)
+	assert.ErrorIs(t, context.Cause(ctx), errLimitReached)
+	assert.Equal(t, lines+"metric.1 1 1\n", buf.String())
+	n, err = lw.Write([]byte(lines))
+	assert.ErrorIs(t, err, errLimitReached)
+	assert.Zero(t, n)
+
+	// bytes, the exact limit cancels the context without error
+	ctx, cancel = context.WithCancelCause(context.Background())
+	buf.Reset()
+	lw = newLimitWriter(buf, limits{MaxBytes: 26}, cancel)
+	n, err = lw.Write([]byte(lines[:26]))
+	assert.NoError(t, err)
+	assert.Equal(t, 26, n)
+	assert.ErrorIs(t, context.Cause(ctx), errLimitReached)
+
+	// bytes, the line is never cut
+	ctx, cancel = context.WithCancelCause(context.Background())
+	buf.Reset()
+	lw = newLimitWriter(buf, limits{MaxBytes: 30}, cancel)
+	n, err = lw.Write([]byte(lines))
+	assert.ErrorIs(t, err, errLimitReached)
+	assert.Equal(t, 26, n)
+	assert.Equal(t, lines[:26], buf.String())
+	assert.ErrorIs(t, context.Cause(ctx), errLimitReached)
+}
+
+// pointsOutput is the output storing points as is, each point is 10 bytes in its format
+type pointsOutput struct {
+	strings.Builder
+	points []generator.Point
+}
+
+func (o *pointsOutput) WritePoints(points []generator.Point) (int, error) {
+	o.points = append(o.points, points...)
+	return 10 * len(points), nil
+}
+
+func TestLimitWriterPoints(t *testing.T) {
+	points := []generator.Point{generator.NewPoint("metric.1", 1, 1), generator.NewPoint("metric.2", 2, 2), generator.NewPoint("metric.3", 3, 3)}
+
+	// points
+	ctx, cancel := context.WithCancelCause(context.Background())
+	out := &pointsOutput{}
+	lw := newLimitWriter(out, limits{MaxPoints: 4}, cancel)
+	n, err := generator.WritePoints(lw, points)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), n)
+	assert.NoError(t, ctx.Err())
+	n, err = generator.WritePoints(lw, points)
+	assert.ErrorIs(t, err, errLimitReached)
+	assert.Equal(t, int64(10), n)
+	assert.ErrorIs(t, context.Cause(ctx), errLimitReached)
+	assert.Len(t, out.points, 4)
+	assert.Empty(t, out.String(), "points aren't written as carbon plain-text")
+
+	// bytes are known after the write, the next write is refused
+	ctx, cancel = context.WithCancelCause(context.Background())
+	out = &pointsOutput{}
+	lw = newLimitWriter(out, limits{MaxBytes: 20}, cancel)
+	_, err = generator.WritePoints(lw, points)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, context.Cause(ctx), errLimitReached)
+	n, err = generator.WritePoints(lw, points)
+	assert.ErrorIs(t, err, errLimitReached)
+	assert.Zero(t, n)
+	sent, bytes := lw.Sent()
+	assert.Equal(t, uint64(3), sent)
+	assert.Equal(t, uint64(30), bytes)
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/Felixoid/braxpansion"
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Prints expanded metric names with the generator type and parameters",
+	Long: `Expands every name without creating generators and prints
+them with the generator type and parameters.
+
+The --format flag accepts:
+  flat  the tab separated name, type and parameters per line
+  tree  the names split by dots into the indented nodes tree
+  index the JSON array of sorted unique names like graphite-web
+        /metrics/index.json
+  json  the list of objects with the name, group, type and parameters`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		bindCommonFlags(cmd)
+		f := cmd.Flags()
+		viper.BindPFlag("from", f.Lookup("from"))
+		viper.BindPFlag("until", f.Lookup("until"))
+
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
+	},
+	RunE: listing,
+}
+
+var listFormat string
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+
+	f := listCmd.Flags()
+	f.SortFlags = false
+
+	commonFlags(listCmd)
+	f.String("from", viper.GetString("from"), "starting point for generators in graphtie-web format")
+	f.String("until", viper.GetString("until"), "final point for generators in graphtie-web format")
+	f.StringVar(&listFormat, "format", "flat", "output format, 'flat', 'tree', 'index' or 'json'")
+}
+
+// listEntry is a single expanded name with the parameters of its group
+type listEntry struct {
+	Group string `json:"group"`
+	Custom
+}
+
+// params returns the parameters of the entry in key=value form
+func (e *listEntry) params() string {
+	return fmt.Sprintf("from=%s until=%s step=%d randomize=%t value=%g deviation=%g probability=%d",
+		e.From, e.Until, e.Step, e.Randomize, e.Value, e.Deviation, e.Probability)
+}
+
+// list returns the entries for every expanded name in the order of generators creation
+func (c *Config) list() ([]listEntry, error) {
+	var entries []listEntry
+	for _, custom := range c.Customs() {
+		if _, err := generator.GetType(custom.Type); err != nil {
+			return nil, fmt.Errorf("unable to list %s generators for %s: %w", custom.Type, custom.Name, err)
+		}
+		names := braxpansion.ExpandString(custom.Name)
+		if len(names) == 0 {
+			return nil, fmt.Errorf("unable to list %s generators for %s: %w", custom.Type, custom.Name, generator.ErrEmptyGens)
+		}
+		for _, name := range names {
+			entry := listEntry{Group: custom.Name, Custom: custom}
+			entry.Name = name
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// listNode is a node of the names tree. The node is a leaf when it has entries, and a branch when it has children.
+// The node can be both at once.
+type listNode struct {
+	children map[string]*listNode
+	entries  []*listEntry
+}
+
+func newListTree(entries []listEntry) *listNode {
+	root := &listNode{}
+	for i := range entries {
+		node := root
+		for _, part := range strings.Split(entries[i].Name, ".") {
+			if node.children == nil {
+				node.children = make(map[string]*listNode)
+			}
+			child, ok := node.children[part]
+			if !ok {
+				child = &listNode{}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.entries = append(node.entries, &entries[i])
+	}
+	return root
+}
+
+// write writes the children of the node sorted by name and indented by the depth
+func (n *listNode) write(w io.Writer, depth int) error {
+	names := make([]string, 0, len(n.children))
+	for name := range n.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	indent := strings.Repeat("  ", depth)
+	for _, name := range names {
+		child := n.children[name]
+		for _, e := range child.entries {
+			if _, err := fmt.Fprintf(w, "%s%s [%s %s]\n", indent, name, e.Type, e.params()); err != nil {
+				return err
+			}
+		}
+		if len(child.children) == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s%s.\n", indent, name); err != nil {
+			return err
+		}
+		if err := child.write(w, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listIndex returns the sorted unique names of leaves, the same as graphite-web /metrics/index.json
+func listIndex(entries []listEntry) []string {
+	names := make([]string, 0, len(entries))
+	for i := range entries {
+		names = append(names, entries[i].Name)
+	}
+	sort.Strings(names)
+	return slices.Compact(names)
+}
+
+func writeList(w io.Writer, entries []listEntry, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "tree":
+		return newListTree(entries).write(w, 0)
+	case "index":
+		return json.NewEncoder(w).Encode(listIndex(entries))
+	}
+	for i := range entries {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", entries[i].Name, entries[i].Type, entries[i].params()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func listing(cmd *cobra.Command, args []string) error {
+	if !slices.Contains([]string{"flat", "tree", "index", "json"}, listFormat) {
+		return fmt.Errorf("format %s is not in [flat tree index json]", listFormat)
+	}
+	entries, err := config.list()
+	if err != nil {
+		return err
+	}
+	return writeList(cmd.OutOrStdout(), entries, listFormat)
+}
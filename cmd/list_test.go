@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigList(t *testing.T) {
+	general := General{From: "-1h", Until: "now", Step: 60, Value: 1, Probability: 100}
+	c := Config{
+		General: general,
+		Const:   []string{"a.{1..2}"},
+		Custom:  []Custom{{Name: "a.b.{x,y}", Type: "counter", General: general}},
+	}
+	c.Custom[0].Step = 10
+	entries, err := c.list()
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "a.2", entries[1].Name)
+	assert.Equal(t, "a.{1..2}", entries[1].Group)
+	assert.Equal(t, "const", entries[1].Type)
+	assert.Equal(t, "a.b.y", entries[3].Name)
+	assert.Equal(t, uint(10), entries[3].Step)
+
+	c.Custom[0].Type = "unknown"
+	_, err = c.list()
+	assert.ErrorIs(t, err, generator.ErrWrongType)
+}
+
+func TestWriteList(t *testing.T) {
+	general := General{From: "-1h", Until: "now", Step: 60, Value: 1, Probability: 100}
+	c := Config{General: general, Const: []string{"a.{2,1}", "a.b.c"}, Counter: []string{"a"}}
+	entries, err := c.list()
+	require.NoError(t, err)
+	params := "from=-1h until=now step=60 randomize=false value=1 deviation=0 probability=100"
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, writeList(buf, entries, "flat"))
+	assert.Equal(t, "a.2\tconst\t"+params+"\n"+
+		"a.1\tconst\t"+params+"\n"+
+		"a.b.c\tconst\t"+params+"\n"+
+		"a\tcounter\t"+params+"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeList(buf, entries, "tree"))
+	assert.Equal(t, "a [counter "+params+"]\n"+
+		"a.\n"+
+		"  1 [const "+params+"]\n"+
+		"  2 [const "+params+"]\n"+
+		"  b.\n"+
+		"    c [const "+params+"]\n", buf.String())
+
+	buf.Reset()
+	// the same name of another group is listed once
+	require.NoError(t, writeList(buf, append(entries, entries[0]), "index"))
+	assert.Equal(t, `["a","a.1","a.2","a.b.c"]`+"\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeList(buf, entries, "json"))
+	decoded := []listEntry{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, entries, decoded)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// logOptions define the application logging
+type logOptions struct {
+	Level  string
+	Format string
+}
+
+var (
+	logOpts logOptions
+	logger  = slog.Default()
+)
+
+// newLogger returns the *slog.Logger writing to w with the level and format from options
+func (o *logOptions) newLogger(w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(o.Level)); err != nil {
+		return nil, fmt.Errorf("log level %s is not valid: %w", o.Level, err)
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(o.Format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, handlerOpts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, handlerOpts)), nil
+	}
+	return nil, fmt.Errorf("log format %s is not in [text json]", o.Format)
+}
+
+// setupLogging configures the logger for the application
+func setupLogging(cmd *cobra.Command, args []string) error {
+	l, err := logOpts.newLogger(cmd.ErrOrStderr())
+	if err != nil {
+		return err
+	}
+	logger = l
+	return nil
+}
+
+// generatorLogger returns the logger for messages of the generator package, it's set to the specs by WithLogger
+func generatorLogger() *slog.Logger {
+	return logger.With("package", "generator")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogOptionsNewLogger(t *testing.T) {
+	buf := &strings.Builder{}
+	o := logOptions{Level: "warn", Format: "json"}
+	l, err := o.newLogger(buf)
+	require.NoError(t, err)
+	l.Info("skipped")
+	l.Warn("logged", "group", "metric.{1..3}")
+	record := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(buf.String()), &record))
+	assert.Equal(t, "logged", record["msg"])
+	assert.Equal(t, "metric.{1..3}", record["group"])
+
+	buf.Reset()
+	o = logOptions{Level: "DEBUG", Format: "text"}
+	l, err = o.newLogger(buf)
+	require.NoError(t, err)
+	l.Debug("logged", "destination", "tcp://carbon:2003")
+	assert.Contains(t, buf.String(), "level=DEBUG msg=logged destination=tcp://carbon:2003")
+
+	o = logOptions{Level: "invalid", Format: "text"}
+	_, err = o.newLogger(buf)
+	assert.Error(t, err)
+
+	o = logOptions{Level: "info", Format: "yaml"}
+	_, err = o.newLogger(buf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	pointsDesc = prometheus.NewDesc("coal_mine_points_sent_total",
+		"Amount of points sent to the carbon destination", []string{"group", "type", "id"}, nil)
+	bytesDesc = prometheus.NewDesc("coal_mine_bytes_sent_total",
+		"Amount of bytes sent to the carbon destination", []string{"group", "type", "id"}, nil)
+	droppedDesc = prometheus.NewDesc("coal_mine_points_dropped_total",
+		"Amount of points dropped by probability", []string{"group", "type", "id"}, nil)
+	errorsDesc = prometheus.NewDesc("coal_mine_write_errors_total",
+		"Amount of failed writes", []string{"group", "type", "id"}, nil)
+	seriesDesc = prometheus.NewDesc("coal_mine_generators",
+		"Amount of generators in the group", []string{"group", "type", "id"}, nil)
+	activeDesc = prometheus.NewDesc("coal_mine_active_generators",
+		"Amount of generators producing points at the moment", []string{"group", "type", "id"}, nil)
+	queueDesc = prometheus.NewDesc("coal_mine_write_queue_depth",
+		"Amount of writes waiting for the carbon destination", nil, nil)
+	connectedDesc = prometheus.NewDesc("coal_mine_connection_up",
+		"Whether the connection to the carbon destination is established", []string{"destination"}, nil)
+	reconnectsDesc = prometheus.NewDesc("coal_mine_reconnects_total",
+		"Amount of reconnects to the carbon destination", []string{"destination"}, nil)
+)
+
+// statsCollector exports stats in prometheus format
+type statsCollector struct {
+	stats *stats
+}
+
+// Describe implements prometheus.Collector. The collector is unchecked, since groups are added during the run.
+func (sc statsCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector
+func (sc statsCollector) Collect(ch chan<- prometheus.Metric) {
+	s := sc.stats
+	ch <- prometheus.MustNewConstMetric(queueDesc, prometheus.GaugeValue, float64(s.queue.Load()))
+	if s.conn != nil {
+		connected := 0.
+		if s.conn.Connected() {
+			connected = 1
+		}
+		ch <- prometheus.MustNewConstMetric(connectedDesc, prometheus.GaugeValue, connected, s.conn.Destination())
+		ch <- prometheus.MustNewConstMetric(reconnectsDesc, prometheus.CounterValue, float64(s.conn.Reconnects()), s.conn.Destination())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, gs := range s.groups {
+		ch <- prometheus.MustNewConstMetric(pointsDesc, prometheus.CounterValue, float64(gs.points.Load()), gs.name, gs.typeName, gs.label())
+		ch <- prometheus.MustNewConstMetric(bytesDesc, prometheus.CounterValue, float64(gs.bytes.Load()), gs.name, gs.typeName, gs.label())
+		ch <- prometheus.MustNewConstMetric(droppedDesc, prometheus.CounterValue, float64(gs.dropped()), gs.name, gs.typeName, gs.label())
+		ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(gs.errors.Load()), gs.name, gs.typeName, gs.label())
+		ch <- prometheus.MustNewConstMetric(seriesDesc, prometheus.GaugeValue, float64(gs.series), gs.name, gs.typeName, gs.label())
+		ch <- prometheus.MustNewConstMetric(activeDesc, prometheus.GaugeValue, float64(gs.active.Load()), gs.name, gs.typeName, gs.label())
+		gs.latency.Collect(ch)
+	}
+}
+
+// newMetricsHandler returns the http.Handler serving the stats and go runtime metrics in prometheus format
+func newMetricsHandler(s *stats) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		statsCollector{s},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+var listenAddr string
+
+// serveMetrics starts the HTTP server with /metrics endpoint on the address. It's stopped when ctx is done.
+func serveMetrics(ctx context.Context, addr string, s *stats) error {
+	if addr == "" {
+		return nil
+	}
+	return serveHTTP(ctx, addr, newMetricsHandler(s))
+}
+
+// serveHTTP starts the HTTP server with the handler on the address. It's stopped when ctx is done.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	logger.Info("HTTP server is started", "listen", listener.Addr().String())
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server failed", "listen", addr, "error", err)
+		}
+	}()
+	return nil
+}
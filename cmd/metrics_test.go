@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeConn struct {
+	strings.Builder
+}
+
+func (c *fakeConn) Reconnects() uint64  { return 2 }
+func (c *fakeConn) Connected() bool     { return true }
+func (c *fakeConn) Destination() string { return "tcp://carbon:2003" }
+
+func TestMetricsHandler(t *testing.T) {
+	carbon := &fakeConn{}
+	s := newStats(carbon)
+	gg, err := generator.NewExpand("counter", "metric.{1..3}", 1, 1, 1, false, 1, 0, 100)
+	require.NoError(t, err)
+	w := s.addGroup(&gg, carbon)
+	_, err = gg.WriteAllTo(w)
+	require.NoError(t, err)
+	w.SetActive(0)
+	// the group with the same name and type is reported separately
+	same, err := generator.NewExpand("counter", "metric.{1..3}", 1, 1, 1, false, 1, 0, 100)
+	require.NoError(t, err)
+	_, err = same.WriteAllTo(s.addGroup(&same, carbon))
+	require.NoError(t, err)
+
+	server := httptest.NewServer(newMetricsHandler(s))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	for _, line := range []string{
+		`coal_mine_points_sent_total{group="metric.{1..3}",id="1",type="counter"} 6`,
+		`coal_mine_generators{group="metric.{1..3}",id="1",type="counter"} 3`,
+		`coal_mine_active_generators{group="metric.{1..3}",id="1",type="counter"} 0`,
+		`coal_mine_write_duration_seconds_count{group="metric.{1..3}",id="1",type="counter"} 2`,
+		`coal_mine_points_sent_total{group="metric.{1..3}",id="2",type="counter"} 6`,
+		`coal_mine_active_generators{group="metric.{1..3}",id="2",type="counter"} 3`,
+		`coal_mine_write_queue_depth 0`,
+		`coal_mine_connection_up{destination="tcp://carbon:2003"} 1`,
+		`coal_mine_reconnects_total{destination="tcp://carbon:2003"} 2`,
+	} {
+		assert.Contains(t, string(body), line+"\n")
+	}
+}
@@ -3,11 +3,9 @@ package cmd
 import (
 	"context"
 	"errors"
-	"fmt"
-	"sync"
+	"io"
 	"time"
 
-	"github.com/Felixoid/coal-mine/generator"
 	"github.com/spf13/cobra"
 )
 
@@ -20,12 +18,28 @@ var onlineCmd = &cobra.Command{
 the config, and generates points for the current second.
 
 It's highly recommended to use it with --randomize
-parameter to spread the generation over time.`,
-	PreRun: func(cmd *cobra.Command, args []string) {
+parameter to spread the generation over time.
+
+On SIGHUP the config is reloaded: new groups of generators
+are started, removed ones are stopped, and the changed
+parameters are applied from the next tick. Unchanged
+generators keep their state. With --watch the config
+file is reloaded on changes as well.
+
+The generation may be bounded with --duration, --max-points
+and --max-bytes flags. When any of them is reached, the
+command exits with a summary of sent data.
+
+With --checkpoint the state of generators is saved
+periodically, and with --resume the counters and random
+walks continue from the saved state after a restart.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
 		bindCommonFlags(cmd)
 
-		readConfig()
-		unmarshalConfig()
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
 	},
 	RunE: onlineGeneration,
 }
@@ -37,84 +51,111 @@ func init() {
 	f.SortFlags = false
 
 	commonFlags(onlineCmd)
+	runFlags(onlineCmd)
+	onlineFlags(onlineCmd)
+	f.StringVar(&onlineLimits.Duration, "duration", "", "stop generation after the go duration (e.g. 1h30m) or at the graphite-web date (e.g. 23:00_20231231)")
+	f.Uint64Var(&onlineLimits.MaxPoints, "max-points", 0, "stop generation after the amount of sent points, 0 is unlimited")
+	f.Uint64Var(&onlineLimits.MaxBytes, "max-bytes", 0, "stop generation after the amount of sent bytes, 0 is unlimited")
 }
 
-func onlineGeneration(cmd *cobra.Command, args []string) (asyncErr error) {
-	config.ResetStartStop()
+var onlineLimits limits
 
-	writer, err := config.GetCarbonWriter()
+func onlineGeneration(cmd *cobra.Command, args []string) error {
+	if err := reportOpts.check(); err != nil {
+		return err
+	}
+	deadline, err := onlineLimits.deadline(time.Now())
 	if err != nil {
 		return err
 	}
 
-	ggg, err := config.ToGenerators()
+	carbonWriter, err := config.GetCarbonWriter()
 	if err != nil {
 		return err
 	}
-	if len(ggg) == 0 {
+
+	customs := config.Customs()
+	if len(customs) == 0 {
 		return nil
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	errs := make(chan error, len(ggg))
-	_ = ctx
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	if !deadline.IsZero() {
+		var cancelDeadline context.CancelFunc
+		ctx, cancelDeadline = context.WithDeadlineCause(ctx, deadline, errLimitReached)
+		defer cancelDeadline()
+	}
+	writer := newLimitWriter(carbonWriter, onlineLimits, cancel)
+	runStats := newStats(carbonWriter)
+	if err := serveMetrics(ctx, listenAddr, runStats); err != nil {
+		return err
+	}
+
+	runReporter(ctx, runStats, carbonWriter)
 
-	go func() {
-		select {
-		case <-CatchedSignals:
-			// TODO: use zap logging and log signal
-			cancel()
-			asyncErr = nil
-		case err = <-errs:
-			// TODO: use zap logging and log error
-			cancel()
-			asyncErr = err
+	reg := newRegistry(ctx, cancel, writer, runStats)
+	if err := reg.resumeFrom(resumePath); err != nil {
+		return err
+	}
+	stopCheckpoints := runCheckpoints(ctx, reg, checkpointPath, checkpointInterval)
+	for _, custom := range customs {
+		if _, err := reg.add(custom); err != nil {
+			cancel(err)
+			break
 		}
-	}()
+	}
+	go handleSignals(ctx, cancel, reg)
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(ggg))
+	reg.wait()
+	stopCheckpoints()
 
-	write := func(gg generator.Generators) {
-		defer wg.Done()
-		tick := time.Second
-		if !gg.Randomized() {
-			tick = time.Duration(gg.Step()) * time.Second
-		}
-		ticker := time.NewTicker(tick)
-		for valid := gg; true; valid = getNextGenerators(gg) {
-			// TODO: log amount of sent metrics
+	return finishOnline(ctx, runStats, carbonWriter, cmd.ErrOrStderr())
+}
+
+// runReporter logs rate reports and sends the own stats to carbon each reportOpts.Interval until ctx is done
+func runReporter(ctx context.Context, s *stats, carbon io.Writer) {
+	if reportOpts.Interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(reportOpts.Interval)
+		defer ticker.Stop()
+		for {
 			select {
+			case <-ctx.Done():
+				return
 			case t := <-ticker.C:
-				ctxTimeout, cancel := context.WithTimeout(ctx, tick)
-				defer cancel()
-				n, err := valid.WriteAllToWithContext(ctxTimeout, writer)
-				if err != nil && !errors.Is(err, generator.ErrEmptyGens) {
-					errs <- fmt.Errorf("error while sending metrics, %d bytes sent: %w", n, err)
-					return
+				r := s.report()
+				logger.Info("rate report", "points", r.Points, "bytes", r.Bytes, "dropped", r.Dropped,
+					"errors", r.Errors, "reconnects", r.Reconnects, "rate", r.Rate)
+				if reportOpts.Prefix == "" {
+					continue
+				}
+				// the own stats are not limited and errors are not critical
+				if _, err := s.writeMetrics(carbon, reportOpts.Prefix, t.Unix()); err != nil {
+					logger.Warn("unable to send own stats", "error", err)
 				}
-				gg.SetStop(uint(t.Unix()))
 			}
 		}
-	}
-
-	for _, gg := range ggg {
-		go write(gg)
-	}
-
-	wg.Wait()
-
-	return
+	}()
 }
 
-func getNextGenerators(gg generator.Generators) generator.Generators {
-	gens := make([]generator.Generator, 0, len(gg.List()))
-	for _, g := range gg.List() {
-		if err := g.Next(); err == nil {
-			gens = append(gens, g)
-		}
+// finishOnline logs the reason of the finish, and reports the stats. The error cause of ctx is returned.
+func finishOnline(ctx context.Context, s *stats, carbon, w io.Writer) error {
+	var asyncErr error
+	reason := "interrupted"
+	switch cause := context.Cause(ctx); {
+	case errors.Is(cause, errLimitReached):
+		reason = cause.Error()
+	case cause != nil && !errors.Is(cause, context.Canceled):
+		reason = "failed"
+		asyncErr = cause
+	}
+	logger.Info("online generation is finished", "reason", reason)
+	if err := reportOpts.finish(s, carbon, w); err != nil && asyncErr == nil {
+		asyncErr = err
 	}
-	valid := generator.Generators{}
-	valid.SetList(gens)
-	return valid
+
+	return asyncErr
 }
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// lineBuffer splits written data into complete lines for file outputs, the incomplete line is kept until the next
+// write or the end
+type lineBuffer struct {
+	partial []byte
+}
+
+// lines calls fn for each complete line of p, and returns joined errors of fn
+func (b *lineBuffer) lines(p []byte, fn func([]byte) error) error {
+	data := p
+	if len(b.partial) != 0 {
+		data = append(b.partial, p...)
+		b.partial = nil
+	}
+	var errs []error
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			break
+		}
+		errs = append(errs, fn(data[:i]))
+		data = data[i+1:]
+	}
+	if len(data) != 0 {
+		b.partial = append([]byte(nil), data...)
+	}
+	return errors.Join(errs...)
+}
+
+// rest calls fn for the incomplete line if any
+func (b *lineBuffer) rest(fn func([]byte) error) error {
+	if len(b.partial) == 0 {
+		return nil
+	}
+	line := b.partial
+	b.partial = nil
+	return fn(line)
+}
+
+// errPointsOnly is returned by outputs, which accept only the points of generators as generator.PointWriter
+var errPointsOnly = errors.New("the carbon plain-text isn't accepted by the output")
+
+// groupOutput is implemented by outputs, which separate writes of generators groups
+type groupOutput interface {
+	group(name string) io.Writer
+}
+
+// closeWriter closes the output if it's io.Closer, e.g. to flush buffered points of file outputs. STDOUT is kept.
+func closeWriter(w io.Writer) error {
+	if c, ok := w.(io.Closer); ok && w != os.Stdout {
+		return c.Close()
+	}
+	return nil
+}
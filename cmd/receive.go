@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Felixoid/coal-mine/receiver"
+	"github.com/spf13/cobra"
+)
+
+// receiveCmd represents the receive command
+var receiveCmd = &cobra.Command{
+	Use:   "receive",
+	Short: "Receive metrics like carbon and report the statistic",
+	Long: `Listens on carbon plain-text (tcp, udp) and pickle
+addresses, and counts received points per series. Malformed
+lines, duplicated and out-of-order timestamps are detected.
+
+At exit, the statistic per series is printed to STDOUT.
+With --http the same statistic is served as JSON on /stats
+and /series during the run.
+
+Example:
+  coal-mine receive --listen tcp://:2003,udp://:2003,pickle://:2004`,
+	RunE: receive,
+}
+
+var receiveOpts struct {
+	listen     []string
+	http       string
+	format     string
+	keepPoints bool
+	duration   string
+}
+
+func init() {
+	rootCmd.AddCommand(receiveCmd)
+
+	f := receiveCmd.Flags()
+	f.SortFlags = false
+
+	f.StringSliceVar(&receiveOpts.listen, "listen", []string{"tcp://:2003"}, "comma separated addresses to receive points, 'tcp://host:port', 'udp://host:port' or 'pickle://host:port'")
+	f.StringVar(&receiveOpts.http, "http", "", "address for HTTP server with /stats and /series JSON endpoints, e.g. ':8080'")
+	f.StringVar(&receiveOpts.format, "format", "text", "format of the statistic printed at exit, 'text' or 'json'")
+	f.BoolVar(&receiveOpts.keepPoints, "keep-points", false, "keep all received points to detect duplicates of any timestamp, not only of the last one")
+	f.StringVar(&receiveOpts.duration, "duration", "", "stop receiving after the go duration (e.g. 1h30m) or at the graphite-web date (e.g. 23:00_20231231)")
+}
+
+// receiveReport is the statistic of the receiver with per series details
+type receiveReport struct {
+	receiver.Stats
+	Series map[string]receiver.Series `json:"series_stats"`
+}
+
+func newReceiveReport(r *receiver.Receiver) *receiveReport {
+	report := &receiveReport{Stats: r.Stats(), Series: make(map[string]receiver.Series)}
+	for _, path := range r.Paths() {
+		report.Series[path], _ = r.Series(path)
+	}
+	return report
+}
+
+func (r *receiveReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "series\tpoints\tfirst\tlast\tduplicates\tout of order\t")
+	paths := make([]string, 0, len(r.Series))
+	for path := range r.Series {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		s := r.Series[path]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t\n", path, s.Points, s.First, s.Last, s.Duplicates, s.OutOfOrder)
+	}
+	fmt.Fprintf(tw, "total %d\t%d\t\t\t%d\t%d\t\n", r.Stats.Series, r.Points, r.Duplicates, r.OutOfOrder)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "malformed: %d\n", r.Malformed); err != nil {
+		return err
+	}
+	for _, sample := range r.Samples {
+		if _, err := fmt.Fprintf(w, "  %q\n", sample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newReceiveHandler returns the HTTP handler with the receiver statistic
+func newReceiveHandler(r *receiver.Receiver) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, r.Stats())
+	})
+	mux.HandleFunc("/series", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			methodNotAllowed(w, req)
+			return
+		}
+		writeJSON(w, http.StatusOK, newReceiveReport(r).Series)
+	})
+	return mux
+}
+
+func receive(cmd *cobra.Command, args []string) error {
+	if receiveOpts.format != "text" && receiveOpts.format != "json" {
+		return fmt.Errorf("format %s is not in [text json]", receiveOpts.format)
+	}
+	if len(receiveOpts.listen) == 0 {
+		return fmt.Errorf("at least one --listen address is required")
+	}
+	deadline, err := (&limits{Duration: receiveOpts.duration}).deadline(time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	r := receiver.New(receiveOpts.keepPoints)
+	for _, address := range receiveOpts.listen {
+		addr, err := r.Listen(strings.TrimSpace(address))
+		if err != nil {
+			r.Close()
+			return fmt.Errorf("unable to listen on %s: %w", address, err)
+		}
+		logger.Info("receiver is started", "listen", address, "address", addr.String())
+	}
+	if receiveOpts.http != "" {
+		if err := serveHTTP(ctx, receiveOpts.http, newReceiveHandler(r)); err != nil {
+			r.Close()
+			return err
+		}
+	}
+
+	func() {
+		for {
+			select {
+			case sig := <-CatchedSignals:
+				if sig == syscall.SIGHUP {
+					logger.Info("signal is caught, ignored", "signal", sig)
+					continue
+				}
+				logger.Info("signal is caught, stopping", "signal", sig)
+				return
+			case <-ctx.Done():
+				logger.Info("receiving is finished", "reason", "limit is reached")
+				return
+			}
+		}
+	}()
+
+	if err := r.Close(); err != nil {
+		logger.Warn("unable to close the receiver", "error", err)
+	}
+	return newReceiveReport(r).write(cmd.OutOrStdout(), receiveOpts.format)
+}
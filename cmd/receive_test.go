@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/receiver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveReport(t *testing.T) {
+	r := receiver.New(false)
+	fmt.Fprint(r, "b.metric 1 60\nb.metric 2 60\na 1 120\na 1 60\nbroken\n")
+	report := newReceiveReport(r)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, report.write(buf, "text"))
+	expected := `    series  points  first  last  duplicates  out of order
+         a       2     60   120           0             1
+  b.metric       2     60    60           1             0
+   total 2       4                        1             1
+malformed: 1
+  "broken"
+`
+	assert.Equal(t, expected, buf.String())
+
+	buf.Reset()
+	require.NoError(t, report.write(buf, "json"))
+	decoded := &receiveReport{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), decoded))
+	assert.Equal(t, report, decoded)
+}
+
+func TestReceiveHandler(t *testing.T) {
+	r := receiver.New(false)
+	fmt.Fprint(r, "a 1 60\n")
+	server := httptest.NewServer(newReceiveHandler(r))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stats")
+	require.NoError(t, err)
+	stats := receiver.Stats{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	resp.Body.Close()
+	assert.Equal(t, receiver.Stats{Series: 1, Points: 1}, stats)
+
+	resp, err = http.Get(server.URL + "/series")
+	require.NoError(t, err)
+	series := map[string]receiver.Series{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&series))
+	resp.Body.Close()
+	assert.Equal(t, map[string]receiver.Series{"a": {Points: 1, First: 60, Last: 60}}, series)
+
+	resp, err = http.Post(server.URL+"/stats", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
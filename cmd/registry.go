@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+)
+
+// errGroupNotFound is returned when there is no running group with the requested ID
+var errGroupNotFound = errors.New("group is not found")
+
+// preciseTick is the minimal interval between writes of sub-second generators
+const preciseTick = 10 * time.Millisecond
+
+// errZeroStep is returned for groups with zero step
+var errZeroStep = errors.New("step must be positive")
+
+// registry keeps the groups of generators running in the online mode. Groups can be added, removed, paused and
+// tuned during the generation.
+type registry struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	writer io.Writer
+	stats  *stats
+	wg     sync.WaitGroup
+	mu     sync.Mutex
+	lastID int
+	groups map[int]*runningGroup
+	// resume keeps states of the checkpoint for groups, which are not added yet
+	resume resumeStates
+}
+
+// newRegistry returns the registry writing to w. The first write error cancels ctx with the error as the cause.
+func newRegistry(ctx context.Context, cancel context.CancelCauseFunc, w io.Writer, s *stats) *registry {
+	return &registry{
+		ctx:    ctx,
+		cancel: cancel,
+		writer: w,
+		stats:  s,
+		groups: make(map[int]*runningGroup),
+	}
+}
+
+// runningGroup is the group of generators, which points are written each tick
+type runningGroup struct {
+	id     int
+	mu     sync.Mutex
+	custom Custom
+	gg     generator.Generators
+	writer *groupWriter
+	first  bool
+	paused atomic.Bool
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// groupInfo is the representation of the runningGroup in API
+type groupInfo struct {
+	ID int `json:"id"`
+	Custom
+	Paused     bool `json:"paused"`
+	Generators int  `json:"generators"`
+}
+
+// add creates generators for the custom starting from the current time and runs them
+func (r *registry) add(custom Custom) (*runningGroup, error) {
+	if custom.Step == 0 && custom.Interval == "" && custom.Retentions == "" {
+		return nil, fmt.Errorf("%w: %s", errZeroStep, custom.Name)
+	}
+	if checkpointPath != "" || resumePath != "" {
+		if err := custom.checkCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	custom.resetStartStop(time.Now().Unix())
+	gg, err := custom.ToGenerators()
+	if err != nil {
+		return nil, fmt.Errorf("unable to create new %s generators for %s: %w", custom.Type, custom.Name, err)
+	}
+	r.mu.Lock()
+	states, resumed := r.resume.take(custom.key())
+	r.mu.Unlock()
+	if resumed {
+		restored, err := resumeOnline(&gg, states, custom.start)
+		if err != nil {
+			return nil, fmt.Errorf("unable to resume %s generators for %s: %w", custom.Type, custom.Name, err)
+		}
+		resumed = restored != 0
+		logger.Info("generators are resumed", "group", gg.Name(), "type", gg.TypeName(), "restored", restored)
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	rg := &runningGroup{
+		custom: custom,
+		gg:     gg,
+		writer: r.stats.addGroup(&gg, r.writer),
+		// the resumed generators are at the already written point
+		first:  !resumed,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.lastID++
+	rg.id = r.lastID
+	r.groups[rg.id] = rg
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	logger.Info("generators are started", "id", rg.id, "group", gg.Name(), "type", gg.TypeName(), "generators", len(gg.List()))
+	go r.run(ctx, rg)
+	return rg, nil
+}
+
+// get returns the running group by id
+func (r *registry) get(id int) (*runningGroup, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rg, ok := r.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", errGroupNotFound, id)
+	}
+	return rg, nil
+}
+
+// remove stops the group and waits until it's finished
+func (r *registry) remove(id int) error {
+	r.mu.Lock()
+	rg, ok := r.groups[id]
+	delete(r.groups, id)
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %d", errGroupNotFound, id)
+	}
+	rg.cancel()
+	<-rg.done
+	r.stats.removeGroup(rg.writer)
+	logger.Info("generators are stopped", "id", id, "group", rg.gg.Name(), "type", rg.gg.TypeName())
+	return nil
+}
+
+// list returns the info for all running groups sorted by ID
+func (r *registry) list() []groupInfo {
+	r.mu.Lock()
+	groups := make([]*runningGroup, 0, len(r.groups))
+	for _, rg := range r.groups {
+		groups = append(groups, rg)
+	}
+	r.mu.Unlock()
+	sort.Slice(groups, func(i, j int) bool { return groups[i].id < groups[j].id })
+	result := make([]groupInfo, 0, len(groups))
+	for _, rg := range groups {
+		result = append(result, rg.info())
+	}
+	return result
+}
+
+// wait blocks until all groups are finished
+func (r *registry) wait() {
+	r.wg.Wait()
+}
+
+func (r *registry) run(ctx context.Context, rg *runningGroup) {
+	defer r.wg.Done()
+	defer close(rg.done)
+	defer rg.writer.SetActive(0)
+	tick := rg.tick()
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case t := <-ticker.C:
+			n, err := rg.write(ctx, t, tick)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.Error("error while sending metrics", "group", rg.gg.Name(), "type", rg.gg.TypeName(), "bytes", n, "error", err)
+				r.cancel(fmt.Errorf("error while sending metrics, %d bytes sent: %w", n, err))
+				return
+			}
+			if newTick := rg.tick(); newTick != tick {
+				tick = newTick
+				ticker.Reset(tick)
+			}
+		}
+	}
+}
+
+// tick returns the interval between writes. The sub-second and jittered generators are written each 10% of the
+// interval, but at least each second, and the randomized generators are written each second.
+func (rg *runningGroup) tick() time.Duration {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if interval := rg.gg.Interval(); interval%time.Second != 0 || rg.gg.Jitter() != 0 {
+		return min(max(interval/10, preciseTick), time.Second)
+	}
+	if rg.gg.Randomized() {
+		return time.Second
+	}
+	return time.Duration(rg.gg.Step()) * time.Second
+}
+
+// write writes points of generators until the time t. The paused generators are skipped.
+func (rg *runningGroup) write(ctx context.Context, t time.Time, timeout time.Duration) (int64, error) {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	valid := rg.gg
+	if !rg.first {
+		valid = getNextGenerators(rg.gg)
+	}
+	rg.first = false
+	defer rg.gg.SetStopTime(t)
+	if rg.paused.Load() {
+		rg.writer.SetActive(0)
+		skipGenerators(valid)
+		return 0, nil
+	}
+	rg.writer.SetActive(len(valid.List()))
+	ctxTimeout, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	n, err := valid.WriteAllToWithContext(ctxTimeout, rg.writer)
+	if errors.Is(err, generator.ErrEmptyGens) {
+		return n, nil
+	}
+	return n, err
+}
+
+// setPaused pauses or resumes the group. The points of the paused group are skipped.
+func (rg *runningGroup) setPaused(paused bool) {
+	rg.paused.Store(paused)
+	logger.Info("generators are paused", "id", rg.id, "group", rg.gg.Name(), "paused", paused)
+}
+
+// tune applies new parameters to the running generators
+func (rg *runningGroup) tune(step uint, value, deviation float64, probability uint8) error {
+	if step == 0 {
+		return fmt.Errorf("%w: %s", errZeroStep, rg.custom.Name)
+	}
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	if err := rg.gg.Tune(step, value, deviation, probability); err != nil {
+		return err
+	}
+	rg.custom.Step = step
+	rg.custom.Value = value
+	rg.custom.Deviation = deviation
+	rg.custom.Probability = probability
+	logger.Info("generators are tuned", "id", rg.id, "group", rg.gg.Name(), "step", step, "value", value,
+		"deviation", deviation, "probability", probability)
+	return nil
+}
+
+func (rg *runningGroup) info() groupInfo {
+	rg.mu.Lock()
+	defer rg.mu.Unlock()
+	return groupInfo{
+		ID:         rg.id,
+		Custom:     rg.custom,
+		Paused:     rg.paused.Load(),
+		Generators: len(rg.gg.List()),
+	}
+}
+
+func getNextGenerators(gg generator.Generators) generator.Generators {
+	gens := make([]generator.Generator, 0, len(gg.List()))
+	for _, g := range gg.List() {
+		if err := g.Next(); err == nil {
+			gens = append(gens, g)
+		}
+	}
+	valid := gg
+	valid.SetList(gens)
+	return valid
+}
+
+// skipGenerators moves generators to the point after the stop without writing
+func skipGenerators(gg generator.Generators) {
+	for _, g := range gg.List() {
+		for g.Next() == nil {
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+var watchConfig bool
+
+// groupKey identifies the group of generators between config reloads
+type groupKey struct {
+	name      string
+	typeName  string
+	randomize bool
+}
+
+func (c *Custom) key() groupKey {
+	return groupKey{name: c.Name, typeName: c.Type, randomize: c.Randomize}
+}
+
+// reload applies the customs to the running groups. The running groups missing in customs are stopped, and then the
+// groups missing in the registry are started, so a restarted group is never reported twice. The changed parameters of
+// other groups are applied from the next tick, and the generators keep their state.
+func (r *registry) reload(customs []Custom) error {
+	current := make(map[groupKey][]*runningGroup)
+	for _, gi := range r.list() {
+		rg, err := r.get(gi.ID)
+		if err != nil {
+			continue
+		}
+		current[gi.key()] = append(current[gi.key()], rg)
+	}
+
+	var errs []error
+	var added, tuned, removed, unchanged int
+	var missing []Custom
+	for _, custom := range customs {
+		key := custom.key()
+		if len(current[key]) == 0 {
+			missing = append(missing, custom)
+			continue
+		}
+		rg := current[key][0]
+		current[key] = current[key][1:]
+		old := rg.info()
+		if old.Step == custom.Step && old.Value == custom.Value && old.Deviation == custom.Deviation &&
+			old.Probability == custom.Probability {
+			unchanged++
+			continue
+		}
+		if err := rg.tune(custom.Step, custom.Value, custom.Deviation, custom.Probability); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tuned++
+	}
+	for _, rgs := range current {
+		for _, rg := range rgs {
+			if err := r.remove(rg.id); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+	for _, custom := range missing {
+		if _, err := r.add(custom); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		added++
+	}
+	logger.Info("generators are reloaded", "added", added, "tuned", tuned, "removed", removed, "unchanged", unchanged)
+	return errors.Join(errs...)
+}
+
+// reloadConfig reads the config file again and applies it to the registry
+func reloadConfig(reg *registry) {
+	if err := readConfig(); err != nil {
+		logger.Error("unable to reload config", "error", err)
+		return
+	}
+	c, err := loadConfig()
+	if err != nil {
+		logger.Error("unable to reload config", "error", err)
+		return
+	}
+	config = c
+	if err := reg.reload(config.Customs()); err != nil {
+		logger.Error("config is partially applied", "error", err)
+	}
+}
+
+// handleSignals stops the generation on signals and reloads the config on SIGHUP. With --watch the config file is
+// reloaded on changes as well.
+func handleSignals(ctx context.Context, cancel context.CancelCauseFunc, reg *registry) {
+	changes := make(chan struct{}, 1)
+	if watchConfig && cfgFile != "" {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		})
+		viper.WatchConfig()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-CatchedSignals:
+			if sig == syscall.SIGHUP {
+				logger.Info("signal is caught, reloading config", "signal", sig, "file", cfgFile)
+				reloadConfig(reg)
+				continue
+			}
+			logger.Info("signal is caught, stopping", "signal", sig)
+			cancel(nil)
+			return
+		case <-changes:
+			logger.Info("config file is changed, reloading", "file", cfgFile)
+			reloadConfig(reg)
+		}
+	}
+}
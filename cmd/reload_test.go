@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryReload(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	carbon := &syncBuffer{}
+	reg := newRegistry(ctx, cancel, carbon, newStats(carbon))
+	general := General{Step: 60, Value: 10, Probability: 100}
+	customs := []Custom{
+		{Name: "unchanged.{1..2}", Type: "counter", General: general},
+		{Name: "tuned", Type: "const", General: general},
+		{Name: "removed", Type: "random", General: general},
+	}
+	require.NoError(t, reg.reload(customs))
+	groups := reg.list()
+	require.Len(t, groups, 3)
+	unchanged, err := reg.get(groups[0].ID)
+	require.NoError(t, err)
+	tuned, err := reg.get(groups[1].ID)
+	require.NoError(t, err)
+
+	tunedGeneral := general
+	tunedGeneral.Step = 30
+	tunedGeneral.Probability = 50
+	customs = []Custom{
+		{Name: "unchanged.{1..2}", Type: "counter", General: general},
+		{Name: "tuned", Type: "const", General: tunedGeneral},
+		{Name: "added", Type: "random", General: general},
+		{Name: "invalid", Type: "invalid", General: general},
+	}
+	assert.Error(t, reg.reload(customs))
+	groups = reg.list()
+	require.Len(t, groups, 3)
+	rg, err := reg.get(groups[0].ID)
+	require.NoError(t, err)
+	assert.Same(t, unchanged, rg)
+	rg, err = reg.get(groups[1].ID)
+	require.NoError(t, err)
+	assert.Same(t, tuned, rg)
+	assert.Equal(t, uint(30), groups[1].Step)
+	assert.Equal(t, uint8(50), groups[1].Probability)
+	assert.Equal(t, uint(30), tuned.gg.Step())
+	assert.Equal(t, "added", groups[2].Name)
+	assert.Equal(t, 4, groups[2].ID)
+
+	// randomize change restarts the group
+	randomized := general
+	randomized.Randomize = true
+	customs = []Custom{{Name: "unchanged.{1..2}", Type: "counter", General: randomized}}
+	require.NoError(t, reg.reload(customs))
+	groups = reg.list()
+	require.Len(t, groups, 1)
+	assert.True(t, groups[0].Randomize)
+	assert.NotEqual(t, unchanged.id, groups[0].ID)
+	r := reg.stats.report()
+	require.Len(t, r.Groups, 1, "the stats of the stopped groups are removed")
+	assert.Equal(t, "unchanged.{1..2}", r.Groups[0].Name)
+
+	cancel(nil)
+	reg.wait()
+}
+
+func TestRegistryInterval(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	carbon := &syncBuffer{}
+	reg := newRegistry(ctx, cancel, carbon, newStats(carbon))
+	general := General{Step: 60, Value: 10, Probability: 100}
+	precise := General{Interval: "100ms", Value: 10, Probability: 100}
+	jittered := General{Interval: "10s", Jitter: "2s", Value: 10, Probability: 100}
+	for _, c := range []struct {
+		general General
+		tick    time.Duration
+	}{
+		{general, time.Minute},
+		{precise, preciseTick},
+		{jittered, time.Second},
+	} {
+		rg, err := reg.add(Custom{Name: "metric", Type: "const", General: c.general})
+		require.NoError(t, err)
+		assert.Equal(t, c.tick, rg.tick(), c.general)
+		require.NoError(t, reg.remove(rg.id))
+	}
+
+	_, err := reg.add(Custom{Name: "precise", Type: "const", General: precise})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return strings.Count(carbon.String(), "\n") >= 3 }, 5*time.Second,
+		preciseTick)
+	cancel(nil)
+	reg.wait()
+	lines := strings.Split(strings.TrimSpace(carbon.String()), "\n")
+	previous := 0.0
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		require.Len(t, fields, 3, line)
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		require.NoError(t, err, line)
+		if i != 0 {
+			assert.InDelta(t, 0.1, ts-previous, 1e-6, "points are sent each 100ms")
+		}
+		previous = ts
+	}
+}
@@ -18,9 +18,12 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"sync"
+	"syscall"
 
 	"github.com/Felixoid/coal-mine/generator"
 	"github.com/spf13/cobra"
@@ -42,14 +45,17 @@ The curly braces in  metric names are expanded as it
 would be done in zsh. For example, "server{01..10}.soft{1..5}"
 will generate 50 metrics with two nodes.
 `,
-	PreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: setupLogging,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
 		bindCommonFlags(cmd)
 		f := cmd.Flags()
 		viper.BindPFlag("from", f.Lookup("from"))
 		viper.BindPFlag("until", f.Lookup("until"))
 
-		readConfig()
-		unmarshalConfig()
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
 	},
 	RunE:          generation,
 	SilenceUsage:  true,
@@ -74,46 +80,143 @@ func init() {
 
 	pf := rootCmd.PersistentFlags()
 	pf.SortFlags = false
+	pf.StringVar(&logOpts.Level, "log-level", "info", "logging level, one of 'debug', 'info', 'warn' or 'error'")
+	pf.StringVar(&logOpts.Format, "log-format", "text", "logging format, 'text' or 'json'")
 
 	commonFlags(rootCmd)
+	runFlags(rootCmd)
 	f.String("from", viper.GetString("from"), "starting point for generators in graphtie-web format")
 	f.String("until", viper.GetString("until"), "final point for generators in graphtie-web format")
+	f.BoolVar(&lazyExpansion, "lazy", false, "expand names and create generators on the fly by batches to keep the memory constant for huge masks, points are ordered by time only inside a batch")
+}
+
+// lazyExpansion enables generator.LazyGenerators in the default mode
+var lazyExpansion bool
+
+// backfillGroup is implemented by generator.Generators and generator.LazyGenerators
+type backfillGroup interface {
+	statsGroup
+	WriteAllToWithContext(ctx context.Context, w io.Writer) (int64, error)
+}
+
+// backfillGroups returns generators for each group of the config, lazy or not
+func (c *Config) backfillGroups(lazy bool) ([]backfillGroup, error) {
+	if lazy {
+		lgs, err := c.ToLazyGenerators()
+		if err != nil {
+			return nil, err
+		}
+		groups := make([]backfillGroup, len(lgs))
+		for i := range lgs {
+			groups[i] = &lgs[i]
+		}
+		return groups, nil
+	}
+	ggg, err := c.ToGenerators()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]backfillGroup, len(ggg))
+	for i := range ggg {
+		groups[i] = &ggg[i]
+	}
+	return groups, nil
 }
 
 func generation(cmd *cobra.Command, args []string) error {
+	if err := reportOpts.check(); err != nil {
+		return err
+	}
+
 	writer, err := config.GetCarbonWriter()
 	if err != nil {
 		return err
 	}
+	runStats := newStats(writer)
 
-	ggg, err := config.ToGenerators()
+	var groups []backfillGroup
+	var resumed []generator.Generators
+	if checkpointPath != "" || resumePath != "" {
+		if lazyExpansion {
+			return errLazyCheckpoint
+		}
+		var resume resumeStates
+		if resumePath != "" {
+			cp, err := loadCheckpoint(resumePath)
+			if err != nil {
+				return err
+			}
+			resume = cp.states()
+		}
+		groups, resumed, err = config.resumedGroups(resume)
+	} else {
+		groups, err = config.backfillGroups(lazyExpansion)
+	}
 	if err != nil {
 		return err
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := serveMetrics(ctx, listenAddr, runStats); err != nil {
+		return err
+	}
 	go func() {
-		select {
-		case <-CatchedSignals:
-			cancel()
+		for {
+			select {
+			case sig := <-CatchedSignals:
+				if sig == syscall.SIGHUP {
+					logger.Info("signal is caught, config reload is supported only in online modes", "signal", sig)
+					continue
+				}
+				logger.Info("signal is caught, stopping", "signal", sig)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
+	if err := writeGroups(ctx, groups, runStats, writer, config.Seed != 0); err != nil {
+		return errors.Join(err, closeWriter(writer))
+	}
+
+	if checkpointPath != "" {
+		if err := backfillCheckpoint(resumed).save(checkpointPath); err != nil {
+			return err
+		}
+		logger.Info("checkpoint is saved", "file", checkpointPath)
+	}
+
+	return reportOpts.finish(runStats, writer, cmd.ErrOrStderr())
+}
+
+// writeGroups writes all points of the groups to the writer and returns the first error. The groups are written
+// concurrently, unless the generation is seeded: the seeded output is reproducible only when groups are not interleaved
+func writeGroups(ctx context.Context, groups []backfillGroup, runStats *stats, writer io.Writer, seeded bool) error {
 	errs := make(chan error)
 	wg := sync.WaitGroup{}
-	wg.Add(len(ggg))
+	wg.Add(len(groups))
 
-	write := func(gg generator.Generators) {
+	write := func(gg backfillGroup) {
 		defer wg.Done()
+		writer := runStats.addGroup(gg, writer)
+		defer writer.SetActive(0)
 		n, err := gg.WriteAllToWithContext(ctx, writer)
 		if err != nil {
+			logger.Error("error while sending metrics", "group", gg.Name(), "type", gg.TypeName(), "bytes", n, "error", err)
 			errs <- fmt.Errorf("error while sending metrics, %d bytes sent: %w", n, err)
 		}
 	}
 
 	wait := make(chan struct{})
 	go func() {
-		for _, gg := range ggg {
+		for _, gg := range groups {
+			if seeded {
+				write(gg)
+				continue
+			}
 			go write(gg)
 		}
 		wg.Wait()
@@ -124,7 +227,6 @@ func generation(cmd *cobra.Command, args []string) error {
 	case err := <-errs:
 		return err
 	case <-wait:
+		return nil
 	}
-
-	return nil
 }
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/receiver"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// executeRoot runs the root command with the args. The config, viper and the flags of all commands are restored on
+// the test cleanup, so the tests can be repeated and shuffled.
+func executeRoot(t *testing.T, out, errOut io.Writer, args ...string) error {
+	t.Helper()
+	saved := config
+	var restore []func()
+	var walk func(*cobra.Command)
+	walk = func(c *cobra.Command) {
+		for _, fs := range []*pflag.FlagSet{c.PersistentFlags(), c.Flags()} {
+			fs.VisitAll(func(f *pflag.Flag) {
+				if sv, ok := f.Value.(pflag.SliceValue); ok {
+					value := sv.GetSlice()
+					restore = append(restore, func() { sv.Replace(value); f.Changed = false })
+					return
+				}
+				value := f.Value.String()
+				restore = append(restore, func() { f.Value.Set(value); f.Changed = false })
+			})
+		}
+		for _, sub := range c.Commands() {
+			walk(sub)
+		}
+	}
+	walk(rootCmd)
+	t.Cleanup(func() {
+		for _, r := range restore {
+			r()
+		}
+		viper.Reset()
+		setDefaultConfig()
+		config = saved
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		rootCmd.SetArgs(nil)
+	})
+	rootCmd.SetOut(out)
+	rootCmd.SetErr(errOut)
+	rootCmd.SetArgs(args)
+	return rootCmd.Execute()
+}
+
+func TestBackfillGroups(t *testing.T) {
+	general := General{Step: 60, Value: 1, Probability: 100, start: 60, stop: 120}
+	c := Config{General: general, Const: []string{"a.{1..3}"}, Counter: []string{"b"}}
+	for _, lazy := range []bool{false, true} {
+		groups, err := c.backfillGroups(lazy)
+		require.NoError(t, err)
+		require.Len(t, groups, 2)
+		assert.Equal(t, 3, groups[0].Len())
+		assert.Equal(t, "counter", groups[1].TypeName())
+		r := receiver.New(false)
+		_, err = groups[0].WriteAllToWithContext(context.Background(), r)
+		require.NoError(t, err)
+		assert.Equal(t, receiver.Stats{Series: 3, Points: 9}, r.Stats(), "lazy: %v", lazy)
+	}
+
+	c.Counter = []string{""}
+	_, err := c.backfillGroups(true)
+	assert.Error(t, err)
+}
+
+func TestWriteGroupsSeeded(t *testing.T) {
+	general := General{Step: 60, Value: 1, Deviation: 5, Probability: 100, start: 60, stop: 36000}
+	general.Disorder.Shuffle = 180
+	c := Config{Seed: 3, General: general, Random: []string{"a.{1..100}"}, Counter: []string{"b.{1..100}"}}
+	run := func() string {
+		c.applySeed()
+		groups, err := c.backfillGroups(false)
+		require.NoError(t, err)
+		require.Len(t, groups, 2)
+		buf := new(bytes.Buffer)
+		require.NoError(t, writeGroups(context.Background(), groups, newStats(buf), buf, true))
+		return buf.String()
+	}
+	defer generator.ResetSeed()
+	first := run()
+	assert.NotEmpty(t, first)
+	assert.Equal(t, first, run())
+}
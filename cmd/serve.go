@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/spf13/cobra"
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Generate metrics in the online mode controlled by HTTP API",
+	Long: `The command behaves like the online one, but additionally
+runs the HTTP control API on the --listen address. The groups
+of generators from the config and flags are started at once,
+and then can be listed, added, removed, paused, resumed and
+tuned at runtime:
+
+  GET    /groups              list running groups
+  POST   /groups              add a group from the custom generator JSON,
+                              omitted fields are taken from the general config
+  GET    /groups/{id}         get the group
+  PATCH  /groups/{id}         change step, value, deviation or probability
+  DELETE /groups/{id}         stop and remove the group
+  POST   /groups/{id}/pause   pause the group
+  POST   /groups/{id}/resume  resume the group
+  GET    /stats               get the statistic of the run
+  GET    /metrics             get the prometheus metrics
+
+Example:
+  curl -X POST localhost:8080/groups -d '{"name": "metric.{1..10}", "type": "counter", "step": 10}'
+  curl -X PATCH localhost:8080/groups/1 -d '{"step": 5}'
+
+On SIGHUP or with --watch on the config file change, the
+config is reloaded and becomes the source of truth: groups
+missing in the config are stopped, including the ones added
+through API.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		bindCommonFlags(cmd)
+
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
+	},
+	RunE: serve,
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	f := serveCmd.Flags()
+	f.SortFlags = false
+
+	commonFlags(serveCmd)
+	runFlags(serveCmd)
+	onlineFlags(serveCmd)
+}
+
+func serve(cmd *cobra.Command, args []string) error {
+	if err := reportOpts.check(); err != nil {
+		return err
+	}
+	if listenAddr == "" {
+		return errors.New("the serve command requires --listen address")
+	}
+
+	carbonWriter, err := config.GetCarbonWriter()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	runStats := newStats(carbonWriter)
+	reg := newRegistry(ctx, cancel, carbonWriter, runStats)
+	if err := reg.resumeFrom(resumePath); err != nil {
+		return err
+	}
+	stopCheckpoints := runCheckpoints(ctx, reg, checkpointPath, checkpointInterval)
+	if err := serveHTTP(ctx, listenAddr, newAPIHandler(reg, config.General)); err != nil {
+		return err
+	}
+
+	runReporter(ctx, runStats, carbonWriter)
+
+	for _, custom := range config.Customs() {
+		if _, err := reg.add(custom); err != nil {
+			cancel(err)
+			break
+		}
+	}
+
+	handleSignals(ctx, cancel, reg)
+
+	reg.wait()
+	stopCheckpoints()
+
+	return finishOnline(ctx, runStats, carbonWriter, cmd.ErrOrStderr())
+}
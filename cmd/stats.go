@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// reportOptions define how the run statistic is reported
+type reportOptions struct {
+	Format   string
+	Prefix   string
+	Interval time.Duration
+}
+
+func (o *reportOptions) check() error {
+	if o.Format != "text" && o.Format != "json" {
+		return fmt.Errorf("report format %s is not in [text json]", o.Format)
+	}
+	return nil
+}
+
+var reportOpts reportOptions
+
+// finish sends the own stats to carbon if the prefix is set, and writes the report to w
+func (o *reportOptions) finish(s *stats, carbon, w io.Writer) error {
+	if o.Prefix != "" {
+		if _, err := s.writeMetrics(carbon, o.Prefix, time.Now().Unix()); err != nil {
+			return fmt.Errorf("unable to send own stats: %w", err)
+		}
+	}
+	if err := closeWriter(carbon); err != nil {
+		return fmt.Errorf("unable to close the output: %w", err)
+	}
+	return s.writeReport(w, o.Format)
+}
+
+// connCounters is implemented by writers, which reconnect on errors
+type connCounters interface {
+	Reconnects() uint64
+	Connected() bool
+	Destination() string
+}
+
+// stats is shared by the writers of a run and collects the amount of sent data
+type stats struct {
+	started time.Time
+	conn    connCounters
+	queue   atomic.Int64
+	mu      sync.Mutex
+	lastID  int
+	groups  []*groupStats
+	// removed keeps the counters of removed groups for the totals
+	removed groupReport
+}
+
+// groupStats is the statistic for a single generator.Generators. The id is unique in the run, since names and types
+// of groups can be the same.
+type groupStats struct {
+	id       int
+	name     string
+	typeName string
+	series   int
+	dropped  func() uint64
+	points   atomic.Uint64
+	bytes    atomic.Uint64
+	errors   atomic.Uint64
+	active   atomic.Int64
+	latency  prometheus.Histogram
+}
+
+func newStats(w io.Writer) *stats {
+	s := &stats{started: time.Now()}
+	for w != nil {
+		if cc, ok := w.(connCounters); ok {
+			s.conn = cc
+			break
+		}
+		u, ok := w.(generator.Unwrapper)
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return s
+}
+
+// statsGroup is implemented by generator.Generators and generator.LazyGenerators
+type statsGroup interface {
+	Name() string
+	TypeName() string
+	Len() int
+	Dropped() uint64
+}
+
+// addGroup registers the group of generators and returns the writer, that counts the data written to w
+func (s *stats) addGroup(gg statsGroup, w io.Writer) *groupWriter {
+	s.mu.Lock()
+	s.lastID++
+	gs := &groupStats{
+		id:       s.lastID,
+		name:     gg.Name(),
+		typeName: gg.TypeName(),
+		series:   gg.Len(),
+		dropped:  gg.Dropped,
+	}
+	s.groups = append(s.groups, gs)
+	s.mu.Unlock()
+	gs.latency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:        "coal_mine_write_duration_seconds",
+		Help:        "Latency of writes to the carbon destination",
+		ConstLabels: prometheus.Labels{"group": gs.name, "type": gs.typeName, "id": gs.label()},
+		Buckets:     prometheus.ExponentialBuckets(0.0001, 4, 10),
+	})
+	gs.active.Store(int64(gs.series))
+	if g, ok := w.(groupOutput); ok {
+		w = g.group(gg.Name())
+	}
+	return &groupWriter{w: w, stats: gs, queue: &s.queue}
+}
+
+// removeGroup unregisters the group of the writer, its points, bytes, dropped points and errors are kept in totals
+func (s *stats) removeGroup(gw *groupWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, gs := range s.groups {
+		if gs != gw.stats {
+			continue
+		}
+		s.removed.Points += gs.points.Load()
+		s.removed.Bytes += gs.bytes.Load()
+		s.removed.Dropped += gs.dropped()
+		s.removed.Errors += gs.errors.Load()
+		s.groups = append(s.groups[:i], s.groups[i+1:]...)
+		return
+	}
+}
+
+// label returns the id for the prometheus label
+func (gs *groupStats) label() string {
+	return strconv.Itoa(gs.id)
+}
+
+// groupWriter counts points, bytes and errors of the writes for a group
+type groupWriter struct {
+	w     io.Writer
+	stats *groupStats
+	queue *atomic.Int64
+}
+
+// SetActive sets the amount of currently active generators in the group
+func (gw *groupWriter) SetActive(active int) {
+	gw.stats.active.Store(int64(active))
+}
+
+func (gw *groupWriter) Write(p []byte) (int, error) {
+	if gw.queue != nil {
+		gw.queue.Add(1)
+		defer gw.queue.Add(-1)
+	}
+	started := time.Now()
+	n, err := gw.w.Write(p)
+	if gw.stats.latency != nil {
+		gw.stats.latency.Observe(time.Since(started).Seconds())
+	}
+	gw.stats.bytes.Add(uint64(n))
+	gw.stats.points.Add(uint64(bytes.Count(p[:n], []byte{'\n'})))
+	if err != nil && !errors.Is(err, errLimitReached) {
+		gw.stats.errors.Add(1)
+	}
+	return n, err
+}
+
+// WritePoints counts the points written to the underlying generator.PointWriter
+func (gw *groupWriter) WritePoints(points []generator.Point) (int, error) {
+	if gw.queue != nil {
+		gw.queue.Add(1)
+		defer gw.queue.Add(-1)
+	}
+	started := time.Now()
+	n, err := generator.WritePoints(gw.w, points)
+	if gw.stats.latency != nil {
+		gw.stats.latency.Observe(time.Since(started).Seconds())
+	}
+	gw.stats.bytes.Add(uint64(n))
+	if err == nil {
+		gw.stats.points.Add(uint64(len(points)))
+	}
+	if err != nil && !errors.Is(err, errLimitReached) {
+		gw.stats.errors.Add(1)
+	}
+	return int(n), err
+}
+
+// Unwrap returns the underlying io.Writer
+func (gw *groupWriter) Unwrap() io.Writer {
+	return gw.w
+}
+
+type report struct {
+	Elapsed    float64       `json:"elapsed"`
+	Series     int           `json:"series"`
+	Points     uint64        `json:"points"`
+	Bytes      uint64        `json:"bytes"`
+	Dropped    uint64        `json:"dropped"`
+	Errors     uint64        `json:"errors"`
+	Reconnects uint64        `json:"reconnects"`
+	Rate       float64       `json:"rate"`
+	Groups     []groupReport `json:"groups"`
+}
+
+type groupReport struct {
+	Name    string  `json:"name"`
+	Type    string  `json:"type"`
+	Series  int     `json:"series"`
+	Points  uint64  `json:"points"`
+	Bytes   uint64  `json:"bytes"`
+	Dropped uint64  `json:"dropped"`
+	Errors  uint64  `json:"errors"`
+	Rate    float64 `json:"rate"`
+}
+
+func rate(points uint64, elapsed float64) float64 {
+	if elapsed == 0 {
+		return 0
+	}
+	return float64(points) / elapsed
+}
+
+// report returns the current state of the stats
+func (s *stats) report() report {
+	r := report{Elapsed: time.Since(s.started).Seconds()}
+	if s.conn != nil {
+		r.Reconnects = s.conn.Reconnects()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.Groups = make([]groupReport, 0, len(s.groups))
+	r.Points, r.Bytes, r.Dropped, r.Errors = s.removed.Points, s.removed.Bytes, s.removed.Dropped, s.removed.Errors
+	for _, gs := range s.groups {
+		gr := groupReport{
+			Name:    gs.name,
+			Type:    gs.typeName,
+			Series:  gs.series,
+			Points:  gs.points.Load(),
+			Bytes:   gs.bytes.Load(),
+			Dropped: gs.dropped(),
+			Errors:  gs.errors.Load(),
+		}
+		gr.Rate = rate(gr.Points, r.Elapsed)
+		r.Series += gr.Series
+		r.Points += gr.Points
+		r.Bytes += gr.Bytes
+		r.Dropped += gr.Dropped
+		r.Errors += gr.Errors
+		r.Groups = append(r.Groups, gr)
+	}
+	r.Rate = rate(r.Points, r.Elapsed)
+	return r
+}
+
+// writeReport writes the report in a given format, text or json
+func (s *stats) writeReport(w io.Writer, format string) error {
+	r := s.report()
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "group\ttype\tseries\tpoints\tbytes\tdropped\terrors\trate/s\t")
+	for _, gr := range r.Groups {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%.2f\t\n",
+			gr.Name, gr.Type, gr.Series, gr.Points, gr.Bytes, gr.Dropped, gr.Errors, gr.Rate)
+	}
+	fmt.Fprintf(tw, "total\t\t%d\t%d\t%d\t%d\t%d\t%.2f\t\n", r.Series, r.Points, r.Bytes, r.Dropped, r.Errors, r.Rate)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "reconnects: %d, elapsed: %s\n", r.Reconnects, time.Duration(r.Elapsed*float64(time.Second)).Round(time.Millisecond))
+	return err
+}
+
+var invalidNodeChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// metricNode converts the group name to a single node of a metric name
+func metricNode(name string) string {
+	return strings.Trim(invalidNodeChars.ReplaceAllString(name, "_"), "_")
+}
+
+// writeMetrics writes the stats under the prefix with timestamp ts, in carbon format or as points to the outputs
+// writing generator.Point
+func (s *stats) writeMetrics(w io.Writer, prefix string, ts int64) (int64, error) {
+	r := s.report()
+	var points []generator.Point
+	add := func(name string, value float64) {
+		points = append(points, generator.NewPoint(prefix+"."+name, value, uint(ts)))
+	}
+	add("points", float64(r.Points))
+	add("bytes", float64(r.Bytes))
+	add("dropped", float64(r.Dropped))
+	add("errors", float64(r.Errors))
+	add("reconnects", float64(r.Reconnects))
+	add("rate", r.Rate)
+	for _, gr := range r.Groups {
+		node := "groups." + metricNode(gr.Name)
+		add(node+".series", float64(gr.Series))
+		add(node+".points", float64(gr.Points))
+		add(node+".bytes", float64(gr.Bytes))
+		add(node+".dropped", float64(gr.Dropped))
+		add(node+".errors", float64(gr.Errors))
+		add(node+".rate", gr.Rate)
+	}
+	return generator.WritePoints(w, points)
+}
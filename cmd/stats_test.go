@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	carbon := &fakeConn{}
+	s := newStats(&groupWriter{w: carbon})
+	assert.Equal(t, carbon, s.conn)
+
+	gg, err := generator.NewExpand("const", "metric.{1..2}", 1, 1, 1, false, 1, 0, 100)
+	assert.NoError(t, err)
+	w := s.addGroup(&gg, carbon)
+	_, err = gg.WriteAllTo(w)
+	assert.NoError(t, err)
+
+	r := s.report()
+	assert.Equal(t, 2, r.Series)
+	assert.Equal(t, uint64(4), r.Points)
+	assert.Equal(t, uint64(len(carbon.String())), r.Bytes)
+	assert.Equal(t, uint64(2), r.Reconnects)
+	assert.Len(t, r.Groups, 1)
+	assert.Equal(t, "metric.{1..2}", r.Groups[0].Name)
+	assert.Equal(t, "const", r.Groups[0].Type)
+
+	buf := &strings.Builder{}
+	assert.NoError(t, s.writeReport(buf, "json"))
+	decoded := report{}
+	assert.NoError(t, json.Unmarshal([]byte(buf.String()), &decoded))
+	assert.Equal(t, r.Points, decoded.Points)
+	assert.Equal(t, r.Groups[0].Name, decoded.Groups[0].Name)
+
+	buf.Reset()
+	assert.NoError(t, s.writeReport(buf, "text"))
+	assert.Contains(t, buf.String(), "metric.{1..2}")
+	assert.Contains(t, buf.String(), "reconnects: 2")
+
+	buf.Reset()
+	_, err = s.writeMetrics(buf, "coal-mine", 123)
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "coal-mine.points 4 123\n")
+	assert.Contains(t, buf.String(), "coal-mine.groups.metric_1_2.series 2 123\n")
+
+	// the removed group isn't reported, but its points are kept in totals
+	s.removeGroup(w)
+	r = s.report()
+	assert.Empty(t, r.Groups)
+	assert.Zero(t, r.Series)
+	assert.Equal(t, uint64(4), r.Points)
+	assert.Equal(t, uint64(len(carbon.String())), r.Bytes)
+}
+
+func TestReportOptionsCheck(t *testing.T) {
+	o := reportOptions{Format: "text"}
+	assert.NoError(t, o.check())
+	o.Format = "json"
+	assert.NoError(t, o.check())
+	o.Format = "yaml"
+	assert.Error(t, o.check())
+}
+
+func TestMetricNode(t *testing.T) {
+	assert.Equal(t, "custom_random_generator_1_10", metricNode("custom.random.generator{1..10}"))
+	assert.Equal(t, "a-b_c", metricNode("a-b_c"))
+}
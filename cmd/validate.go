@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Felixoid/braxpansion"
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// fieldError is the problem with the config field
+type fieldError struct {
+	field string
+	err   error
+}
+
+func (e *fieldError) Error() string {
+	return e.field + ": " + e.err.Error()
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.err
+}
+
+// prefixErrors prepends the prefix to fields of all fieldError in err, other errors get the prefix as the field
+func prefixErrors(prefix string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs := joined.Unwrap()
+		prefixed := make([]error, 0, len(errs))
+		for _, e := range errs {
+			prefixed = append(prefixed, prefixErrors(prefix, e))
+		}
+		return errors.Join(prefixed...)
+	}
+	if fe, ok := err.(*fieldError); ok {
+		return &fieldError{prefix + "." + fe.field, fe.err}
+	}
+	return &fieldError{prefix, err}
+}
+
+// flattenErrors returns the list of errors joined by errors.Join
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var result []error
+	for _, e := range joined.Unwrap() {
+		result = append(result, flattenErrors(e)...)
+	}
+	return result
+}
+
+func validateName(name string) error {
+	if name == "" {
+		return &fieldError{"name", errors.New("name is empty")}
+	}
+	if len(braxpansion.ExpandString(name)) == 0 {
+		return &fieldError{"name", fmt.Errorf("name %q expands to nothing", name)}
+	}
+	return nil
+}
+
+// validate checks dates, step, interval, jitter, probability and disorder
+func (g *General) validate() error {
+	errs := []error{g.setStartStop()}
+	if errs[0] == nil && g.stop <= g.start {
+		errs = append(errs, &fieldError{"from", fmt.Errorf("from %q (%d) must be less than until %q (%d)", g.From, g.start, g.Until, g.stop)})
+	}
+	if g.Step == 0 && g.Interval == "" {
+		errs = append(errs, &fieldError{"step", errZeroStep})
+	}
+	if interval, jitter, err := g.intervals(); err != nil {
+		errs = append(errs, err)
+	} else {
+		if err := generator.CheckInterval(interval, 0, ""); err != nil {
+			errs = append(errs, &fieldError{"interval", err})
+		}
+		if err := generator.CheckInterval(0, jitter, g.JitterDistribution); err != nil {
+			errs = append(errs, &fieldError{"jitter", err})
+		}
+	}
+	if err := generator.CheckProbability(g.Probability); err != nil {
+		errs = append(errs, &fieldError{"probability", err})
+	}
+	errs = append(errs, g.Disorder.validate())
+	return errors.Join(errs...)
+}
+
+// validateType checks the type is built-in or registered, and isn't undefined
+func validateType(typeName string) error {
+	if gt, err := generator.GetType(typeName); err != nil {
+		return &fieldError{"type", err}
+	} else if gt == generator.UndefinedType {
+		return &fieldError{"type", fmt.Errorf("%w: %s", generator.ErrNotImplemented, typeName)}
+	}
+	return nil
+}
+
+// validate checks dates of outages, and that random gaps are shorter than their intervals
+func (g *Gaps) validate() error {
+	gaps, err := g.spec()
+	errs := []error{err}
+	for _, check := range []struct {
+		field string
+		gaps  generator.Gaps
+	}{
+		{"outages", generator.Gaps{Outages: gaps.Outages}},
+		{"outage-length", generator.Gaps{OutageInterval: gaps.OutageInterval, OutageLength: gaps.OutageLength}},
+		{"silence-length", generator.Gaps{SilenceInterval: gaps.SilenceInterval, SilenceLength: gaps.SilenceLength}},
+		{"delay-distribution", generator.Gaps{DelayDistribution: gaps.DelayDistribution}},
+	} {
+		if err != nil && check.field == "outages" {
+			// unparsed dates are already reported
+			continue
+		}
+		if err := check.gaps.Check(); err != nil {
+			errs = append(errs, &fieldError{check.field, err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the percent of duplicates
+func (d *Disorder) validate() error {
+	if err := (generator.Disorder{Duplicates: d.Duplicates}).Check(); err != nil {
+		return &fieldError{"duplicates", err}
+	}
+	return nil
+}
+
+// validate checks retentions and aggregation, and that the sub-second interval and the jitter aren't set with
+// retentions
+func (r *Rollup) validate(g *General) error {
+	if _, err := r.spec(); err != nil {
+		return err
+	}
+	if r.Retentions != "" && (g.Interval != "" || g.Jitter != "") {
+		return &fieldError{"retentions", fmt.Errorf("%w: interval and jitter can't be used with retentions", generator.ErrRollup)}
+	}
+	return nil
+}
+
+// validate checks general parameters, name, type, retentions, gaps and disorder. For counter, the value and deviation are checked as well,
+// and for replay the source is loaded.
+func (c *Custom) validate() error {
+	errs := []error{c.General.validate(), validateName(c.Name), validateType(c.Type), c.Rollup.validate(&c.General),
+		c.Gaps.validate()}
+	switch c.Type {
+	case "counter":
+		if err := generator.CheckCounter(c.Value, c.Deviation); err != nil {
+			errs = append(errs, &fieldError{"value", err})
+		}
+	case "replay":
+		if err := generator.NewSpec(c.Type, c.Name, generator.WithSource(c.Source), generator.WithLogger(generatorLogger())).Validate(); err != nil {
+			errs = append(errs, &fieldError{"source", err})
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns all problems of the config at once joined by errors.Join
+func (c *Config) Validate() error {
+	errs := []error{c.General.validate()}
+	hasCounter := len(c.Counter) != 0
+	for _, g := range c.Generators {
+		hasCounter = hasCounter || strings.HasPrefix(g, "counter:")
+	}
+	if hasCounter {
+		if err := generator.CheckCounter(c.Value, c.Deviation); err != nil {
+			errs = append(errs, &fieldError{"value", err})
+		}
+	}
+	for _, names := range []struct {
+		field string
+		names []string
+	}{{"const", c.Const}, {"counter", c.Counter}, {"random", c.Random}} {
+		for i, name := range names.names {
+			errs = append(errs, prefixErrors(fmt.Sprintf("%s[%d]", names.field, i), validateName(name)))
+		}
+	}
+	for i, g := range c.Generators {
+		typeName, name, _ := strings.Cut(g, ":")
+		errs = append(errs, prefixErrors(fmt.Sprintf("generators[%d]", i), errors.Join(validateType(typeName), validateName(name))))
+	}
+	for i := range c.Custom {
+		c.Custom[i].inheritDates(&c.General)
+		errs = append(errs, prefixErrors(fmt.Sprintf("custom[%d]", i), c.Custom[i].validate()))
+	}
+	return errors.Join(errs...)
+}
+
+// validateCmd represents the validate command
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validates the config and reports all problems at once",
+	Long: `Validates the config file and reports every problem with
+the field name, e.g. custom[1].probability. It checks that
+from and until are parseable and from is less than until,
+step is positive, probability is in [1,100], names expand
+to something, types are valid and counters have meaningful
+value and deviation.
+
+The command exits with non-zero code if any problem is found.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if cfgFile == "" {
+			return errors.New("the config file must be set with --config")
+		}
+		return readConfig()
+	},
+	RunE: validate,
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+
+	f := validateCmd.Flags()
+	f.StringVarP(&cfgFile, "config", "c", "", "config file")
+}
+
+func validate(cmd *cobra.Command, args []string) error {
+	c := &Config{}
+	if err := viper.Unmarshal(c); err != nil {
+		return fmt.Errorf("fail to unmarshal config %v: %w", viper.AllSettings(), err)
+	}
+	problems := flattenErrors(c.Validate())
+	for _, p := range problems {
+		fmt.Fprintln(cmd.OutOrStdout(), p)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%d problems are found in %s", len(problems), cfgFile)
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "%s is valid\n", cfgFile)
+	return nil
+}
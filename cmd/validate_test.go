@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDate(t *testing.T) {
+	ts, err := parseDate("")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(now), ts)
+	ts, err = parseDate("1700000000")
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1700000000), ts)
+	_, err = parseDate("-1h")
+	assert.NoError(t, err)
+	_, err = parseDate("1d")
+	assert.Error(t, err)
+	_, err = parseDate("-1x")
+	assert.Error(t, err)
+}
+
+func TestPrefixErrors(t *testing.T) {
+	assert.Nil(t, prefixErrors("custom[0]", nil))
+	err := prefixErrors("custom[0]", errors.Join(&fieldError{"step", errZeroStep}, errors.New("plain")))
+	problems := flattenErrors(err)
+	require.Len(t, problems, 2)
+	assert.Equal(t, "custom[0].step: step must be positive", problems[0].Error())
+	assert.ErrorIs(t, problems[0], errZeroStep)
+	assert.Equal(t, "custom[0]: plain", problems[1].Error())
+}
+
+func TestConfigValidate(t *testing.T) {
+	general := General{From: "-2h", Until: "now", Step: 60, Value: 1, Probability: 100}
+	c := Config{
+		General: general,
+		Const:   []string{"const.{1..3}"},
+		Custom: []Custom{
+			{Name: "custom.{1..3}", Type: "random", General: general},
+		},
+	}
+	assert.NoError(t, c.Validate())
+
+	c.Counter = []string{""}
+	c.Value = -1
+	c.Deviation = 1
+	c.Duplicates = 101
+	c.Custom = append(c.Custom, Custom{
+		Name: "custom",
+		Type: "unknown",
+		General: General{
+			From:  "-1h",
+			Until: "-2h",
+		},
+	}, Custom{
+		Name:    "counter",
+		Type:    "counter",
+		General: General{From: "invalid", Until: "now", Step: 1, Value: -2, Deviation: 1, Probability: 101},
+	}, Custom{
+		Name:    "replay",
+		Type:    "replay",
+		Source:  filepath.Join(t.TempDir(), "missing.json"),
+		General: general,
+	}, Custom{
+		Name: "gaps",
+		Type: "const",
+		Gaps: Gaps{
+			Outages:           []Outage{{From: "-1h", Until: "-2h"}, {From: "invalid", Until: "now"}},
+			OutageInterval:    60,
+			OutageLength:      60,
+			DelayDistribution: "normal",
+		},
+		General: General{From: "-2h", Until: "now", Step: 60, Value: 1, Probability: 100,
+			Disorder: Disorder{Duplicates: 101}},
+	}, Custom{
+		Name: "interval",
+		Type: "const",
+		General: General{From: "-1h", Until: "now", Probability: 100, Interval: "100us", Jitter: "1s",
+			JitterDistribution: "pareto"},
+	}, Custom{
+		Name:    "invalid",
+		Type:    "const",
+		General: General{From: "-1h", Until: "now", Probability: 100, Interval: "invalid", Jitter: "-1s"},
+	}, Custom{
+		Name:    "rollup",
+		Type:    "const",
+		Rollup:  Rollup{Retentions: "1m:1d,10s:1h", Aggregation: "median"},
+		General: general,
+	}, Custom{
+		Name:    "rollup",
+		Type:    "const",
+		Rollup:  Rollup{Retentions: "10s:1d,1m:7d"},
+		General: General{From: "-1h", Until: "now", Probability: 100, Interval: "10s"},
+	})
+	problems := []string{}
+	for _, p := range flattenErrors(c.Validate()) {
+		problems = append(problems, p.Error())
+	}
+	expected := []string{
+		"duplicates: invalid disorder",
+		"value: ",
+		"counter[0].name: ",
+		"custom[1].from: from \"-1h\"",
+		"custom[1].step: ",
+		"custom[1].probability: ",
+		"custom[1].type: ",
+		"custom[2].from: unable to parse \"invalid\"",
+		"custom[2].probability: ",
+		"custom[2].value: ",
+		"custom[3].source: invalid replay source",
+		"custom[4].duplicates: invalid disorder",
+		"custom[4].outages[1].from: unable to parse \"invalid\"",
+		"custom[4].outage-length: invalid gaps",
+		"custom[4].delay-distribution: invalid gaps",
+		"custom[5].interval: step is not valid",
+		"custom[5].jitter: step is not valid",
+		"custom[6].interval: time: invalid duration",
+		"custom[7].retentions: invalid retention",
+		"custom[7].aggregation: invalid aggregation method",
+		"custom[8].retentions: invalid rollup",
+	}
+	require.Len(t, problems, len(expected), problems)
+	for i := range expected {
+		assert.True(t, strings.HasPrefix(problems[i], expected[i]), problems[i])
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.toml")
+	require.NoError(t, os.WriteFile(valid, []byte("const = ['metric.{1..3}']\n"), 0o644))
+	buf := &strings.Builder{}
+	assert.NoError(t, executeRoot(t, buf, &strings.Builder{}, "validate", "-c", valid))
+	assert.Equal(t, valid+" is valid\n", buf.String())
+
+	invalid := filepath.Join(dir, "invalid.toml")
+	require.NoError(t, os.WriteFile(invalid, []byte("[[custom]]\nname = 'metric'\ntype = 'const'\n"), 0o644))
+	buf.Reset()
+	assert.Error(t, executeRoot(t, buf, &strings.Builder{}, "validate", "-c", invalid))
+	assert.Contains(t, buf.String(), "custom[0].step: step must be positive\n")
+	assert.NotContains(t, buf.String(), "custom[0].from", "from and until are inherited")
+}
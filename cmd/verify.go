@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/internal/storage"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verifies points in graphite-web against the generated ones",
+	Long: `Generates the expected points from the config and seed
+like the main command does, but instead of sending them
+queries the graphite-web compatible /render?format=json
+endpoint, and reports per series:
+
+  missing     expected points, which are null or not returned
+  mismatched  points with values differing more than --tolerance
+  extra       not null points, which are not expected
+
+When graphite-web returns points with the bigger step, e.g.
+because of the retention rollup, the expected points are
+aggregated with --aggregation into the same intervals.
+
+The same --seed as for the generation must be used, otherwise
+the values, randomized starts and dropped points differ.
+
+The command exits with non-zero code if any problem is found.`,
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		bindCommonFlags(cmd)
+		f := cmd.Flags()
+		viper.BindPFlag("from", f.Lookup("from"))
+		viper.BindPFlag("until", f.Lookup("until"))
+
+		if err := readConfig(); err != nil {
+			return err
+		}
+		return unmarshalConfig()
+	},
+	RunE: verification,
+}
+
+var verifyOpts struct {
+	url         string
+	tolerance   float64
+	aggregation string
+	batch       int
+	timeout     time.Duration
+	format      string
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+
+	f := verifyCmd.Flags()
+	f.SortFlags = false
+
+	commonFlags(verifyCmd)
+	f.String("from", viper.GetString("from"), "starting point for generators in graphtie-web format")
+	f.String("until", viper.GetString("until"), "final point for generators in graphtie-web format")
+	f.StringVar(&verifyOpts.url, "url", "", "graphite-web compatible base URL, e.g. 'http://localhost:8080', the /render is appended")
+	f.Float64Var(&verifyOpts.tolerance, "tolerance", 1e-6, "the maximum absolute difference of matching values")
+	f.StringVar(&verifyOpts.aggregation, "aggregation", "average", "aggregation of expected points for the bigger step in the response like in storage-aggregation.conf, 'average', 'sum', 'last', 'max', 'min', 'avg_zero', 'absmax' or 'absmin'")
+	f.IntVar(&verifyOpts.batch, "batch", 100, "amount of series queried by a single request")
+	f.DurationVar(&verifyOpts.timeout, "timeout", time.Minute, "timeout of a single request")
+	f.StringVar(&verifyOpts.format, "format", "text", "output format, 'text' or 'json'")
+}
+
+// renderSeries is the series of graphite-web /render?format=json response
+type renderSeries struct {
+	Target     string        `json:"target"`
+	Datapoints [][2]*float64 `json:"datapoints"`
+}
+
+// seriesVerification is the result of the verification of a single series
+type seriesVerification struct {
+	Name       string `json:"name"`
+	Step       uint   `json:"step"`
+	Expected   int    `json:"expected"`
+	Missing    int    `json:"missing"`
+	Mismatched int    `json:"mismatched"`
+	Extra      int    `json:"extra"`
+	// Problem is the first found problem of the series
+	Problem string `json:"problem,omitempty"`
+}
+
+func (sv *seriesVerification) ok() bool {
+	return sv.Missing == 0 && sv.Mismatched == 0 && sv.Extra == 0
+}
+
+// verifyReport is the result of the verification. Only series with problems are listed.
+type verifyReport struct {
+	Series     int                  `json:"series"`
+	Expected   int                  `json:"expected"`
+	Missing    int                  `json:"missing"`
+	Mismatched int                  `json:"mismatched"`
+	Extra      int                  `json:"extra"`
+	Problems   []seriesVerification `json:"problems"`
+}
+
+func (r *verifyReport) add(sv seriesVerification) {
+	r.Series++
+	r.Expected += sv.Expected
+	r.Missing += sv.Missing
+	r.Mismatched += sv.Mismatched
+	r.Extra += sv.Extra
+	if !sv.ok() {
+		r.Problems = append(r.Problems, sv)
+	}
+}
+
+func (r *verifyReport) write(w io.Writer, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "series\tstep\texpected\tmissing\tmismatched\textra\tfirst problem\t")
+	for _, sv := range r.Problems {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\t\n", sv.Name, sv.Step, sv.Expected, sv.Missing, sv.Mismatched, sv.Extra, sv.Problem)
+	}
+	fmt.Fprintf(tw, "total %d\t\t%d\t%d\t%d\t%d\t\t\n", r.Series, r.Expected, r.Missing, r.Mismatched, r.Extra)
+	return tw.Flush()
+}
+
+// verifier compares expected points with the graphite-web response
+type verifier struct {
+	client      *http.Client
+	renderURL   string
+	tolerance   float64
+	aggregation storage.Aggregation
+	batch       int
+}
+
+// expectedPoints returns points of generators grouped by series path, the points of each series are sorted by time
+func expectedPoints(gg *generator.Generators) (map[string][]generator.Point, []string) {
+	series := make(map[string][]generator.Point, gg.Len())
+	var paths []string
+	for p := range gg.Points() {
+		path := p.Path()
+		if _, ok := series[path]; !ok {
+			paths = append(paths, path)
+		}
+		series[path] = append(series[path], p)
+	}
+	sort.Strings(paths)
+	return series, paths
+}
+
+// renderTarget returns the render target of the series. The tagged series are queried by seriesByTag with the name
+// and all tags, graphite-web returns them with the normalized path.
+func renderTarget(p generator.Point) string {
+	if len(p.Tags) == 0 {
+		return p.Name
+	}
+	exprs := make([]string, 0, len(p.Tags)+1)
+	for tag, value := range p.Tags {
+		exprs = append(exprs, "'"+tag+"="+value+"'")
+	}
+	sort.Strings(exprs)
+	return "seriesByTag('name=" + p.Name + "'," + strings.Join(exprs, ",") + ")"
+}
+
+// render requests the series from graphite-web for the time range
+func (v *verifier) render(ctx context.Context, targets []string, from, until uint) (map[string]renderSeries, error) {
+	form := url.Values{}
+	form.Set("format", "json")
+	form.Set("from", strconv.FormatUint(uint64(from), 10))
+	form.Set("until", strconv.FormatUint(uint64(until), 10))
+	for _, t := range targets {
+		form.Add("target", t)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.renderURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("render returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var response []renderSeries
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("unable to decode render response: %w", err)
+	}
+	result := make(map[string]renderSeries, len(response))
+	for _, rs := range response {
+		result[rs.Target] = rs
+	}
+	return result, nil
+}
+
+// compare verifies the received series against the expected points. The expected points are aggregated into the
+// intervals of the response step, and only received points inside the expected intervals are checked for extras.
+func (v *verifier) compare(name string, expected []generator.Point, received renderSeries, step uint) seriesVerification {
+	sv := seriesVerification{Name: name, Step: step}
+	if len(received.Datapoints) > 1 && received.Datapoints[0][1] != nil && received.Datapoints[1][1] != nil {
+		sv.Step = uint(*received.Datapoints[1][1] - *received.Datapoints[0][1])
+	}
+	if sv.Step == 0 {
+		sv.Step = 1
+	}
+	// the amount of generated points in the interval, the missing ones are counted by avg_zero
+	total := 1
+	if step != 0 && sv.Step > step {
+		total = int(sv.Step / step)
+	}
+	problem := func(format string, args ...any) {
+		if sv.Problem == "" {
+			sv.Problem = fmt.Sprintf(format, args...)
+		}
+	}
+
+	buckets := make(map[uint][]float64)
+	var intervals []uint
+	for _, p := range expected {
+		interval := p.Timestamp - p.Timestamp%sv.Step
+		if _, ok := buckets[interval]; !ok {
+			intervals = append(intervals, interval)
+		}
+		buckets[interval] = append(buckets[interval], p.Value)
+	}
+	sv.Expected = len(intervals)
+	if len(intervals) == 0 {
+		return sv
+	}
+	first, last := intervals[0], intervals[len(intervals)-1]
+
+	seen := make(map[uint]bool, len(intervals))
+	for _, dp := range received.Datapoints {
+		if dp[1] == nil {
+			continue
+		}
+		ts := uint(*dp[1])
+		if ts < first || last < ts {
+			continue
+		}
+		values, ok := buckets[ts]
+		switch {
+		case !ok && dp[0] != nil:
+			sv.Extra++
+			problem("extra %g at %d", *dp[0], ts)
+		case !ok:
+		case dp[0] == nil:
+			seen[ts] = true
+			sv.Missing++
+			problem("missing at %d", ts)
+		default:
+			seen[ts] = true
+			want := v.aggregation.Aggregate(values, max(total, len(values)))
+			if math.Abs(*dp[0]-want) > v.tolerance {
+				sv.Mismatched++
+				problem("expected %g, got %g at %d", want, *dp[0], ts)
+			}
+		}
+	}
+	for _, interval := range intervals {
+		if !seen[interval] {
+			sv.Missing++
+			problem("missing at %d", interval)
+		}
+	}
+	return sv
+}
+
+// verifyGroup verifies all series of the group by batches. The expected points are generated for each batch of
+// generators separately, so only the points of the batch are kept in memory.
+func (v *verifier) verifyGroup(ctx context.Context, gg *generator.Generators, report *verifyReport) error {
+	gens := gg.List()
+	for len(gens) != 0 {
+		batch := *gg
+		batch.SetList(gens[:min(v.batch, len(gens))])
+		gens = gens[batch.Len():]
+		series, paths := expectedPoints(&batch)
+		if len(paths) == 0 {
+			continue
+		}
+		targets := make([]string, 0, len(paths))
+		from, until := uint(math.MaxUint), uint(0)
+		for _, path := range paths {
+			points := series[path]
+			targets = append(targets, renderTarget(points[0]))
+			from = min(from, points[0].Timestamp)
+			until = max(until, points[len(points)-1].Timestamp)
+		}
+		received, err := v.render(ctx, targets, from, until+1)
+		if err != nil {
+			return fmt.Errorf("unable to verify %s: %w", gg.Name(), err)
+		}
+		for _, path := range paths {
+			report.add(v.compare(path, series[path], received[path], gg.Step()))
+		}
+	}
+	return nil
+}
+
+// errVerifyFailed is returned when any problem is found by the verification
+var errVerifyFailed = errors.New("verification failed")
+
+func verification(cmd *cobra.Command, args []string) error {
+	if verifyOpts.format != "text" && verifyOpts.format != "json" {
+		return fmt.Errorf("format %s is not in [text json]", verifyOpts.format)
+	}
+	if verifyOpts.url == "" {
+		return errors.New("the verify command requires --url")
+	}
+	aggregation, err := storage.ParseAggregation(verifyOpts.aggregation)
+	if err != nil {
+		return err
+	}
+	if verifyOpts.batch <= 0 {
+		return fmt.Errorf("batch %d must be positive", verifyOpts.batch)
+	}
+	if config.Seed == 0 {
+		logger.Warn("the seed isn't set, the deviated values, randomized starts and dropped points can't match")
+	}
+
+	ggg, err := config.ToGenerators()
+	if err != nil {
+		return err
+	}
+	v := &verifier{
+		client:      &http.Client{Timeout: verifyOpts.timeout},
+		renderURL:   strings.TrimSuffix(verifyOpts.url, "/") + "/render",
+		tolerance:   verifyOpts.tolerance,
+		aggregation: aggregation,
+		batch:       verifyOpts.batch,
+	}
+	report := &verifyReport{}
+	for i := range ggg {
+		if err := v.verifyGroup(cmd.Context(), &ggg[i], report); err != nil {
+			return err
+		}
+	}
+	if err := report.write(cmd.OutOrStdout(), verifyOpts.format); err != nil {
+		return err
+	}
+	if len(report.Problems) != 0 {
+		return fmt.Errorf("%w: %d series of %d have problems", errVerifyFailed, len(report.Problems), report.Series)
+	}
+	return nil
+}
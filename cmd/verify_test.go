@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/internal/storage"
+	"github.com/Felixoid/coal-mine/receiver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// graphiteStandIn serves /render from the receiver points. The points are averaged into intervals of the step.
+type graphiteStandIn struct {
+	r       *receiver.Receiver
+	step    int64
+	mutate  func(target string, dps [][2]*float64) [][2]*float64
+	targets []string
+}
+
+// seriesByTagPath returns the path of the seriesByTag target with the name and sorted tags, other targets are returned
+// as is
+func seriesByTagPath(target string) string {
+	args, ok := strings.CutPrefix(target, "seriesByTag(")
+	if !ok {
+		return target
+	}
+	var name string
+	var tags []string
+	for _, expr := range strings.Split(strings.TrimSuffix(args, ")"), ",") {
+		expr = strings.Trim(expr, "'")
+		if value, ok := strings.CutPrefix(expr, "name="); ok {
+			name = value
+			continue
+		}
+		tags = append(tags, expr)
+	}
+	sort.Strings(tags)
+	return strings.Join(append([]string{name}, tags...), ";")
+}
+
+func (g *graphiteStandIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	from, _ := strconv.ParseInt(req.Form.Get("from"), 10, 64)
+	until, _ := strconv.ParseInt(req.Form.Get("until"), 10, 64)
+	var response []renderSeries
+	g.targets = append(g.targets, req.Form["target"]...)
+	for _, target := range req.Form["target"] {
+		target = seriesByTagPath(target)
+		points := g.r.Points(target)
+		if points == nil {
+			continue
+		}
+		var dps [][2]*float64
+		for ts := from - from%g.step; ts < until; ts += g.step {
+			sum, count := 0.0, 0
+			for _, p := range points {
+				if ts <= p.Timestamp && p.Timestamp < ts+g.step {
+					sum += p.Value
+					count++
+				}
+			}
+			t := float64(ts)
+			if count == 0 {
+				dps = append(dps, [2]*float64{nil, &t})
+				continue
+			}
+			v := sum / float64(count)
+			dps = append(dps, [2]*float64{&v, &t})
+		}
+		if g.mutate != nil {
+			dps = g.mutate(target, dps)
+		}
+		response = append(response, renderSeries{Target: target, Datapoints: dps})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func verifyConfig(t *testing.T) []generator.Generators {
+	general := General{Step: 60, Value: 10, Deviation: 3, Probability: 100, Randomize: true, start: 1700000000, stop: 1700003600}
+	c := Config{General: general, Counter: []string{"a.{1..3}"}, Random: []string{"b;tag=value"}}
+	ggg, err := c.ToGenerators()
+	require.NoError(t, err)
+	return ggg
+}
+
+func TestVerify(t *testing.T) {
+	defer generator.ResetSeed()
+	generator.SetSeed(7)
+	r := receiver.New(true)
+	for _, gg := range verifyConfig(t) {
+		_, err := gg.WriteAllTo(r)
+		require.NoError(t, err)
+	}
+	standIn := &graphiteStandIn{r: r, step: 60}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	v := &verifier{
+		client:      &http.Client{Timeout: time.Second},
+		renderURL:   server.URL + "/render",
+		tolerance:   1e-6,
+		aggregation: storage.Average,
+		batch:       2,
+	}
+	run := func() *verifyReport {
+		report := &verifyReport{}
+		ggg := verifyConfig(t)
+		for i := range ggg {
+			require.NoError(t, v.verifyGroup(context.Background(), &ggg[i], report))
+		}
+		return report
+	}
+
+	report := run()
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 4, report.Series)
+	assert.Equal(t, 4*61, report.Expected)
+	assert.Equal(t, []string{"a.1", "a.2", "a.3", "seriesByTag('name=b','tag=value')"}, standIn.targets,
+		"the series are queried by batches, and the tagged ones by seriesByTag")
+
+	// the rollup to the bigger step
+	standIn.step = 600
+	report = run()
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 4*7, report.Expected)
+	v.aggregation = storage.Sum
+	report = run()
+	assert.Len(t, report.Problems, 4)
+	v.aggregation = storage.Average
+	standIn.step = 60
+
+	standIn.mutate = func(target string, dps [][2]*float64) [][2]*float64 {
+		switch target {
+		case "a.1":
+			// the point is lost
+			dps[10][0] = nil
+		case "a.2":
+			v := *dps[20][0] + 1
+			dps[20][0] = &v
+		case "a.3":
+			// the series is returned only partially
+			return dps[:len(dps)-3]
+		case "b;tag=value":
+			for i := range dps {
+				if dps[i][0] == nil {
+					v := 0.0
+					dps[i][0] = &v
+				}
+			}
+		}
+		return dps
+	}
+	report = run()
+	require.Len(t, report.Problems, 3)
+	assert.Equal(t, seriesVerification{Name: "a.1", Step: 60, Expected: 61, Missing: 1, Problem: report.Problems[0].Problem}, report.Problems[0])
+	assert.Contains(t, report.Problems[0].Problem, "missing at ")
+	assert.Equal(t, 1, report.Problems[1].Mismatched)
+	assert.Contains(t, report.Problems[1].Problem, "expected ")
+	assert.Equal(t, 3, report.Problems[2].Missing)
+	assert.Equal(t, 4, report.Missing)
+	// b is randomized, so the extra nulls are out of expected intervals
+	assert.Zero(t, report.Extra)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, report.write(buf, "json"))
+	decoded := &verifyReport{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), decoded))
+	assert.Equal(t, report, decoded)
+	buf.Reset()
+	require.NoError(t, report.write(buf, "text"))
+	assert.Contains(t, buf.String(), "total 4")
+
+	server.Close()
+	assert.Error(t, v.verifyGroup(context.Background(), &verifyConfig(t)[0], &verifyReport{}))
+}
+
+func TestVerifyCompare(t *testing.T) {
+	v := &verifier{tolerance: 0.1, aggregation: storage.Average}
+	f := func(v float64) *float64 { return &v }
+	expected := []generator.Point{
+		generator.NewPoint("m", 1, 60),
+		generator.NewPoint("m", 2, 120),
+		generator.NewPoint("m", 3, 180),
+	}
+	sv := v.compare("m", expected, renderSeries{Datapoints: [][2]*float64{
+		{f(5), f(0)}, {f(1.05), f(60)}, {f(7), f(90)}, {f(2.5), f(120)}, {f(3), f(180)}, {f(5), f(240)},
+	}}, 60)
+	// the step is detected by the first two points, 90 isn't an interval
+	assert.Equal(t, seriesVerification{Name: "m", Step: 60, Expected: 3, Mismatched: 1, Extra: 1, Problem: "extra 7 at 90"}, sv)
+
+	sv = v.compare("m", expected, renderSeries{}, 60)
+	assert.Equal(t, seriesVerification{Name: "m", Step: 60, Expected: 3, Missing: 3, Problem: "missing at 60"}, sv)
+
+	// avg_zero counts the missing points of the interval as zeros
+	v.aggregation = storage.AvgZero
+	sv = v.compare("m", expected[1:], renderSeries{Datapoints: [][2]*float64{{f(2.0 / 3), f(0)}, {nil, f(180)}}}, 60)
+	assert.Equal(t, seriesVerification{Name: "m", Step: 180, Expected: 2, Missing: 1, Problem: "missing at 180"}, sv)
+}
+
+func TestRenderTarget(t *testing.T) {
+	assert.Equal(t, "metric.name", renderTarget(generator.NewPoint("metric.name", 0, 0)))
+	assert.Equal(t, "seriesByTag('name=metric.name','app=web','dc=west')",
+		renderTarget(generator.NewPoint("metric.name;dc=west;app=web", 0, 0)))
+}
@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/whisper"
+)
+
+const (
+	defaultWhisperRetentions = "60:1440"
+	// whisperFlushPoints is the amount of buffered points to flush them to files
+	whisperFlushPoints = 100000
+	// whisperFlushInterval is the maximum time to keep points in the buffer, it matters for the online mode
+	whisperFlushInterval = 10 * time.Second
+	// whisperPointSize is the size of the point in whisper archives
+	whisperPointSize = 12
+)
+
+// whisperWriter writes points of generators to whisper files under the root directory, like carbon-cache with the
+// single storage schema does. Points are buffered per series and written in bulk.
+type whisperWriter struct {
+	root         string
+	retentions   []whisper.Retention
+	aggregation  whisper.AggregationMethod
+	xFilesFactor float32
+	now          func() time.Time
+
+	mu        sync.Mutex
+	points    map[string][]whisper.Point
+	buffered  int
+	lastFlush time.Time
+}
+
+// newWhisperWriter returns the writer for URL 'whisper://path/to/storage?retentions=10s:1d,1m:7d&aggregation=sum&xff=0.5'.
+// The path is relative for 'whisper://path' and absolute for 'whisper:///path'.
+func newWhisperWriter(u *url.URL) (*whisperWriter, error) {
+	root := u.Host + u.Path
+	if root == "" {
+		return nil, fmt.Errorf("the storage path is empty in %s", u.Redacted())
+	}
+	q := u.Query()
+	rr, err := whisperRetentions(q)
+	if err != nil {
+		return nil, err
+	}
+	aggregation := whisper.Average
+	if name := q.Get("aggregation"); name != "" {
+		if aggregation, err = whisper.ParseAggregation(name); err != nil {
+			return nil, err
+		}
+	}
+	xff := 0.5
+	if v := q.Get("xff"); v != "" {
+		if xff, err = strconv.ParseFloat(v, 32); err != nil || xff < 0 || 1 < xff {
+			return nil, fmt.Errorf("xff %q must be a number in [0,1]", v)
+		}
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	return &whisperWriter{
+		root:         root,
+		retentions:   rr,
+		aggregation:  aggregation,
+		xFilesFactor: float32(xff),
+		now:          time.Now,
+		points:       make(map[string][]whisper.Point),
+		lastFlush:    time.Now(),
+	}, nil
+}
+
+// whisperRetentions returns the retentions of the URL query, or the default ones
+func whisperRetentions(q url.Values) ([]whisper.Retention, error) {
+	retentions := q.Get("retentions")
+	if retentions == "" {
+		retentions = defaultWhisperRetentions
+	}
+	return whisper.ParseRetentions(retentions)
+}
+
+// whisperPath returns the file of the metric like carbon-cache does: dots are directories, and tagged series are
+// stored under _tagged directory by the hash of the normalized name.
+func whisperPath(root, metric string) string {
+	if !strings.Contains(metric, ";") {
+		return filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(metric, ".", "/"))+".wsp")
+	}
+	normalized := generator.NewPoint(metric, 0, 0).Path()
+	sum := sha256.Sum256([]byte(normalized))
+	hash := hex.EncodeToString(sum[:])
+	name := strings.ReplaceAll(normalized, ".", "_DOT_")
+	return filepath.Join(root, "_tagged", hash[0:3], hash[3:6], name+".wsp")
+}
+
+// Write returns errPointsOnly, the generators write points to the whisperWriter with WritePoints
+func (w *whisperWriter) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("%w: whisper", errPointsOnly)
+}
+
+// WritePoints buffers the points and writes them to files when the buffer is full or old enough. The sub-second
+// timestamps are truncated to seconds.
+func (w *whisperWriter) WritePoints(points []generator.Point) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, p := range points {
+		if uint(^uint32(0)) < p.Timestamp {
+			return 0, fmt.Errorf("timestamp of %s is out of whisper range", p)
+		}
+	}
+	for _, p := range points {
+		path := p.Path()
+		w.points[path] = append(w.points[path], whisper.Point{Timestamp: uint32(p.Timestamp), Value: p.Value})
+	}
+	w.buffered += len(points)
+	if w.buffered >= whisperFlushPoints || whisperFlushInterval <= time.Since(w.lastFlush) {
+		return len(points) * whisperPointSize, w.flush()
+	}
+	return len(points) * whisperPointSize, nil
+}
+
+// flush writes all buffered points to files, the missing files are created
+func (w *whisperWriter) flush() error {
+	now := uint32(w.now().Unix())
+	var errs []error
+	for metric, points := range w.points {
+		if err := w.update(whisperPath(w.root, metric), points, now); err != nil {
+			errs = append(errs, fmt.Errorf("unable to write %s: %w", metric, err))
+		}
+	}
+	clear(w.points)
+	w.buffered = 0
+	w.lastFlush = time.Now()
+	return errors.Join(errs...)
+}
+
+func (w *whisperWriter) update(path string, points []whisper.Point, now uint32) error {
+	wsp, err := whisper.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		wsp, err = whisper.Create(path, w.retentions, w.aggregation, w.xFilesFactor)
+	}
+	if err != nil {
+		return err
+	}
+	if err := wsp.UpdateMany(points, now); err != nil {
+		wsp.Close()
+		return err
+	}
+	return wsp.Close()
+}
+
+// Close writes all buffered points to files
+func (w *whisperWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/generator"
+	"github.com/Felixoid/coal-mine/whisper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhisperPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("root", "a", "b", "c.wsp"), whisperPath("root", "a.b.c"))
+	// tags are sorted before hashing like carbon does
+	expected := filepath.Join("root", "_tagged", "fd5", "5c2", "a_DOT_b;x=1;y=2.wsp")
+	assert.Equal(t, expected, whisperPath("root", "a.b;y=2;x=1"))
+	assert.Equal(t, expected, whisperPath("root", "a.b;x=1;y=2"))
+}
+
+func TestNewWhisperWriter(t *testing.T) {
+	dir := t.TempDir()
+	for _, bad := range []string{"whisper://", "whisper://" + dir + "?retentions=1m", "whisper://" + dir + "?aggregation=median", "whisper://" + dir + "?xff=2"} {
+		u, err := url.Parse(bad)
+		require.NoError(t, err)
+		_, err = newWhisperWriter(u)
+		assert.Error(t, err, bad)
+	}
+	c := Config{Carbon: "whisper://" + dir + "?retentions=10s:1h,1m:1d&aggregation=max&xff=0"}
+	w, err := c.GetCarbonWriter()
+	require.NoError(t, err)
+	ww := w.(*whisperWriter)
+	assert.Equal(t, []whisper.Retention{{SecondsPerPoint: 10, Points: 360}, {SecondsPerPoint: 60, Points: 1440}}, ww.retentions)
+	assert.Equal(t, whisper.Max, ww.aggregation)
+	assert.Equal(t, float32(0), ww.xFilesFactor)
+}
+
+func TestWhisperWriter(t *testing.T) {
+	dir := t.TempDir()
+	u, err := url.Parse("whisper://" + dir + "?retentions=1m:1h,5m:1d&aggregation=sum")
+	require.NoError(t, err)
+	w, err := newWhisperWriter(u)
+	require.NoError(t, err)
+	now := time.Unix(1_000_000_200, 0)
+	w.now = func() time.Time { return now }
+
+	general := General{Step: 60, Value: 1, Probability: 100, start: 999_999_600, stop: 1_000_000_080}
+	c := Config{General: general, Const: []string{"a.{1..2}"}, Counter: []string{"b;tag=value"}}
+	groups, err := c.backfillGroups(false)
+	require.NoError(t, err)
+	for _, gg := range groups {
+		_, err := gg.WriteAllToWithContext(context.Background(), w)
+		require.NoError(t, err)
+	}
+	_, err = w.Write([]byte("a.1 5 999999600\n"))
+	assert.ErrorIs(t, err, errPointsOnly)
+	n, err := w.WritePoints([]generator.Point{generator.NewPoint("a.1", 5, 999_999_600)})
+	require.NoError(t, err)
+	assert.Equal(t, whisperPointSize, n)
+	_, err = w.WritePoints([]generator.Point{generator.NewPoint("a.1", 6, 999_999_660), generator.NewPoint("a.1", 7, 1<<32)})
+	assert.Error(t, err, "the timestamp is out of range")
+	require.NoError(t, w.Close())
+
+	read := func(metric string, from uint32) []whisper.Point {
+		wsp, err := whisper.Open(whisperPath(dir, metric))
+		require.NoError(t, err)
+		defer wsp.Close()
+		s, err := wsp.Fetch(from, uint32(now.Unix()), uint32(now.Unix()))
+		require.NoError(t, err)
+		return s.Points()
+	}
+	points := read("a.1", 999_999_000)
+	require.Len(t, points, 10)
+	assert.Equal(t, whisper.Point{Timestamp: 999_999_600, Value: 5}, points[0], "the last written value is kept")
+	assert.Equal(t, whisper.Point{Timestamp: 1_000_000_140, Value: 1}, points[9])
+	assert.Len(t, read("a.2", 999_999_000), 10)
+
+	// rollups of the counter 1..10 with the sum aggregation
+	assert.Equal(t, []whisper.Point{
+		{Timestamp: 999_999_600, Value: 1 + 2 + 3 + 4 + 5},
+		{Timestamp: 999_999_900, Value: 6 + 7 + 8 + 9 + 10},
+	}, read("b;tag=value", 999_990_000))
+}
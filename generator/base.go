@@ -4,8 +4,9 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
-	"strconv"
+	"time"
 )
 
 // Type represents the generator type
@@ -23,6 +24,8 @@ const (
 	CounterType
 	// RandomType represents metrics with random values
 	RandomType
+	// ReplayType represents metrics with values of the series loaded from a file
+	ReplayType
 	endType
 )
 
@@ -31,6 +34,7 @@ var typesMap map[string]Type = map[string]Type{
 	"const":     ConstType,
 	"counter":   CounterType,
 	"random":    RandomType,
+	"replay":    ReplayType,
 }
 
 var types []string
@@ -49,24 +53,113 @@ func initTypes() {
 	}
 }
 
-// GetType returns the Type by name or rises ErrWrongType error if name is invalid
+// GetType returns the Type by name or rises ErrWrongType error if name is invalid. The types added by Register are
+// valid as well.
 func GetType(typeName string) (Type, error) {
-	var t Type = 0
-	var ok bool
-	if t, ok = typesMap[typeName]; !ok {
-		return t, fmt.Errorf("%w: %s not in %v", ErrWrongType, typeName, types)
+	if t, ok := typesMap[typeName]; ok {
+		return t, nil
+	}
+	registryMu.RLock()
+	t, ok := registered[typeName]
+	registryMu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("%w: %s not in %v", ErrWrongType, typeName, TypeNames())
 	}
 	return t, nil
 }
 
+// ErrStep is returned for meaningless sub-second steps and jitter
+var ErrStep = fmt.Errorf("step is not valid")
+
+// Jitter distributions of Spec.JitterDistribution
+const (
+	JitterUniform = "uniform"
+	JitterNormal  = "normal"
+)
+
+// CheckInterval returns ErrStep if the sub-second step is less than a millisecond, the jitter is negative, or its
+// distribution is unknown
+func CheckInterval(interval, jitter time.Duration, distribution string) error {
+	if interval != 0 && interval < time.Millisecond {
+		return fmt.Errorf("%w: interval %s is less than 1ms", ErrStep, interval)
+	}
+	if jitter < 0 {
+		return fmt.Errorf("%w: jitter %s is negative", ErrStep, jitter)
+	}
+	switch distribution {
+	case "", JitterUniform, JitterNormal:
+		return nil
+	}
+	return fmt.Errorf("%w: jitter distribution %q is not %s or %s", ErrStep, distribution, JitterUniform, JitterNormal)
+}
+
+// nextTime moves the time to the next point. The step is added verbatim, unless the sub-second interval or the
+// jitter is set. Then the time is calculated in milliseconds.
 func (b *base) nextTime() error {
-	if b.time > b.stop {
+	if b.timeMillis() > b.stopMillis() {
 		return ErrGenOver
 	}
-	b.time += b.step
+	if b.interval == 0 && b.jitter == 0 {
+		b.time += b.step
+		return nil
+	}
+	next := b.timeMillis() + b.nextInterval()
+	b.time, b.ms = next/1000, next%1000
 	return nil
 }
 
+// nextInterval returns the interval to the next point in milliseconds with the jitter, at least 1ms
+func (b *base) nextInterval() uint {
+	interval := int(b.interval)
+	if interval == 0 {
+		interval = int(b.step) * 1000
+	}
+	if b.jitter != 0 {
+		jitter := int(b.jitter)
+		switch b.jitterDistribution {
+		case JitterNormal:
+			interval += int(math.Round(randNormFloat64(b.rand) * float64(jitter)))
+		default:
+			interval += randIntn(b.rand, 2*jitter+1) - jitter
+		}
+	}
+	return uint(max(interval, 1))
+}
+
+func (b *base) timeMillis() uint {
+	return b.time*1000 + b.ms
+}
+
+func (b *base) stopMillis() uint {
+	return b.stop*1000 + b.stopMs
+}
+
+// CountPoints returns the amount of points a generator produces from start to stop with the step, without
+// randomized start and probability. It follows the nextTime logic, so the first point after the stop is produced as
+// well. The zero step means no points.
+func CountPoints(start, stop, step uint) uint64 {
+	if step == 0 {
+		return 0
+	}
+	if stop < start {
+		return 1
+	}
+	return uint64((stop-start)/step) + 2
+}
+
+// CountPointsInterval is CountPoints for the interval with millisecond precision. The jitter isn't taken into
+// account, so the result is the expected amount of points.
+func CountPointsInterval(start, stop uint, interval time.Duration) uint64 {
+	ms := uint64(interval.Milliseconds())
+	if ms == 0 {
+		return 0
+	}
+	if stop < start {
+		return 1
+	}
+	return uint64(stop-start)*1000/ms + 2
+}
+
 // Probability returns true if doble b.probability more than 100
 func (b *base) checkProbability() bool {
 	if b.probability.start == 100 {
@@ -79,6 +172,15 @@ func (b *base) checkProbability() bool {
 	}
 	return false
 }
+
+// CheckProbability returns ErrProbabilityStart if the probability is not in [1,100]
+func CheckProbability(probability uint8) error {
+	if !probabilityIsCorrect(probability) {
+		return fmt.Errorf("%w: %d is not in [1,100]", ErrProbabilityStart, probability)
+	}
+	return nil
+}
+
 func probabilityIsCorrect(probabilityStart uint8) bool {
 	if probabilityStart > 100 || probabilityStart < 1 {
 		return false
@@ -87,15 +189,26 @@ func probabilityIsCorrect(probabilityStart uint8) bool {
 }
 
 type base struct {
-	name          string
+	name string
+	// point is the current point with the parsed name, it's parsed once per name
+	point         Point
 	generatorType Type
 	start         uint
 	stop          uint
 	step          uint
 	time          uint
-	value         float64
-	deviation     float64
-	probability   Probability
+	// ms and stopMs are milliseconds of time and stop for sub-second intervals
+	ms     uint
+	stopMs uint
+	// interval and jitter are in milliseconds, the zero interval means the step in seconds
+	interval           uint
+	jitter             uint
+	jitterDistribution string
+	value              float64
+	deviation          float64
+	probability        Probability
+	rand               *rand.Rand
+	source             *splitMix64
 }
 
 type Probability struct {
@@ -104,11 +217,11 @@ type Probability struct {
 }
 
 // Randomize first current
-func newProbability(probabilityStart uint8) Probability {
+func newProbability(r *rand.Rand, probabilityStart uint8) Probability {
 
 	return Probability{
 		start:   probabilityStart,
-		current: uint8(rand.Intn(100))}
+		current: uint8(randIntn(r, 100))}
 }
 
 // Point returns the metric in carbon format, e.g. 'metric.name 123.33 1234567890\n'
@@ -119,17 +232,26 @@ func (b *base) Point() []byte {
 }
 
 func (b *base) WriteTo(w io.Writer) (int64, error) {
-	if !b.checkProbability() {
+	if b.drop() {
 		return 0, nil
 	}
-	buf := new(bytes.Buffer)
-	buf.WriteString(b.Name())
-	buf.WriteString(" ")
-	buf.WriteString(strconv.FormatFloat(b.Value(), 'f', -1, 64))
-	buf.WriteString(" ")
-	buf.WriteString(strconv.Itoa(int(b.Time())))
-	buf.WriteString("\n")
-	return buf.WriteTo(w)
+	n, err := w.Write(b.Current().AppendCarbon(nil))
+	return int64(n), err
+}
+
+// Current returns the current point
+func (b *base) Current() Point {
+	if b.point.raw != b.name || b.name == "" {
+		b.point = NewPoint(b.name, 0, 0)
+	}
+	p := b.point
+	p.Value, p.Timestamp, p.Millis = b.value, b.time, b.ms
+	return p
+}
+
+// drop reports if the current point is dropped by probability
+func (b *base) drop() bool {
+	return !b.checkProbability()
 }
 
 // WithName sets the metric name for generator
@@ -167,6 +289,13 @@ func (b *base) Step() uint {
 // SetStop sets stop to a given value
 func (b *base) SetStop(stop uint) {
 	b.stop = stop
+	b.stopMs = 0
+}
+
+// SetStopTime sets stop with millisecond precision
+func (b *base) SetStopTime(t time.Time) {
+	b.stop = uint(t.Unix())
+	b.stopMs = uint(t.Nanosecond() / int(time.Millisecond))
 }
 
 // Stop returns value of stop field for the generator
@@ -195,9 +324,28 @@ func (b *base) Deviation() float64 {
 	return b.deviation
 }
 
+// tune sets the common parameters of the generator. The step isn't used by generators with the sub-second interval.
+func (b *base) tune(step uint, deviation float64, probability uint8) error {
+	if !probabilityIsCorrect(probability) {
+		return ErrProbabilityStart
+	}
+	b.step = step
+	b.deviation = deviation
+	b.probability.start = probability
+	return nil
+}
+
+// RandomizeStart sets the time to the start, shifted with [0,step) when randomizeStart is true. The sub-second
+// interval shifts the start with milliseconds.
 func (b *base) RandomizeStart(randomizeStart bool) {
-	b.time = b.start
-	if randomizeStart {
-		b.time = b.start + uint(rand.Intn(int(b.step)))
+	b.time, b.ms = b.start, 0
+	if !randomizeStart {
+		return
+	}
+	if b.interval != 0 {
+		offset := uint(randIntn(b.rand, int(b.interval)))
+		b.time, b.ms = b.start+offset/1000, offset%1000
+		return
 	}
+	b.time = b.start + uint(randIntn(b.rand, int(b.step)))
 }
@@ -1,13 +1,17 @@
 package generator
 
 import (
+	"bytes"
 	"testing"
+	"time"
 
+	"github.com/Felixoid/coal-mine/receiver"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestType(t *testing.T) {
-	assert.Equal(t, []string{"undefined", "const", "counter", "random"}, types)
+	assert.Equal(t, []string{"undefined", "const", "counter", "random", "replay"}, types)
 
 	// Check logic for predefined types
 	backupMap := map[string]Type{}
@@ -105,3 +109,129 @@ func TestBaseCheckProbability(t *testing.T) {
 		assert.Equal(t, b.probability.current, 2*iter-100)
 	}
 }
+
+func TestCheckProbability(t *testing.T) {
+	for _, p := range []uint8{1, 50, 100} {
+		assert.NoError(t, CheckProbability(p))
+	}
+	for _, p := range []uint8{0, 101, 255} {
+		assert.ErrorIs(t, CheckProbability(p), ErrProbabilityStart)
+	}
+}
+
+func TestCountPoints(t *testing.T) {
+	for _, c := range [][3]uint{{0, 10, 5}, {0, 9, 5}, {0, 0, 5}, {5, 0, 5}, {100, 160, 60}, {1, 2, 1}} {
+		gg, err := NewExpand("const", "metric.name", c[0], c[1], c[2], false, 1, 0, 100)
+		assert.NoError(t, err)
+		r := receiver.New(false)
+		_, err = gg.WriteAllTo(r)
+		assert.NoError(t, err)
+		assert.Equal(t, r.Stats().Points, CountPoints(c[0], c[1], c[2]), c)
+		assert.Zero(t, r.Stats().Malformed)
+	}
+	assert.Zero(t, CountPoints(0, 10, 0))
+}
+
+func TestCountPointsInterval(t *testing.T) {
+	for _, c := range [][2]uint{{0, 10}, {0, 9}, {0, 0}, {5, 0}, {100, 160}} {
+		for _, interval := range []time.Duration{time.Second, 500 * time.Millisecond, 1500 * time.Millisecond} {
+			gg, err := NewExpandFromSpec(NewSpec("const", "metric.name", WithRange(c[0], c[1]), WithStep(2),
+				WithInterval(interval)))
+			require.NoError(t, err)
+			r := receiver.New(false)
+			_, err = gg.WriteAllTo(r)
+			require.NoError(t, err)
+			assert.Equal(t, r.Stats().Points, CountPointsInterval(c[0], c[1], interval), c, interval)
+		}
+	}
+	assert.Equal(t, CountPoints(100, 160, 60), CountPointsInterval(100, 160, time.Minute))
+	assert.Zero(t, CountPointsInterval(0, 10, 0))
+}
+
+func TestCheckInterval(t *testing.T) {
+	assert.NoError(t, CheckInterval(0, 0, ""))
+	assert.NoError(t, CheckInterval(time.Millisecond, time.Second, JitterNormal))
+	assert.ErrorIs(t, CheckInterval(time.Microsecond, 0, ""), ErrStep)
+	assert.ErrorIs(t, CheckInterval(0, -time.Second, ""), ErrStep)
+	assert.ErrorIs(t, CheckInterval(0, time.Second, "gamma"), ErrStep)
+	_, err := NewFromSpec(NewSpec("const", "metric", WithInterval(time.Microsecond)))
+	assert.ErrorIs(t, err, ErrStep)
+	assert.ErrorIs(t, NewSpec("const", "metric", WithJitter(time.Second, "gamma")).Validate(), ErrStep)
+}
+
+func TestBaseInterval(t *testing.T) {
+	// the sub-second interval produces timestamps with milliseconds, the point after the stop is produced as well
+	gg, err := NewExpandFromSpec(NewSpec("const", "metric", WithRange(100, 101), WithInterval(400*time.Millisecond), WithValue(1)))
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "metric 1 100\nmetric 1 100.400\nmetric 1 100.800\nmetric 1 101.200\n", buf.String())
+	assert.Equal(t, 400*time.Millisecond, gg.Interval())
+
+	gg, err = NewExpandFromSpec(NewSpec("const", "metric", WithRange(100, 101), WithStep(1)))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, gg.Interval(), "the step is the interval without sub-second one")
+
+	// the randomized start is shifted with milliseconds
+	shifted := false
+	for range 100 {
+		g, err := NewFromSpec(NewSpec("const", "metric", WithRange(100, 101), WithInterval(400*time.Millisecond), WithRandomize(true)))
+		require.NoError(t, err)
+		p := g.Current()
+		assert.Equal(t, uint(100), p.Timestamp)
+		assert.Less(t, p.Millis, uint(400))
+		shifted = shifted || p.Millis != 0
+	}
+	assert.True(t, shifted)
+}
+
+func TestBaseJitter(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	for _, distribution := range []string{JitterUniform, JitterNormal} {
+		g, err := NewFromSpec(NewSpec("const", "metric", WithRange(0, 100000), WithStep(10), WithJitter(2*time.Second, distribution)))
+		require.NoError(t, err)
+		var intervals []int
+		prev := g.Current()
+		for g.Next() == nil {
+			p := g.Current()
+			intervals = append(intervals, int(p.Timestamp*1000+p.Millis)-int(prev.Timestamp*1000+prev.Millis))
+			prev = p
+		}
+		sum, minInterval, maxInterval := 0, intervals[0], intervals[0]
+		for _, i := range intervals {
+			sum += i
+			minInterval, maxInterval = min(minInterval, i), max(maxInterval, i)
+		}
+		assert.InDelta(t, 10000, sum/len(intervals), 100, distribution)
+		assert.Less(t, minInterval, 8500, distribution)
+		assert.Greater(t, maxInterval, 11500, distribution)
+		if distribution == JitterUniform {
+			assert.LessOrEqual(t, 8000, minInterval)
+			assert.LessOrEqual(t, maxInterval, 12000)
+		}
+	}
+}
+
+func TestBaseStopTime(t *testing.T) {
+	g, err := NewFromSpec(NewSpec("const", "metric", WithRange(100, 100), WithInterval(300*time.Millisecond)))
+	require.NoError(t, err)
+	gg := Generators{gens: []Generator{g}}
+	gg.SetStopTime(time.UnixMilli(100500))
+	var timestamps []uint
+	for p := range Points(g) {
+		timestamps = append(timestamps, p.Timestamp*1000+p.Millis)
+	}
+	assert.Equal(t, []uint{100000, 100300, 100600}, timestamps, "the first point after the stop is produced")
+
+	// the stop of generators with whole seconds is truncated
+	g, err = NewFromSpec(NewSpec("const", "metric", WithRange(100, 100), WithStep(1)))
+	require.NoError(t, err)
+	setStopTime(g, time.UnixMilli(101500))
+	timestamps = timestamps[:0]
+	for p := range Points(g) {
+		timestamps = append(timestamps, p.Timestamp)
+	}
+	assert.Equal(t, []uint{100, 101, 102}, timestamps)
+}
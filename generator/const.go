@@ -1,9 +1,5 @@
 package generator
 
-import (
-	"math/rand"
-)
-
 // Const represents generator for constant values. When deviation is set, each value is calculated around the first value
 type Const struct {
 	base
@@ -12,23 +8,19 @@ type Const struct {
 
 // NewConst returns new generator for constant points. Possibly it can randomize values around constant.
 func NewConst(name string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (*Const, error) {
-	if !probabilityIsCorrect(probabilityStart) {
-		return nil, ErrProbabilityStart
+	return newConst(positionalSpec("const", name, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// newConst returns new Const for the spec
+func newConst(s Spec) (*Const, error) {
+	if err := CheckProbability(s.Probability); err != nil {
+		return nil, err
 	}
 	c := &Const{
-		base: base{
-			name:          name,
-			generatorType: ConstType,
-			start:         start,
-			stop:          stop,
-			step:          step,
-			value:         value,
-			deviation:     deviation,
-			probability:   newProbability(probabilityStart),
-		},
-		constant: value,
+		base:     newBase(s, ConstType),
+		constant: s.Value,
 	}
-	c.RandomizeStart(randomizeStart)
+	c.RandomizeStart(s.Randomize)
 	return c, nil
 }
 
@@ -40,7 +32,16 @@ func (c *Const) Next() error {
 	}
 	c.value = c.constant
 	if c.Deviation() != 0 {
-		c.value = c.constant + c.Deviation()*(1-rand.Float64()*2)
+		c.value = c.constant + c.Deviation()*(1-randFloat64(c.rand)*2)
+	}
+	return nil
+}
+
+// Tune sets new parameters for the generator, the value is used as the new constant
+func (c *Const) Tune(step uint, value, deviation float64, probability uint8) error {
+	if err := c.tune(step, deviation, probability); err != nil {
+		return err
 	}
+	c.constant = value
 	return nil
 }
@@ -68,3 +68,14 @@ func TestConstNext(t *testing.T) {
 	}
 	assert.True(t, randomized)
 }
+
+func TestConstTune(t *testing.T) {
+	c, err := NewConst("metric.name", 12, 15, 1, false, 30, 0, 100)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Tune(5, 12, 1, 30))
+	assert.Equal(t, uint(5), c.step)
+	assert.Equal(t, float64(12), c.constant)
+	assert.Equal(t, float64(1), c.deviation)
+	assert.Equal(t, uint8(30), c.probability.start)
+	assert.ErrorIs(t, c.Tune(5, 12, 1, 101), ErrProbabilityStart)
+}
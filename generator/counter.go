@@ -3,7 +3,6 @@ package generator
 import (
 	"fmt"
 	"math"
-	"math/rand"
 )
 
 // Counter represents generator for growing-up metrics
@@ -16,29 +15,45 @@ type Counter struct {
 // Possibly it can randomize values around increment.
 // When deviation is set, it the next value won't be less then previous.
 func NewCounter(name string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (*Counter, error) {
-	if value < 0 && math.Abs(deviation) <= math.Abs(value) {
-		return nil, fmt.Errorf("%w: with negative value deviation (%f) must be greater than value (%f)", ErrNewCounter, deviation, value)
+	return newCounter(positionalSpec("counter", name, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// newCounter returns new Counter for the spec
+func newCounter(s Spec) (*Counter, error) {
+	if err := CheckCounter(s.Value, s.Deviation); err != nil {
+		return nil, err
 	}
-	if !probabilityIsCorrect(probabilityStart) {
-		return nil, ErrProbabilityStart
+	if err := CheckProbability(s.Probability); err != nil {
+		return nil, err
 	}
 	c := &Counter{
-		base: base{
-			name:          name,
-			generatorType: CounterType,
-			start:         start,
-			stop:          stop,
-			step:          step,
-			value:         value,
-			deviation:     deviation,
-			probability:   newProbability(probabilityStart),
-		},
-		increment: value,
-	}
-	c.RandomizeStart(randomizeStart)
+		base:      newBase(s, CounterType),
+		increment: s.Value,
+	}
+	c.RandomizeStart(s.Randomize)
 	return c, nil
 }
 
+// CheckCounter returns ErrNewCounter if the value and the deviation are meaningless for the counter generator
+func CheckCounter(value, deviation float64) error {
+	if value < 0 && math.Abs(deviation) <= math.Abs(value) {
+		return fmt.Errorf("%w: with negative value deviation (%f) must be greater than value (%f)", ErrNewCounter, deviation, value)
+	}
+	return nil
+}
+
+// Tune sets new parameters for the generator, the value is used as the new increment
+func (c *Counter) Tune(step uint, value, deviation float64, probability uint8) error {
+	if err := CheckCounter(value, deviation); err != nil {
+		return err
+	}
+	if err := c.tune(step, deviation, probability); err != nil {
+		return err
+	}
+	c.increment = value
+	return nil
+}
+
 // Next sets value and time for the next point
 func (c *Counter) Next() error {
 	err := c.nextTime()
@@ -49,7 +64,7 @@ func (c *Counter) Next() error {
 		c.value += c.increment
 		return nil
 	}
-	increment := c.increment + c.Deviation()*(1-rand.Float64()*2)
+	increment := c.increment + c.Deviation()*(1-randFloat64(c.rand)*2)
 	if 0 < increment {
 		c.value += increment
 	}
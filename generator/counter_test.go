@@ -157,3 +157,22 @@ func TestCounterNext(t *testing.T) {
 	assert.NotEqual(t, float64(56), c.value)
 	assert.True(t, zero)
 }
+
+func TestCounterTune(t *testing.T) {
+	c, err := NewCounter("metric.name", 12, 15, 1, false, 30, 0, 100)
+	assert.NoError(t, err)
+	assert.NoError(t, c.Tune(5, 12, 1, 30))
+	assert.Equal(t, uint(5), c.step)
+	assert.Equal(t, float64(12), c.increment)
+	assert.Equal(t, float64(1), c.deviation)
+	assert.Equal(t, uint8(30), c.probability.start)
+	assert.ErrorIs(t, c.Tune(5, -12, 1, 30), ErrNewCounter)
+	assert.Equal(t, float64(12), c.increment)
+}
+
+func TestCheckCounter(t *testing.T) {
+	assert.NoError(t, CheckCounter(1, 0))
+	assert.NoError(t, CheckCounter(-1, 2))
+	assert.ErrorIs(t, CheckCounter(-1, 1), ErrNewCounter)
+	assert.ErrorIs(t, CheckCounter(-2, -1), ErrNewCounter)
+}
@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDisorder is returned for meaningless disorder parameters
+var ErrDisorder = errors.New("invalid disorder")
+
+// Disorder describes the messy timestamps. The zero Disorder keeps points step-aligned, ordered and unique.
+type Disorder struct {
+	// Duplicates is the percent of points sent twice, the second point has the same timestamp and a different value
+	Duplicates uint8
+	// Shuffle is the window in seconds, inside which points are reordered. It should be bigger than the step.
+	Shuffle uint
+	// ClockSkew is the maximal skew of series in seconds, each series has a constant skew in [-ClockSkew,ClockSkew]
+	ClockSkew uint
+}
+
+// enabled reports if any disorder is set
+func (d Disorder) enabled() bool {
+	return d.Duplicates != 0 || d.Shuffle != 0 || d.ClockSkew != 0
+}
+
+// Check returns ErrDisorder if the percent of duplicates isn't in [0,100]
+func (d Disorder) Check() error {
+	if 100 < d.Duplicates {
+		return fmt.Errorf("%w: duplicates %d is not in [0,100]", ErrDisorder, d.Duplicates)
+	}
+	return nil
+}
+
+// skew returns the constant skew of the series in [-ClockSkew,ClockSkew]
+func (d Disorder) skew(name string) int {
+	if d.ClockSkew == 0 {
+		return 0
+	}
+	r := newRand(newSource("skew:" + name))
+	return randIntn(r, int(2*d.ClockSkew+1)) - int(d.ClockSkew)
+}
+
+// skewed returns the timestamp shifted by the skew, the timestamps before the epoch are 0
+func skewed(ts uint, skew int) uint {
+	if skew < 0 && ts < uint(-skew) {
+		return 0
+	}
+	return uint(int(ts) + skew)
+}
@@ -0,0 +1,85 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisorderCheck(t *testing.T) {
+	assert.NoError(t, Disorder{Duplicates: 100, Shuffle: 1, ClockSkew: 1}.Check())
+	assert.ErrorIs(t, Disorder{Duplicates: 101}.Check(), ErrDisorder)
+	_, err := NewFromSpec(NewSpec("const", "metric", WithDisorder(Disorder{Duplicates: 101})))
+	assert.ErrorIs(t, err, ErrDisorder)
+	assert.ErrorIs(t, NewSpec("const", "metric", WithDisorder(Disorder{Duplicates: 101})).Validate(), ErrDisorder)
+}
+
+func TestSkewed(t *testing.T) {
+	assert.Equal(t, uint(130), skewed(100, 30))
+	assert.Equal(t, uint(70), skewed(100, -30))
+	assert.Equal(t, uint(0), skewed(10, -30))
+}
+
+func TestDisorderClockSkew(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	spec := NewSpec("const", "metric.{1..5}", WithRange(600, 1200), WithStep(60),
+		WithDisorder(Disorder{ClockSkew: 30}))
+	points, dropped := gapsTimestamps(t, spec)
+	assert.Zero(t, dropped)
+	skews := make(map[int]bool)
+	for name, timestamps := range points {
+		require.Len(t, timestamps, 12, name)
+		skew := int(timestamps[0]) - 600
+		assert.LessOrEqual(t, -30, skew, name)
+		assert.LessOrEqual(t, skew, 30, name)
+		for i, ts := range timestamps {
+			assert.Equal(t, 600+60*i+skew, int(ts), "the skew of %s is constant", name)
+		}
+		skews[skew] = true
+	}
+	assert.Greater(t, len(skews), 1, "each series has own skew")
+}
+
+func TestDisorderDuplicates(t *testing.T) {
+	gg, err := NewExpandFromSpec(NewSpec("random", "metric", WithRange(0, 100), WithStep(10), WithDeviation(0),
+		WithDisorder(Disorder{Duplicates: 100})))
+	require.NoError(t, err)
+	var points []Point
+	for p := range gg.Points() {
+		points = append(points, p)
+	}
+	require.Len(t, points, 2*12)
+	for i := 0; i < len(points); i += 2 {
+		assert.Equal(t, points[i].Timestamp, points[i+1].Timestamp)
+		assert.NotEqual(t, points[i].Value, points[i+1].Value)
+		assert.InDelta(t, points[i].Value, points[i+1].Value, 1)
+	}
+
+	defer ResetSeed()
+	SetSeed(42)
+	timestamps, _ := gapsTimestamps(t, NewSpec("const", "metric", WithRange(0, 10000), WithStep(10),
+		WithDisorder(Disorder{Duplicates: 30})))
+	assert.InDelta(t, 1300, len(timestamps["metric"]), 100)
+}
+
+func TestDisorderShuffle(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	points, _ := gapsTimestamps(t, NewSpec("const", "metric", WithRange(0, 10000), WithStep(10),
+		WithDisorder(Disorder{Shuffle: 60})))
+	timestamps := points["metric"]
+	ordered := true
+	seen := make(map[uint]bool)
+	for i, ts := range timestamps {
+		assert.False(t, seen[ts], "each point is sent once")
+		seen[ts] = true
+		ordered = ordered && (i == 0 || timestamps[i-1] < ts)
+		if i != 0 {
+			assert.Less(t, timestamps[i-1], ts+60, "points are reordered only inside the window")
+		}
+	}
+	assert.False(t, ordered)
+	assert.Greater(t, len(seen), 990)
+}
@@ -0,0 +1,163 @@
+package generator
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// delayedPoint is the point waiting to be sent
+type delayedPoint struct {
+	point Point
+	due   uint
+}
+
+// distorted is the Generator with gaps and disorder. It skips points of outages and silence periods, skews and
+// duplicates points, and postpones the delayed and shuffled points until the time of the generator reaches their due
+// time. The points, which are due after the end of the generation, are sent at once by the extra Next call after the
+// wrapped generator is over.
+type distorted struct {
+	wrapper
+	gaps      Gaps
+	disorder  Disorder
+	deviation float64
+	skew      int
+	outage    *gapSchedule
+	silence   *gapSchedule
+	rand      *rand.Rand
+	messy     *rand.Rand
+	current   []Point
+	pending   []delayedPoint
+	emitted   []Point
+	// over is set when the wrapped generator is over, and the pending points are flushed
+	over bool
+}
+
+// newDistorted wraps the generator created for the spec with its gaps and disorder
+func newDistorted(g Generator, s Spec) *distorted {
+	d := &distorted{
+		wrapper:   wrapper{Generator: g, name: s.Name},
+		gaps:      s.Gaps,
+		disorder:  s.Disorder,
+		deviation: s.Deviation,
+		skew:      s.Disorder.skew(s.Name),
+		outage:    newGapSchedule("outage:"+s.groupName(), s.Gaps.OutageInterval, s.Gaps.OutageLength),
+		silence:   newGapSchedule("silence:"+s.Name, s.Gaps.SilenceInterval, s.Gaps.SilenceLength),
+		rand:      newRand(newSource("delay:" + s.Name)),
+		messy:     newRand(newSource("disorder:" + s.Name)),
+	}
+	d.emitter = d
+	return d
+}
+
+// missing reports if the timestamp is inside any outage or silence period
+func (d *distorted) missing(ts uint) bool {
+	for _, w := range d.gaps.Outages {
+		if w.contains(ts) {
+			return true
+		}
+	}
+	return d.outage.contains(ts) || d.silence.contains(ts)
+}
+
+// delay returns the delay for the next point
+func (d *distorted) delay() uint {
+	delay := float64(d.gaps.Delay)
+	switch d.gaps.DelayDistribution {
+	case DelayUniform:
+		delay *= 2 * randFloat64(d.rand)
+	case DelayExponential:
+		delay *= randExpFloat64(d.rand)
+	}
+	return uint(delay)
+}
+
+// push adds the point sent at the time to the pending points ordered by their due time
+func (d *distorted) push(p Point, time uint) {
+	due := time
+	if d.gaps.Delay != 0 {
+		due += d.delay()
+	}
+	if d.disorder.Shuffle != 0 {
+		due += uint(randIntn(d.messy, int(d.disorder.Shuffle)))
+	}
+	i := sort.Search(len(d.pending), func(i int) bool { return due < d.pending[i].due })
+	d.pending = append(d.pending, delayedPoint{})
+	copy(d.pending[i+1:], d.pending[i:])
+	d.pending[i] = delayedPoint{point: p, due: due}
+}
+
+// duplicate returns the copy of the point with a different value, the difference is in (0,max(|deviation|,1)]
+func (d *distorted) duplicate(p Point) Point {
+	p.Value += max(math.Abs(d.deviation), 1) * (1 - randFloat64(d.messy))
+	return p
+}
+
+// generated returns the points of the wrapped generator at the current time, and reports if the current point is
+// dropped by probability. The probability state is changed for each point, so the gaps don't shift its pattern.
+func (d *distorted) generated() ([]Point, bool) {
+	if e, ok := d.Generator.(emitter); ok {
+		return e.emit()
+	}
+	if isDropped(d.Generator) {
+		return nil, true
+	}
+	d.current = append(d.current[:0], d.Generator.Current())
+	return d.current, false
+}
+
+// Next moves the wrapped generator to the next point. When it's over, Next returns nil once more to flush the pending
+// points, so all generators of the same spec have the same amount of steps.
+func (d *distorted) Next() error {
+	if d.over {
+		return ErrGenOver
+	}
+	err := d.Generator.Next()
+	if errors.Is(err, ErrGenOver) {
+		d.over = true
+		return nil
+	}
+	return err
+}
+
+// emit returns the points to send at the current time ordered by their due time, and reports if the current point
+// is dropped by probability or gaps. After the wrapped generator is over, it returns all pending points.
+func (d *distorted) emit() ([]Point, bool) {
+	d.emitted = d.emitted[:0]
+	if d.over {
+		for _, p := range d.pending {
+			d.emitted = append(d.emitted, p.point)
+		}
+		d.pending = d.pending[:0]
+		return d.emitted, false
+	}
+	time := d.Generator.Current().Timestamp
+	points, dropped := d.generated()
+	for _, p := range points {
+		if d.missing(p.Timestamp) {
+			dropped = true
+			continue
+		}
+		p.Timestamp = skewed(p.Timestamp, d.skew)
+		d.push(p, time)
+		if d.disorder.Duplicates != 0 && randIntn(d.messy, 100) < int(d.disorder.Duplicates) {
+			d.push(d.duplicate(p), time)
+		}
+	}
+	i := 0
+	for ; i < len(d.pending) && d.pending[i].due <= time; i++ {
+		d.emitted = append(d.emitted, d.pending[i].point)
+	}
+	d.pending = append(d.pending[:0], d.pending[i:]...)
+	return d.emitted, dropped
+}
+
+// Tune sets new parameters for the wrapped generator, the deviation is used for values of duplicates as well
+func (d *distorted) Tune(step uint, value, deviation float64, probability uint8) error {
+	if err := d.wrapper.Tune(step, value, deviation, probability); err != nil {
+		return err
+	}
+	d.deviation = deviation
+	return nil
+}
@@ -0,0 +1,314 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/Felixoid/braxpansion"
+)
+
+// ErrExpansion is returned for the names expanded into more names than int can count
+var ErrExpansion = errors.New("invalid expansion")
+
+// Expansion is the lazy shell-like braces expansion. It produces the same names in the same order as
+// braxpansion.ExpandString, but doesn't keep the names. The numeric ranges, e.g. `{1..50000000}`, are computed by
+// index, and only the other top level braces pairs are expanded, so the used memory doesn't depend on the amount of
+// names.
+type Expansion struct {
+	words []expansionWord
+	len   uint64
+}
+
+// expansionWord is a single whitespace separated word of the pattern. The names are the cartesian product of the
+// segments, where the last segment changes the fastest.
+type expansionWord struct {
+	segments []segment
+	len      uint64
+}
+
+// segment is the part of the word with the alternatives by index
+type segment interface {
+	len() uint64
+	// namesLen returns the total length of all alternatives
+	namesLen() uint64
+	appendName(b []byte, i uint64) []byte
+}
+
+// alternatives is the segment with the expanded alternatives
+type alternatives []string
+
+func (a alternatives) len() uint64 {
+	return uint64(len(a))
+}
+
+func (a alternatives) namesLen() uint64 {
+	var n uint64
+	for _, name := range a {
+		n += uint64(len(name))
+	}
+	return n
+}
+
+func (a alternatives) appendName(b []byte, i uint64) []byte {
+	return append(b, a[i]...)
+}
+
+// numberRange is the `{first..last[..step]}` segment. The numbers are padded with zeros to the width the same way as
+// braxpansion does.
+type numberRange struct {
+	first, step int
+	count       uint64
+	width       int
+}
+
+// parseNumberRange returns the numberRange for the braces pair if it's the numeric range. The error is returned for
+// the range with more numbers than int can count.
+func parseNumberRange(pair string) (numberRange, bool, error) {
+	body := pair[1 : len(pair)-1]
+	if strings.IndexByte(body, ',') != -1 {
+		return numberRange{}, false, nil
+	}
+	args := strings.Split(body, "..")
+	if len(args) != 2 && len(args) != 3 {
+		return numberRange{}, false, nil
+	}
+	seq := make([]int, len(args))
+	for i, a := range args {
+		n, err := strconv.Atoi(a)
+		if err != nil {
+			return numberRange{}, false, nil
+		}
+		seq[i] = n
+	}
+	first, last, step := seq[0], seq[1], 1
+	if len(seq) == 3 {
+		step = seq[2]
+		if step == 0 {
+			// braxpansion keeps it as is without the zero step padding
+			return numberRange{}, false, nil
+		}
+	}
+	reversed := step < 0
+	if step < 0 {
+		step = -step
+	}
+	// the distance and the step are computed in uint64, they don't fit int for the widest ranges
+	distance := uint64(last) - uint64(first)
+	if last < first {
+		distance = uint64(first) - uint64(last)
+	}
+	steps := distance / uint64(step)
+	if math.MaxInt <= steps {
+		return numberRange{}, true, fmt.Errorf("%w: %s has more than %d numbers", ErrExpansion, pair, math.MaxInt)
+	}
+	r := numberRange{first: first, step: step, count: steps + 1, width: 1}
+	if last < first {
+		r.step = -step
+	}
+	if reversed {
+		// the sequence is reversed, so it starts from its last number
+		r.first += int(r.count-1) * r.step
+		r.step = -r.step
+	}
+	for i, a := range args {
+		digits := len(strconv.Itoa(seq[i]))
+		if digits < len(a) && r.width < len(a) {
+			r.width = len(a)
+		}
+	}
+	return r, true, nil
+}
+
+func (r numberRange) len() uint64 {
+	return r.count
+}
+
+// namesLen sums the lengths of numbers by the amount of digits, so it doesn't depend on the amount of numbers
+func (r numberRange) namesLen() uint64 {
+	var n uint64
+	for digits, limit := 1, 1; digits <= 19; digits, limit = digits+1, limit*10 {
+		// the positive and negative numbers with the digits, the 19 digits numbers are up to the int limits
+		lo, hi, negative := limit, limit*10-1, -(limit*10 - 1)
+		if digits == 1 {
+			lo = 0
+		}
+		if digits == 19 {
+			hi, negative = math.MaxInt, math.MinInt
+		}
+		n += r.countIn(lo, hi) * uint64(max(r.width, digits))
+		n += r.countIn(negative, -max(lo, 1)) * uint64(max(r.width, digits+1))
+	}
+	return n
+}
+
+// countIn returns the amount of numbers in [lo,hi]
+func (r numberRange) countIn(lo, hi int) uint64 {
+	first, step := r.first, r.step
+	if step < 0 {
+		// the decreasing range is the increasing one from the last number
+		first += int(r.count-1) * step
+		step = -step
+	}
+	last := first + int(r.count-1)*step
+	lo, hi = max(lo, first), min(hi, last)
+	if hi < lo {
+		return 0
+	}
+	// the indexes of the first and the last numbers in [lo,hi], the differences can exceed int
+	from, to := uint64(lo)-uint64(first), uint64(hi)-uint64(first)
+	i := from / uint64(step)
+	if from%uint64(step) != 0 {
+		i++
+	}
+	j := to / uint64(step)
+	if j < i {
+		return 0
+	}
+	return j - i + 1
+}
+
+func (r numberRange) appendName(b []byte, i uint64) []byte {
+	return fmt.Appendf(b, "%0*d", r.width, r.first+int(i)*r.step)
+}
+
+// NewExpansion parses the pattern into segments by the top level braces pairs. ErrExpansion is returned when the
+// amount of names doesn't fit int.
+func NewExpansion(pattern string) (*Expansion, error) {
+	e := &Expansion{}
+	for _, field := range strings.Fields(pattern) {
+		w := expansionWord{len: 1}
+		cur := 0
+		for cur < len(field) {
+			start, stop := getPair(field[cur:])
+			if start == -1 {
+				break
+			}
+			if start != 0 {
+				w.segments = append(w.segments, alternatives{field[cur : cur+start]})
+			}
+			pair := field[cur+start : cur+stop+1]
+			var seg segment
+			r, ok, err := parseNumberRange(pair)
+			switch {
+			case err != nil:
+				return nil, err
+			case ok:
+				seg = r
+			default:
+				seg = alternatives(braxpansion.ExpandString(pair))
+			}
+			w.segments = append(w.segments, seg)
+			hi, product := bits.Mul64(w.len, seg.len())
+			if hi != 0 || math.MaxInt < product {
+				return nil, fmt.Errorf("%w: %s has more than %d names", ErrExpansion, pattern, math.MaxInt)
+			}
+			w.len = product
+			cur += stop + 1
+		}
+		if cur != len(field) {
+			w.segments = append(w.segments, alternatives{field[cur:]})
+		}
+		e.words = append(e.words, w)
+		e.len += w.len
+		// both terms are at most math.MaxInt, so the sum doesn't overflow uint64
+		if math.MaxInt < e.len {
+			return nil, fmt.Errorf("%w: %s has more than %d names", ErrExpansion, pattern, math.MaxInt)
+		}
+	}
+	return e, nil
+}
+
+// Len returns the amount of names
+func (e *Expansion) Len() uint64 {
+	return e.len
+}
+
+// NamesLen returns the total length of all names without producing them
+func (e *Expansion) NamesLen() uint64 {
+	var n uint64
+	for _, w := range e.words {
+		if w.len == 0 {
+			continue
+		}
+		for _, s := range w.segments {
+			// each alternative of the segment is repeated in w.len/s.len() names
+			n += s.namesLen() * (w.len / s.len())
+		}
+	}
+	return n
+}
+
+// Name returns the name by index. It panics if the index is out of range, like the slice does.
+func (e *Expansion) Name(i uint64) string {
+	for _, w := range e.words {
+		if w.len <= i {
+			i -= w.len
+			continue
+		}
+		indexes := make([]uint64, len(w.segments))
+		for j := len(w.segments) - 1; 0 <= j; j-- {
+			n := w.segments[j].len()
+			indexes[j] = i % n
+			i /= n
+		}
+		var b []byte
+		for j, s := range w.segments {
+			b = s.appendName(b, indexes[j])
+		}
+		return string(b)
+	}
+	panic("generator: Expansion.Name index out of range")
+}
+
+// getPair returns the top level braces pair the same way as braxpansion does. If the first `{` doesn't have the
+// pair, it's recursively executed for the substring after it. Unlike braxpansion, it doesn't panic on the closing
+// brace at the end of `{{a}`. braxpansion v0.6.0 doesn't export it, so it should be replaced by the exported one when
+// it's released.
+func getPair(in string) (start, stop int) {
+	start = strings.IndexRune(in, '{')
+	stop = strings.IndexRune(in, '}')
+	if start == -1 || stop == -1 || stop < start {
+		return -1, -1
+	}
+
+	depth := 0
+	cur := start
+	for {
+		if stop+1 < len(in) && in[start+1] == '{' && in[stop+1] == '}' {
+			// we are in {{}}, and external braces aren't suppose to be expanded
+			start++
+			cur = start
+			continue
+		}
+		// look for another nested expansion
+		unpair := strings.IndexRune(in[cur+1:stop], '{')
+		if unpair != -1 {
+			cur += unpair + 1
+			depth++
+			continue
+		}
+		// the only {} pair
+		if depth == 0 {
+			break
+		}
+
+		pair := strings.IndexRune(in[stop+1:], '}')
+		if pair == -1 {
+			break
+		}
+		stop += pair + 1
+		depth--
+	}
+
+	if depth != 0 {
+		diff := start + 1
+		subStart, subStop := getPair(in[diff:])
+		return subStart + diff, subStop + diff
+	}
+
+	return
+}
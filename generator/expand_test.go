@@ -0,0 +1,117 @@
+package generator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Felixoid/braxpansion"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExpansion(t *testing.T, pattern string) *Expansion {
+	t.Helper()
+	e, err := NewExpansion(pattern)
+	require.NoError(t, err, pattern)
+	return e
+}
+
+func expansionNames(e *Expansion) []string {
+	names := make([]string, 0, e.Len())
+	for i := uint64(0); i < e.Len(); i++ {
+		names = append(names, e.Name(i))
+	}
+	return names
+}
+
+func TestExpansion(t *testing.T) {
+	patterns := []string{
+		"",
+		"plain.name",
+		"metric.name{1..3}",
+		"server{01..10}.soft{1..5}",
+		"x{a,{b,c}}y{1..3}",
+		"{{a,b}}",
+		"a{b",
+		"a}b{",
+		"{a{1,2}",
+		"{a..c}{5..1..2}",
+		"one{1,2} two{a..c}.end",
+		"metric.random.example{1,{2..5},.subdir}",
+		"{9..11}{09..11}{1..005..2}{-3..03}",
+		"{10..1..3}{1..10..-3}{3..1..-1}{1..1}{5..5..-2}{1..3..0}",
+		"{{1..3}}.{a,{-2..2}}",
+		"{-15..12..4}{-5..-100..-7}{-010..10..5}{98..102}",
+	}
+	for _, p := range patterns {
+		e := newExpansion(t, p)
+		expected := braxpansion.ExpandString(p)
+		assert.Equal(t, uint64(len(expected)), e.Len(), p)
+		namesLen := 0
+		for _, name := range expected {
+			namesLen += len(name)
+		}
+		assert.Equal(t, uint64(namesLen), e.NamesLen(), p)
+		if len(expected) == 0 {
+			assert.Empty(t, expansionNames(e), p)
+			continue
+		}
+		assert.Equal(t, expected, expansionNames(e), p)
+	}
+
+	// braxpansion panics on these, the expansion keeps braces as is
+	assert.Equal(t, []string{"{{a}"}, expansionNames(newExpansion(t, "{{a}")))
+	assert.Equal(t, []string{"a{{b}"}, expansionNames(newExpansion(t, "a{{b}")))
+
+	e := newExpansion(t, "a{1..3}")
+	assert.Panics(t, func() { e.Name(3) })
+}
+
+func TestExpansionLen(t *testing.T) {
+	// the names are never materialized
+	e := newExpansion(t, "a{1..1000}.b{1..1000}.c{1..1000}")
+	assert.Equal(t, uint64(1000000000), e.Len())
+	assert.Equal(t, "a1.b1.c1", e.Name(0))
+	assert.Equal(t, "a1.b1.c1000", e.Name(999))
+	assert.Equal(t, "a1.b2.c1", e.Name(1000))
+	assert.Equal(t, "a1000.b1000.c1000", e.Name(e.Len()-1))
+	// each name has 5 letters and dots, the numbers 1..1000 have 2893 digits
+	assert.Equal(t, uint64(1000000000*5+3*2893*1000000), e.NamesLen())
+}
+
+func TestExpansionRange(t *testing.T) {
+	// the numeric ranges aren't expanded
+	e := newExpansion(t, "m.{1..50000000}.{001..5000000000}")
+	assert.Equal(t, uint64(250000000000000000), e.Len())
+	assert.Equal(t, "m.1.001", e.Name(0))
+	assert.Equal(t, "m.1.5000000000", e.Name(4999999999))
+	assert.Equal(t, "m.50000000.5000000000", e.Name(e.Len()-1))
+	allocs := testing.AllocsPerRun(10, func() { NewExpansion("m.{1..50000000}") })
+	assert.Less(t, allocs, 20.0)
+}
+
+func TestExpansionOverflow(t *testing.T) {
+	for _, p := range []string{
+		// the product of words and the range itself don't fit int
+		"m.{1..5000000000}.{1..5000000000}",
+		"m.{1..5000000000}.{1..5000000000}.{a,b}",
+		"{-9223372036854775808..9223372036854775807}",
+		// the sum of words
+		"a{1..4611686018427387904} b{1..4611686018427387904}",
+	} {
+		_, err := NewExpansion(p)
+		assert.ErrorIs(t, err, ErrExpansion, p)
+	}
+	_, err := NewLazy("const", "m.{1..5000000000}.{1..5000000000}", 0, 0, 1, false, 0, 0, 100)
+	assert.ErrorIs(t, err, ErrExpansion)
+
+	// the widest ranges, which still fit
+	e := newExpansion(t, "{-9223372036854775808..9223372036854775807..4}")
+	assert.Equal(t, uint64(1<<62), e.Len())
+	assert.Equal(t, "-9223372036854775808", e.Name(0))
+	assert.Equal(t, "9223372036854775804", e.Name(e.Len()-1))
+	e = newExpansion(t, "{-3..9223372036854775803}")
+	assert.Equal(t, uint64(math.MaxInt), e.Len())
+	assert.Equal(t, "9223372036854775803", e.Name(e.Len()-1))
+	assert.Equal(t, uint64(2*20), newExpansion(t, "{-9223372036854775808..-9223372036854775807}").NamesLen())
+}
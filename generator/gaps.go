@@ -0,0 +1,138 @@
+package generator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+)
+
+// ErrGaps is returned for meaningless gaps parameters
+var ErrGaps = errors.New("invalid gaps")
+
+// Delay distributions of Gaps.DelayDistribution
+const (
+	DelayFixed       = "fixed"
+	DelayUniform     = "uniform"
+	DelayExponential = "exponential"
+)
+
+// Window is the time range [Start,Stop)
+type Window struct {
+	Start uint
+	Stop  uint
+}
+
+// contains reports if the timestamp is inside the window
+func (w Window) contains(ts uint) bool {
+	return w.Start <= ts && ts < w.Stop
+}
+
+// Gaps describes the missing and late points. The zero Gaps doesn't change the generation.
+type Gaps struct {
+	// Outages are the scheduled windows without points of the whole group
+	Outages []Window
+	// OutageInterval is the mean interval between random outages of the whole group in seconds, 0 disables them
+	OutageInterval uint
+	// OutageLength is the mean length of random outages in seconds
+	OutageLength uint
+	// SilenceInterval is the mean interval between random silence periods of each series in seconds, 0 disables them
+	SilenceInterval uint
+	// SilenceLength is the mean length of silence periods in seconds
+	SilenceLength uint
+	// Delay is the mean delay in seconds between the timestamp of a point and the time it's sent at
+	Delay uint
+	// DelayDistribution is DelayFixed (default), DelayUniform in [0,2*Delay] or DelayExponential
+	DelayDistribution string
+}
+
+// enabled reports if any gaps are set
+func (g Gaps) enabled() bool {
+	return len(g.Outages) != 0 || g.OutageInterval != 0 || g.SilenceInterval != 0 || g.Delay != 0
+}
+
+// Check returns ErrGaps if the windows are empty, random gaps are longer than their interval, or the delay
+// distribution is unknown
+func (g Gaps) Check() error {
+	var errs []error
+	for i, w := range g.Outages {
+		if w.Stop <= w.Start {
+			errs = append(errs, fmt.Errorf("%w: outage %d starts at %d, but stops at %d", ErrGaps, i, w.Start, w.Stop))
+		}
+	}
+	if err := checkGapLength("outage", g.OutageInterval, g.OutageLength); err != nil {
+		errs = append(errs, err)
+	}
+	if err := checkGapLength("silence", g.SilenceInterval, g.SilenceLength); err != nil {
+		errs = append(errs, err)
+	}
+	switch g.DelayDistribution {
+	case "", DelayFixed, DelayUniform, DelayExponential:
+	default:
+		errs = append(errs, fmt.Errorf("%w: delay distribution %q is not %s, %s or %s", ErrGaps, g.DelayDistribution,
+			DelayFixed, DelayUniform, DelayExponential))
+	}
+	return errors.Join(errs...)
+}
+
+func checkGapLength(kind string, interval, length uint) error {
+	if interval == 0 {
+		return nil
+	}
+	if length == 0 || interval <= length {
+		return fmt.Errorf("%w: %s length %d must be in [1,%d)", ErrGaps, kind, length, interval)
+	}
+	return nil
+}
+
+// gapsSeed is used for random gaps without the seed, so the group outages are the same for all series in the run
+var gapsSeed = rand.Int63()
+
+// gapSchedule returns random gaps of the key. The time is split into periods of the interval, and each period has
+// a single gap with exponentially distributed length placed randomly inside it. The gap depends only on the key, the
+// period and the seed, so all generators of the group see the same outages regardless of the generation order.
+type gapSchedule struct {
+	key      string
+	interval uint
+	length   uint
+	period   uint
+	window   Window
+}
+
+// newGapSchedule returns the schedule for the key, nil when the interval is 0
+func newGapSchedule(key string, interval, length uint) *gapSchedule {
+	if interval == 0 {
+		return nil
+	}
+	// the impossible period marks the window as not calculated yet
+	return &gapSchedule{key: key, interval: interval, length: length, period: ^uint(0)}
+}
+
+// contains reports if the timestamp is inside the gap of its period
+func (s *gapSchedule) contains(ts uint) bool {
+	if s == nil {
+		return false
+	}
+	period := ts / s.interval
+	if period != s.period {
+		s.period = period
+		s.window = s.calculate(period)
+	}
+	return s.window.contains(ts)
+}
+
+func (s *gapSchedule) calculate(period uint) Window {
+	h := fnv.New64a()
+	if p := seed.Load(); p != nil {
+		binary.Write(h, binary.LittleEndian, *p)
+	} else {
+		binary.Write(h, binary.LittleEndian, gapsSeed)
+	}
+	h.Write([]byte(s.key))
+	binary.Write(h, binary.LittleEndian, uint64(period))
+	r := rand.New(&splitMix64{h.Sum64()})
+	length := min(max(uint(r.ExpFloat64()*float64(s.length)), 1), s.interval)
+	start := period*s.interval + uint(r.Int63n(int64(s.interval-length)+1))
+	return Window{Start: start, Stop: start + length}
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gapsTimestamps returns timestamps of points per name in the order they are produced
+func gapsTimestamps(t *testing.T, spec Spec) (map[string][]uint, uint64) {
+	t.Helper()
+	gg, err := NewExpandFromSpec(spec)
+	require.NoError(t, err)
+	result := make(map[string][]uint)
+	for p := range gg.Points() {
+		result[p.Name] = append(result[p.Name], p.Timestamp)
+	}
+	return result, gg.Dropped()
+}
+
+func TestGapsCheck(t *testing.T) {
+	assert.NoError(t, Gaps{}.Check())
+	assert.NoError(t, Gaps{Outages: []Window{{1, 2}}, OutageInterval: 10, OutageLength: 9, Delay: 1, DelayDistribution: DelayUniform}.Check())
+	for _, gaps := range []Gaps{
+		{Outages: []Window{{2, 2}}},
+		{OutageInterval: 10},
+		{SilenceInterval: 10, SilenceLength: 10},
+		{Delay: 10, DelayDistribution: "normal"},
+	} {
+		assert.ErrorIs(t, gaps.Check(), ErrGaps, gaps)
+		_, err := NewFromSpec(NewSpec("const", "metric", WithGaps(gaps)))
+		assert.ErrorIs(t, err, ErrGaps, gaps)
+		assert.ErrorIs(t, NewSpec("const", "metric", WithGaps(gaps)).Validate(), ErrGaps, gaps)
+	}
+}
+
+func TestGapsOutages(t *testing.T) {
+	spec := NewSpec("const", "metric.{1..2}", WithRange(0, 100), WithStep(10),
+		WithGaps(Gaps{Outages: []Window{{30, 60}, {100, 200}}}))
+	points, dropped := gapsTimestamps(t, spec)
+	expected := []uint{0, 10, 20, 60, 70, 80, 90}
+	assert.Equal(t, map[string][]uint{"metric.1": expected, "metric.2": expected}, points)
+	assert.Equal(t, uint64(2*5), dropped, "points of outages are counted as dropped")
+}
+
+func TestGapsRandom(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	spec := NewSpec("const", "metric.{1..3}", WithRange(0, 10000), WithStep(10),
+		WithGaps(Gaps{OutageInterval: 1000, OutageLength: 100}))
+	points, dropped := gapsTimestamps(t, spec)
+	assert.NotZero(t, dropped)
+	assert.Equal(t, points["metric.1"], points["metric.2"], "outages are the same for the group")
+	assert.Equal(t, points["metric.1"], points["metric.3"], "outages are the same for the group")
+	lazy, err := NewLazyFromSpec(spec)
+	require.NoError(t, err)
+	for p := range lazy.Points() {
+		if p.Name == "metric.1" {
+			assert.Contains(t, points["metric.1"], p.Timestamp, "lazy generators have the same outages")
+		}
+	}
+	again, _ := gapsTimestamps(t, spec)
+	assert.Equal(t, points, again, "seeded outages are reproducible")
+
+	spec.Gaps = Gaps{SilenceInterval: 1000, SilenceLength: 300}
+	points, dropped = gapsTimestamps(t, spec)
+	assert.NotZero(t, dropped)
+	assert.NotEqual(t, points["metric.1"], points["metric.2"], "each series has own silence")
+}
+
+func TestGapsDelay(t *testing.T) {
+	// each point is sent at the first step after its timestamp plus 25 seconds
+	gg, err := NewExpandFromSpec(NewSpec("const", "metric", WithRange(0, 100), WithStep(10), WithValue(1),
+		WithGaps(Gaps{Delay: 25})))
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(buf)
+	require.NoError(t, err)
+	expected := ""
+	for ts := 0; ts <= 110; ts += 10 {
+		expected += fmt.Sprintf("metric 1 %d\n", ts)
+	}
+	assert.Equal(t, expected, buf.String(), "points due after the end are sent at the end")
+	assert.Zero(t, gg.Dropped(), "delayed points aren't dropped")
+
+	defer ResetSeed()
+	SetSeed(42)
+	spec := NewSpec("const", "metric", WithRange(0, 10000), WithStep(10),
+		WithGaps(Gaps{Delay: 60, DelayDistribution: DelayExponential}))
+	points, dropped := gapsTimestamps(t, spec)
+	assert.Zero(t, dropped)
+	ordered := true
+	seen := make(map[uint]bool)
+	for i, ts := range points["metric"] {
+		assert.False(t, seen[ts], "each point is sent once")
+		seen[ts] = true
+		ordered = ordered && (i == 0 || points["metric"][i-1] < ts)
+	}
+	assert.False(t, ordered, "points arrive out of order")
+	assert.Greater(t, len(seen), 990)
+}
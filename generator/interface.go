@@ -6,7 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"log/slog"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/Felixoid/braxpansion"
 )
@@ -32,6 +36,8 @@ type Generator interface {
 	Next() error
 	// Point returns the metric in carbon format, e.g. 'metric.name 123.33 1234567890\n'
 	Point() []byte
+	// Current returns the current point regardless of probability
+	Current() Point
 	// SetStop sets the stop field for the Generator
 	SetStop(stop uint)
 	// Stop returns the current value for the stop field
@@ -40,49 +46,104 @@ type Generator interface {
 	WriteTo(io.Writer) (int64, error)
 }
 
+// Tuner is implemented by generators, which parameters can be changed during the generation
+type Tuner interface {
+	// Tune sets new step, value, deviation and probability. The meaning of value depends on the generator type
+	Tune(step uint, value, deviation float64, probability uint8) error
+}
+
+// PreciseStopper is implemented by generators, which stop can be set with millisecond precision for sub-second
+// intervals
+type PreciseStopper interface {
+	// SetStopTime sets the stop to the time truncated to milliseconds
+	SetStopTime(t time.Time)
+}
+
+// setStopTime sets the stop of the generator with millisecond precision if it's supported, and in seconds otherwise
+func setStopTime(g Generator, t time.Time) {
+	if ps, ok := g.(PreciseStopper); ok {
+		ps.SetStopTime(t)
+		return
+	}
+	g.SetStop(uint(t.Unix()))
+}
+
 // Generators is a slice of Generator. Next() and Point() works accordingly
 type Generators struct {
 	name       string
 	typeName   string
 	step       uint
+	interval   time.Duration
+	jitter     time.Duration
 	randomized bool
 	gens       []Generator
+	dropped    *atomic.Uint64
+	logger     *slog.Logger
 }
 
-// New returns new Generator for given parameters
+// New returns new Generator for given parameters. It's the thin wrapper for NewFromSpec.
 func New(typeName, name string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (Generator, error) {
-	gt, err := GetType(typeName)
+	return NewFromSpec(positionalSpec(typeName, name, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// NewFromSpec returns new Generator for the spec by the Factory of its type. The spec is checked by Validate first, so
+// e.g. the zero step is an error. When the spec has retentions, the Generator is wrapped to aggregate the older points.
+// When it has gaps or disorder, the Generator is wrapped to skip, delay, skew and duplicate its points.
+func NewFromSpec(s Spec) (Generator, error) {
+	gt, err := GetType(s.Type)
 	if err != nil {
 		return nil, err
 	}
-	switch gt {
-	case ConstType:
-		return NewConst(name, start, stop, step, randomizeStart, value, deviation, probabilityStart)
-	case CounterType:
-		return NewCounter(name, start, stop, step, randomizeStart, value, deviation, probabilityStart)
-	case RandomType:
-		return NewRandom(name, start, stop, step, randomizeStart, value, deviation, probabilityStart)
+	factory, ok := getFactory(gt)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotImplemented, s.Type)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	g, err := factory(s)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("%w: %s", ErrNotImplemented, typeName)
+	if s.Rollup.enabled() {
+		g = newRollup(g, s)
+	}
+	if !s.Gaps.enabled() && !s.Disorder.enabled() {
+		return g, nil
+	}
+	return newDistorted(g, s), nil
 }
 
 // NewExpand expands name as shell expansion
 // (e.g. metric.name{1..3} will produce 3 metrics metric.name1, metric.name2 and metric.name3)
-// and creates slice of Generator with names.
-func NewExpand(typeName, expandableName string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStrat uint8) (Generators, error) {
-	names := braxpansion.ExpandString(expandableName)
+// and creates slice of Generator with names. It's the thin wrapper for NewExpandFromSpec.
+func NewExpand(typeName, expandableName string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (Generators, error) {
+	return NewExpandFromSpec(positionalSpec(typeName, expandableName, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// NewExpandFromSpec expands the spec name as shell expansion and creates Generator for each name
+func NewExpandFromSpec(s Spec) (Generators, error) {
+	names := braxpansion.ExpandString(s.Name)
 	if len(names) == 0 {
 		return Generators{}, ErrEmptyGens
 	}
+	s.log().Debug("name is expanded", "name", s.Name, "type", s.Type, "generators", len(names))
 	gg := Generators{
-		name:       expandableName,
-		typeName:   typeName,
-		step:       step,
-		randomized: randomizeStart,
+		name:       s.Name,
+		typeName:   s.Type,
+		step:       s.Step,
+		interval:   s.Interval,
+		jitter:     s.Jitter,
+		randomized: s.Randomize,
 		gens:       make([]Generator, len(names)),
+		dropped:    new(atomic.Uint64),
+		logger:     s.Logger,
 	}
 	for i, name := range names {
-		g, err := New(typeName, name, start, stop, step, randomizeStart, value, deviation, probabilityStrat)
+		gs := s
+		gs.group = s.groupName()
+		gs.Name = name
+		g, err := NewFromSpec(gs)
 		if err != nil {
 			return Generators{}, err
 		}
@@ -91,6 +152,74 @@ func NewExpand(typeName, expandableName string, start, stop, step uint, randomiz
 	return gg, nil
 }
 
+// Name returns the expandable name the Generators are created from
+func (gg *Generators) Name() string {
+	return gg.name
+}
+
+// TypeName returns the type name of the Generators
+func (gg *Generators) TypeName() string {
+	return gg.typeName
+}
+
+// Dropped returns the amount of points dropped by probability or gaps. The counter is shared between copies of Generators.
+func (gg *Generators) Dropped() uint64 {
+	if gg.dropped == nil {
+		return 0
+	}
+	return gg.dropped.Load()
+}
+
+func (gg *Generators) writePoints(w io.Writer) {
+	var dropped uint64
+	for _, g := range gg.gens {
+		if e, ok := g.(emitter); ok {
+			points, drop := e.emit()
+			writeEmitted(w, points)
+			if drop {
+				dropped++
+			}
+			continue
+		}
+		if n, _ := g.WriteTo(w); n == 0 {
+			dropped++
+		}
+	}
+	if gg.dropped != nil && dropped != 0 {
+		gg.dropped.Add(dropped)
+	}
+}
+
+// currentPoints returns the points, which writePoints writes in carbon format
+func (gg *Generators) currentPoints() []Point {
+	var dropped uint64
+	points := make([]Point, 0, len(gg.gens))
+	for _, g := range gg.gens {
+		if e, ok := g.(emitter); ok {
+			emitted, drop := e.emit()
+			points = append(points, emitted...)
+			if drop {
+				dropped++
+			}
+			continue
+		}
+		if isDropped(g) {
+			dropped++
+			continue
+		}
+		points = append(points, g.Current())
+	}
+	if gg.dropped != nil && dropped != 0 {
+		gg.dropped.Add(dropped)
+	}
+	return points
+}
+
+// Len returns the amount of Generator
+func (gg *Generators) Len() int {
+	return len(gg.gens)
+}
+
 // List returns the list of []Generator
 func (gg *Generators) List() []Generator {
 	return gg.gens
@@ -112,12 +241,48 @@ func (gg *Generators) Next() error {
 // Point returns []byte representation of all generator Point() calls
 func (gg *Generators) Point() []byte {
 	buf := new(bytes.Buffer)
-	for _, g := range gg.gens {
-		g.WriteTo(buf)
-	}
+	gg.writePoints(buf)
 	return buf.Bytes()
 }
 
+// Points returns the iterator over the points of all Generator ordered by time, the same as WriteAllTo writes them.
+// The points dropped by probability are skipped and counted.
+func (gg *Generators) Points() iter.Seq[Point] {
+	return func(yield func(Point) bool) {
+		if len(gg.gens) == 0 {
+			return
+		}
+		for {
+			for _, g := range gg.gens {
+				if e, ok := g.(emitter); ok {
+					points, drop := e.emit()
+					if drop && gg.dropped != nil {
+						gg.dropped.Add(1)
+					}
+					for _, p := range points {
+						if !yield(p) {
+							return
+						}
+					}
+					continue
+				}
+				if isDropped(g) {
+					if gg.dropped != nil {
+						gg.dropped.Add(1)
+					}
+					continue
+				}
+				if !yield(g.Current()) {
+					return
+				}
+			}
+			if gg.Next() != nil {
+				return
+			}
+		}
+	}
+}
+
 // Randomized shows if expanded generators have randomized start timestamp
 func (gg *Generators) Randomized() bool {
 	return gg.randomized
@@ -135,15 +300,73 @@ func (gg *Generators) SetStop(stop uint) {
 	}
 }
 
+// SetStopTime sets the stop with millisecond precision for each Generator implementing PreciseStopper, and in
+// seconds for others
+func (gg *Generators) SetStopTime(t time.Time) {
+	for _, g := range gg.gens {
+		setStopTime(g, t)
+	}
+}
+
+// Tune invokes the Tuner.Tune for each Generator. If any of generators isn't Tuner, ErrNotImplemented is returned.
+// The parameters are checked before tuning, so on error the generators keep the previous ones.
+func (gg *Generators) Tune(step uint, value, deviation float64, probability uint8) error {
+	tuners := make([]Tuner, len(gg.gens))
+	for i, g := range gg.gens {
+		t, ok := g.(Tuner)
+		if !ok {
+			return fmt.Errorf("%w: %T is not a Tuner", ErrNotImplemented, g)
+		}
+		tuners[i] = t
+	}
+	if err := CheckProbability(probability); err != nil {
+		return err
+	}
+	if typesMap[gg.typeName] == CounterType {
+		if err := CheckCounter(value, deviation); err != nil {
+			return err
+		}
+	}
+	for _, t := range tuners {
+		if err := t.Tune(step, value, deviation, probability); err != nil {
+			return err
+		}
+	}
+	gg.step = step
+	return nil
+}
+
 // Step returns the common step for Generators
 func (gg *Generators) Step() uint {
 	return gg.step
 }
 
+// Interval returns the common step with sub-second precision, it's the step in seconds when the sub-second interval
+// isn't set
+func (gg *Generators) Interval() time.Duration {
+	if gg.interval != 0 {
+		return gg.interval
+	}
+	return time.Duration(gg.step) * time.Second
+}
+
+// Jitter returns the maximal deviation of steps
+func (gg *Generators) Jitter() time.Duration {
+	return gg.jitter
+}
+
+// log returns the logger of the spec the Generators are created from or the discarding one
+func (gg *Generators) log() *slog.Logger {
+	if gg.logger != nil {
+		return gg.logger
+	}
+	return discardLogger
+}
+
 var udpMaxPayload int
 
 // tcp has MTU negotiation, but UDP fails with "too big message", that's why here's a poor people MTU calculation
-func getUDPSize(conn *net.UDPConn) (int, error) {
+func getUDPSize(conn *net.UDPConn, log *slog.Logger) (int, error) {
 	if udpMaxPayload != 0 {
 		return udpMaxPayload, nil
 	}
@@ -163,6 +386,7 @@ func getUDPSize(conn *net.UDPConn) (int, error) {
 					ipHeaderSize = 40 // IPv6
 				}
 				udpMaxPayload = mtu - ipHeaderSize - 8 // Subtract IP and UDP header sizes
+				log.Debug("UDP payload size is calculated", "interface", iface.Name, "mtu", mtu, "payload", udpMaxPayload)
 				return udpMaxPayload, nil
 			}
 		}
@@ -172,21 +396,72 @@ func getUDPSize(conn *net.UDPConn) (int, error) {
 
 }
 
-// WriteTo writes point's []byte representation to io.Writer
+// Unwrapper is implemented by io.Writer wrappers, which pass writes through to the underlying io.Writer
+type Unwrapper interface {
+	Unwrap() io.Writer
+}
+
+// PointWriter is implemented by outputs, which store points in their own format, and by the wrappers passing points
+// to them. The points are written to it as is instead of the carbon plain-text.
+type PointWriter interface {
+	// WritePoints writes the points and returns the amount of bytes written in the own format
+	WritePoints(points []Point) (int, error)
+}
+
+// getPointWriter returns the w as PointWriter if it and all writers behind it implement PointWriter
+func getPointWriter(w io.Writer) (PointWriter, bool) {
+	pw, ok := w.(PointWriter)
+	for ok {
+		u, wrapped := w.(Unwrapper)
+		if !wrapped {
+			break
+		}
+		w = u.Unwrap()
+		_, ok = w.(PointWriter)
+	}
+	return pw, ok
+}
+
+// WritePoints writes the points as is to the PointWriter, and in carbon format to other writers
+func WritePoints(w io.Writer, points []Point) (int64, error) {
+	if pw, ok := getPointWriter(w); ok {
+		n, err := pw.WritePoints(points)
+		return int64(n), err
+	}
+	return writeEmitted(w, points)
+}
+
+// getUDPConn returns the *net.UDPConn behind the w, if any
+func getUDPConn(w io.Writer) *net.UDPConn {
+	for {
+		switch v := w.(type) {
+		case *net.UDPConn:
+			return v
+		case Unwrapper:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// WriteTo writes point's []byte representation to io.Writer. The PointWriter gets the points as is.
 func (gg *Generators) WriteTo(w io.Writer) (n int64, err error) {
+	if pw, ok := getPointWriter(w); ok {
+		n, err := pw.WritePoints(gg.currentPoints())
+		return int64(n), err
+	}
 	var add int64
 	buf := new(bytes.Buffer)
-	for _, g := range gg.gens {
-		g.WriteTo(buf)
-	}
-	if udpConn, ok := w.(*net.UDPConn); ok {
-		payloadSize, err := getUDPSize(udpConn)
+	gg.writePoints(buf)
+	if udpConn := getUDPConn(w); udpConn != nil {
+		payloadSize, err := getUDPSize(udpConn, gg.log())
 		if err != nil {
 			return n, err
 		}
 		for buf.Len() > 0 {
-			chunk := min(buf.Len(), payloadSize)
-			add, err := w.Write(buf.Bytes()[:chunk])
+			chunk := udpChunk(buf.Bytes(), payloadSize)
+			add, err := w.Write(buf.Next(chunk))
 			n += int64(add)
 			if err != nil {
 				return n, err
@@ -202,6 +477,21 @@ func (gg *Generators) WriteTo(w io.Writer) (n int64, err error) {
 	return n, nil
 }
 
+// udpChunk returns the size of the longest prefix of complete lines fitting into payloadSize.
+// If the first line is longer than payloadSize, it's returned as is.
+func udpChunk(b []byte, payloadSize int) int {
+	if len(b) <= payloadSize {
+		return len(b)
+	}
+	if i := bytes.LastIndexByte(b[:payloadSize], '\n'); i != -1 {
+		return i + 1
+	}
+	if i := bytes.IndexByte(b, '\n'); i != -1 {
+		return i + 1
+	}
+	return len(b)
+}
+
 // WriteAllTo writes all points for Generators to io.Writer
 func (gg *Generators) WriteAllTo(w io.Writer) (int64, error) {
 	var n int64
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,15 +38,25 @@ func TestNewGenerator(t *testing.T) {
 	g, err := New("invalid", "", 0, 0, 0, false, 0, 0, 100)
 	assert.Nil(t, g)
 	assert.ErrorIs(t, err, ErrWrongType)
-	g, err = New("const", "", 0, 0, 0, false, 0, 0, 100)
+	g, err = New("const", "", 0, 0, 1, false, 0, 0, 100)
 	assert.IsType(t, &Const{}, g)
 	assert.NoError(t, err)
-	g, err = New("counter", "", 0, 0, 0, false, 0, 0, 100)
+	g, err = New("counter", "", 0, 0, 1, false, 0, 0, 100)
 	assert.IsType(t, &Counter{}, g)
 	assert.NoError(t, err)
-	g, err = New("random", "", 0, 0, 0, false, 0, 0, 100)
+	g, err = New("random", "", 0, 0, 1, false, 0, 0, 100)
 	assert.IsType(t, &Random{}, g)
 	assert.NoError(t, err)
+
+	// the zero step never finishes
+	g, err = NewFromSpec(NewSpec("const", "metric", WithStep(0)))
+	assert.Nil(t, g)
+	assert.ErrorIs(t, err, ErrStep)
+	_, err = NewExpandFromSpec(NewSpec("const", "metric.{1..2}", WithStep(0)))
+	assert.ErrorIs(t, err, ErrStep)
+	_, err = NewLazyFromSpec(NewSpec("const", "metric.{1..2}", WithStep(0)))
+	assert.ErrorIs(t, err, ErrStep)
+	assert.NoError(t, NewSpec("const", "metric", WithStep(0), WithInterval(time.Second)).Validate())
 }
 
 func TestNewExpand(t *testing.T) {
@@ -170,3 +183,149 @@ func TestGeneratorsWriteAllToWithContext(t *testing.T) {
 	assert.ErrorIs(t, err, context.Canceled)
 	assert.Zero(t, n)
 }
+
+type unwrapWriter struct {
+	w io.Writer
+}
+
+func (u unwrapWriter) Write(p []byte) (int, error) { return u.w.Write(p) }
+func (u unwrapWriter) Unwrap() io.Writer           { return u.w }
+
+func TestGetUDPConn(t *testing.T) {
+	assert.Nil(t, getUDPConn(new(bytes.Buffer)))
+	assert.Nil(t, getUDPConn(unwrapWriter{new(bytes.Buffer)}))
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip("unable to listen UDP: ", err)
+	}
+	defer conn.Close()
+	assert.Equal(t, conn, getUDPConn(conn))
+	assert.Equal(t, conn, getUDPConn(unwrapWriter{unwrapWriter{conn}}))
+}
+
+func TestUDPChunk(t *testing.T) {
+	b := []byte("metric.1 1 1\nmetric.2 2 2\nmetric.3 3 3\n")
+	assert.Equal(t, len(b), udpChunk(b, 100))
+	assert.Equal(t, 26, udpChunk(b, 30))
+	assert.Equal(t, 13, udpChunk(b, 13))
+	assert.Equal(t, 13, udpChunk(b, 5))
+	assert.Equal(t, 3, udpChunk([]byte("abc"), 2))
+}
+
+// pointsWriter collects written points, and the carbon plain-text separately
+type pointsWriter struct {
+	bytes.Buffer
+	points []Point
+}
+
+func (pw *pointsWriter) WritePoints(points []Point) (int, error) {
+	pw.points = append(pw.points, points...)
+	return len(points), nil
+}
+
+// unwrapPointWriter passes points to the underlying writer
+type unwrapPointWriter struct {
+	unwrapWriter
+}
+
+func (u unwrapPointWriter) WritePoints(points []Point) (int, error) {
+	return u.w.(PointWriter).WritePoints(points)
+}
+
+func TestWritePoints(t *testing.T) {
+	newGroup := func() Generators {
+		gg, err := NewExpand("counter", "metric.{1..2}", 1, 3, 1, false, 1, 0, 100)
+		assert.NoError(t, err)
+		return gg
+	}
+	text := new(bytes.Buffer)
+	gg := newGroup()
+	_, err := gg.WriteAllTo(text)
+	assert.NoError(t, err)
+
+	// the points are passed as is through the PointWriter wrappers
+	pw := &pointsWriter{}
+	gg = newGroup()
+	n, err := gg.WriteAllTo(unwrapPointWriter{unwrapWriter{pw}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(pw.points)), n)
+	assert.Empty(t, pw.String())
+	var b []byte
+	for _, p := range pw.points {
+		b = p.AppendCarbon(b)
+	}
+	assert.Equal(t, text.String(), string(b))
+
+	// any wrapper without PointWriter gets the carbon plain-text
+	pw = &pointsWriter{}
+	gg = newGroup()
+	_, err = gg.WriteAllTo(unwrapWriter{pw})
+	assert.NoError(t, err)
+	assert.Empty(t, pw.points)
+	assert.Equal(t, text.String(), pw.String())
+
+	points := []Point{NewPoint("a", 1, 1)}
+	_, err = WritePoints(pw, points)
+	assert.NoError(t, err)
+	assert.Equal(t, points, pw.points)
+	buf := new(bytes.Buffer)
+	_, err = WritePoints(buf, points)
+	assert.NoError(t, err)
+	assert.Equal(t, "a 1 1\n", buf.String())
+}
+
+func TestGeneratorsDropped(t *testing.T) {
+	gg := Generators{}
+	assert.Zero(t, gg.Dropped())
+
+	gg, err := NewExpand("const", "metric.{1..4}", 1, 1, 1, false, 0, 0, 50)
+	assert.NoError(t, err)
+	assert.Equal(t, "metric.{1..4}", gg.Name())
+	assert.Equal(t, "const", gg.TypeName())
+	for _, g := range gg.List() {
+		g.(*Const).probability.current = 0
+	}
+	gg.Point()
+	assert.Equal(t, uint64(4), gg.Dropped())
+	copied := gg
+	copied.SetList(gg.List()[:2])
+	for _, g := range copied.List() {
+		g.(*Const).probability.current = 0
+	}
+	copied.Point()
+	assert.Equal(t, uint64(6), gg.Dropped())
+}
+
+type notTuner struct {
+	Const
+}
+
+func (n *notTuner) Tune() {}
+
+func TestGeneratorsTune(t *testing.T) {
+	gg, err := NewExpand("counter", "metric.{1..2}", 0, 0, 1, false, 1, 0, 100)
+	assert.NoError(t, err)
+	assert.NoError(t, gg.Tune(10, 5, 2, 50))
+	assert.Equal(t, uint(10), gg.Step())
+	for _, g := range gg.List() {
+		c := g.(*Counter)
+		assert.Equal(t, uint(10), c.Step())
+		assert.Equal(t, float64(5), c.increment)
+		assert.Equal(t, float64(2), c.Deviation())
+		assert.Equal(t, uint8(50), c.probability.start)
+	}
+	assert.ErrorIs(t, gg.Tune(10, -5, 2, 50), ErrNewCounter)
+	assert.ErrorIs(t, gg.Tune(10, 5, 2, 0), ErrProbabilityStart)
+
+	// nothing is applied when any generator isn't a Tuner
+	c, err := NewCounter("metric.3", 0, 0, 1, false, 1, 0, 100)
+	assert.NoError(t, err)
+	gg.SetList([]Generator{c, &notTuner{}})
+	assert.ErrorIs(t, gg.Tune(20, 7, 0, 30), ErrNotImplemented)
+	assert.Equal(t, uint(1), c.Step())
+	assert.Equal(t, float64(1), c.increment)
+	assert.Equal(t, uint(10), gg.Step())
+
+	gg.SetList([]Generator{&notTuner{}})
+	assert.ErrorIs(t, gg.Tune(10, 5, 2, 50), ErrNotImplemented)
+}
@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"context"
+	"io"
+	"iter"
+	"sync/atomic"
+)
+
+// lazyBatch is the amount of Generator created at once by LazyGenerators
+const lazyBatch = 1024
+
+// LazyGenerators is the lazy variant of Generators for huge masks. The names are expanded by index, and Generator
+// are created by batches on the fly. All points of the batch are written before the next batch is created, so the
+// used memory doesn't depend on the amount of names, but the points aren't ordered by time between batches.
+type LazyGenerators struct {
+	spec      Spec
+	expansion *Expansion
+	dropped   *atomic.Uint64
+}
+
+// NewLazy returns LazyGenerators for the expandable name. It's the thin wrapper for NewLazyFromSpec.
+func NewLazy(typeName, expandableName string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (LazyGenerators, error) {
+	return NewLazyFromSpec(positionalSpec(typeName, expandableName, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// NewLazyFromSpec returns LazyGenerators for the spec with the expandable name. The parameters are checked by
+// creating the Generator for the first name.
+func NewLazyFromSpec(s Spec) (LazyGenerators, error) {
+	expansion, err := NewExpansion(s.Name)
+	if err != nil {
+		return LazyGenerators{}, err
+	}
+	if expansion.Len() == 0 {
+		return LazyGenerators{}, ErrEmptyGens
+	}
+	first := s
+	first.group = s.groupName()
+	first.Name = expansion.Name(0)
+	if _, err := NewFromSpec(first); err != nil {
+		return LazyGenerators{}, err
+	}
+	s.log().Debug("name is lazily expanded", "name", s.Name, "type", s.Type, "generators", expansion.Len())
+	return LazyGenerators{
+		spec:      s,
+		expansion: expansion,
+		dropped:   new(atomic.Uint64),
+	}, nil
+}
+
+// Name returns the expandable name the LazyGenerators are created from
+func (lg *LazyGenerators) Name() string {
+	return lg.spec.Name
+}
+
+// TypeName returns the type name of the LazyGenerators
+func (lg *LazyGenerators) TypeName() string {
+	return lg.spec.Type
+}
+
+// Len returns the amount of expanded names, NewExpansion guarantees it fits int
+func (lg *LazyGenerators) Len() int {
+	return int(lg.expansion.Len())
+}
+
+// Dropped returns the amount of points dropped by probability or gaps
+func (lg *LazyGenerators) Dropped() uint64 {
+	if lg.dropped == nil {
+		return 0
+	}
+	return lg.dropped.Load()
+}
+
+// WriteAllTo writes all points for LazyGenerators to io.Writer
+func (lg *LazyGenerators) WriteAllTo(w io.Writer) (int64, error) {
+	return lg.WriteAllToWithContext(context.Background(), w)
+}
+
+// batches calls f for the Generators of each batch until f returns false or an error
+func (lg *LazyGenerators) batches(f func(gg *Generators) (bool, error)) error {
+	gg := Generators{
+		name:       lg.spec.Name,
+		typeName:   lg.spec.Type,
+		step:       lg.spec.Step,
+		interval:   lg.spec.Interval,
+		jitter:     lg.spec.Jitter,
+		randomized: lg.spec.Randomize,
+		gens:       make([]Generator, 0, min(lg.expansion.Len(), lazyBatch)),
+		dropped:    lg.dropped,
+		logger:     lg.spec.Logger,
+	}
+	for i := uint64(0); i < lg.expansion.Len(); {
+		gg.gens = gg.gens[:0]
+		for ; i < lg.expansion.Len() && len(gg.gens) < lazyBatch; i++ {
+			s := lg.spec
+			s.group = lg.spec.groupName()
+			s.Name = lg.expansion.Name(i)
+			g, err := NewFromSpec(s)
+			if err != nil {
+				return err
+			}
+			gg.gens = append(gg.gens, g)
+		}
+		if next, err := f(&gg); !next || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAllToWithContext writes all points batch by batch, and may be stopped by the context
+func (lg *LazyGenerators) WriteAllToWithContext(ctx context.Context, w io.Writer) (int64, error) {
+	var n int64
+	err := lg.batches(func(gg *Generators) (bool, error) {
+		add, err := gg.WriteAllToWithContext(ctx, w)
+		n += add
+		return true, err
+	})
+	return n, err
+}
+
+// Points returns the iterator over the points batch by batch. The errors of generators creation are impossible after
+// NewLazyFromSpec, so they stop the iteration silently.
+func (lg *LazyGenerators) Points() iter.Seq[Point] {
+	return func(yield func(Point) bool) {
+		lg.batches(func(gg *Generators) (bool, error) {
+			for p := range gg.Points() {
+				if !yield(p) {
+					return false, nil
+				}
+			}
+			return true, nil
+		})
+	}
+}
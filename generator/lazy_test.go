@@ -0,0 +1,65 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sortedLines(b []byte) []string {
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	sort.Strings(lines)
+	return lines
+}
+
+func TestNewLazy(t *testing.T) {
+	_, err := NewLazy("const", "", 1, 10, 1, false, 1, 0, 100)
+	assert.ErrorIs(t, err, ErrEmptyGens)
+	_, err = NewLazy("invalid", "metric", 1, 10, 1, false, 1, 0, 100)
+	assert.ErrorIs(t, err, ErrWrongType)
+	_, err = NewLazy("counter", "metric", 1, 10, 1, false, -1, 0, 100)
+	assert.ErrorIs(t, err, ErrNewCounter)
+
+	lg, err := NewLazy("const", "metric.{1..3}", 1, 10, 1, false, 1, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "metric.{1..3}", lg.Name())
+	assert.Equal(t, "const", lg.TypeName())
+	assert.Equal(t, 3, lg.Len())
+	assert.Equal(t, uint64(0), lg.Dropped())
+}
+
+func TestLazyGeneratorsWriteAllTo(t *testing.T) {
+	// more than two batches
+	name := "metric.{1..2500}"
+	gg, err := NewExpand("const", name, 1, 30, 10, false, 7, 0, 100)
+	require.NoError(t, err)
+	expected := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(expected)
+	require.NoError(t, err)
+
+	lg, err := NewLazy("const", name, 1, 30, 10, false, 7, 0, 100)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	n, err := lg.WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, int64(expected.Len()), n)
+	assert.Equal(t, sortedLines(expected.Bytes()), sortedLines(buf.Bytes()))
+	// all points of the first batch go before the second batch
+	assert.True(t, strings.HasPrefix(buf.String(), "metric.1 7 1\nmetric.2 7 1\n"))
+	assert.Equal(t, "metric.2500 7 31\n", buf.String()[buf.Len()-len("metric.2500 7 31\n"):])
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err = lg.WriteAllToWithContext(ctx, new(bytes.Buffer))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int64(0), n)
+
+	limited := newBufWithLimit(10)
+	_, err = lg.WriteAllTo(limited)
+	assert.Error(t, err)
+}
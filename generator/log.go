@@ -0,0 +1,17 @@
+package generator
+
+import (
+	"context"
+	"log/slog"
+)
+
+// discardHandler is the slog.Handler dropping all records
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// discardLogger is used by the generators created without Spec.Logger, nothing is logged
+var discardLogger = slog.New(discardHandler{})
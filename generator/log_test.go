@@ -0,0 +1,32 @@
+package generator
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscardLogger(t *testing.T) {
+	assert.False(t, discardLogger.Enabled(context.Background(), slog.LevelError))
+	assert.Same(t, discardLogger, NewSpec("const", "metric").log())
+	gg, err := NewExpand("const", "metric.{1..3}", 0, 0, 1, false, 0, 0, 100)
+	assert.NoError(t, err)
+	assert.Same(t, discardLogger, gg.log(), "the generators without the spec logger log nothing")
+}
+
+func TestWithLogger(t *testing.T) {
+	buf := &strings.Builder{}
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	_, err := NewExpandFromSpec(NewSpec("const", "metric.{1..3}", WithLogger(l)))
+	assert.NoError(t, err)
+	_, err = NewLazyFromSpec(NewSpec("const", "lazy.{1..3}", WithLogger(l)))
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), `msg="name is expanded" name=metric.{1..3}`)
+	assert.Contains(t, buf.String(), `msg="name is lazily expanded" name=lazy.{1..3}`)
+	gg, err := NewExpandFromSpec(NewSpec("const", "metric.{1..3}", WithLogger(l)))
+	assert.NoError(t, err)
+	assert.Same(t, l, gg.log())
+}
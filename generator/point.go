@@ -0,0 +1,130 @@
+package generator
+
+import (
+	"iter"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Point is the single point of a metric. The tags are parsed from the graphite tagged name, e.g.
+// 'metric.name;tag1=value1;tag2=value2'. The Tags map of points of the same generator is shared, so it mustn't be
+// changed.
+type Point struct {
+	Name      string
+	Tags      map[string]string
+	Value     float64
+	Timestamp uint
+	// Millis are milliseconds of the timestamp for sub-second intervals
+	Millis uint
+	// raw is the metric name as given to NewPoint, it's written by AppendCarbon
+	raw string
+}
+
+// NewPoint returns the Point for the metric name, which can contain graphite tags. If any tag isn't in 'tag=value'
+// format, the whole name is used as is.
+func NewPoint(name string, value float64, timestamp uint) Point {
+	p := Point{Name: name, Value: value, Timestamp: timestamp, raw: name}
+	i := strings.IndexByte(name, ';')
+	if i == -1 {
+		return p
+	}
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(name[i+1:], ";") {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" {
+			return p
+		}
+		tags[k] = v
+	}
+	p.Name = name[:i]
+	p.Tags = tags
+	return p
+}
+
+// Path returns the metric name with tags sorted by name, e.g. 'metric.name;tag1=value1;tag2=value2'
+func (p Point) Path() string {
+	if len(p.Tags) == 0 {
+		return p.Name
+	}
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := new(strings.Builder)
+	b.WriteString(p.Name)
+	for _, k := range keys {
+		b.WriteByte(';')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(p.Tags[k])
+	}
+	return b.String()
+}
+
+// AppendCarbon appends the point in carbon plain-text format, e.g. 'metric.name 123.33 1234567890\n'. The name is
+// written as given to NewPoint, and the Path is used for the points created otherwise. The timestamp with milliseconds
+// is fractional, e.g. '1234567890.500'.
+func (p Point) AppendCarbon(b []byte) []byte {
+	if p.raw != "" {
+		b = append(b, p.raw...)
+	} else {
+		b = append(b, p.Path()...)
+	}
+	b = append(b, ' ')
+	b = strconv.AppendFloat(b, p.Value, 'f', -1, 64)
+	b = append(b, ' ')
+	b = strconv.AppendUint(b, uint64(p.Timestamp), 10)
+	if p.Millis != 0 {
+		b = append(b, '.', byte('0'+p.Millis/100%10), byte('0'+p.Millis/10%10), byte('0'+p.Millis%10))
+	}
+	return append(b, '\n')
+}
+
+// String returns the point in carbon plain-text format without the trailing newline
+func (p Point) String() string {
+	b := p.AppendCarbon(nil)
+	return string(b[:len(b)-1])
+}
+
+// dropper is implemented by generators, which drop points by probability
+type dropper interface {
+	// drop reports if the current point is dropped. It changes the probability state, so it's called once per point
+	drop() bool
+}
+
+// emitter is implemented by generators, which send other points than the current one, e.g. the delayed points
+type emitter interface {
+	// emit returns the points to send at the current time and reports if the current point is dropped. It changes the
+	// state, so it's called once per point
+	emit() ([]Point, bool)
+}
+
+// isDropped reports if the current point of the Generator is dropped by probability
+func isDropped(g Generator) bool {
+	d, ok := g.(dropper)
+	return ok && d.drop()
+}
+
+// Points returns the iterator over the points of the Generator from the current one to the last. The points dropped by
+// probability are skipped, so it produces the same points as WriteTo and Next calls.
+func Points(g Generator) iter.Seq[Point] {
+	return func(yield func(Point) bool) {
+		for {
+			if e, ok := g.(emitter); ok {
+				points, _ := e.emit()
+				for _, p := range points {
+					if !yield(p) {
+						return
+					}
+				}
+			} else if !isDropped(g) && !yield(g.Current()) {
+				return
+			}
+			if g.Next() != nil {
+				return
+			}
+		}
+	}
+}
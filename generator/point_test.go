@@ -0,0 +1,126 @@
+package generator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPoint(t *testing.T) {
+	assert.Equal(t, Point{Name: "metric.name", Value: 1.5, Timestamp: 10, raw: "metric.name"}, NewPoint("metric.name", 1.5, 10))
+	p := NewPoint("metric.name;dc=west;app=web", 2, 20)
+	assert.Equal(t, Point{Name: "metric.name", Tags: map[string]string{"dc": "west", "app": "web"}, Value: 2, Timestamp: 20,
+		raw: "metric.name;dc=west;app=web"}, p)
+	assert.Equal(t, "metric.name;app=web;dc=west", p.Path())
+	// the name is written as given
+	assert.Equal(t, "metric.name;dc=west;app=web 2 20", p.String())
+	assert.Equal(t, "prefix metric.name;dc=west;app=web 2 20\n", string(p.AppendCarbon([]byte("prefix "))))
+	// the points created without NewPoint are written by the Path
+	p = Point{Name: "metric.name", Tags: map[string]string{"dc": "west", "app": "web"}, Value: 2, Timestamp: 20}
+	assert.Equal(t, "metric.name;app=web;dc=west 2 20", p.String())
+	// malformed tags are kept in the name
+	assert.Equal(t, Point{Name: "metric;tag", Value: 3, raw: "metric;tag"}, NewPoint("metric;tag", 3, 0))
+	assert.Equal(t, Point{Name: "metric;=value", Value: 3, raw: "metric;=value"}, NewPoint("metric;=value", 3, 0))
+	assert.Equal(t, "metric 0.001 1700000000\n", string(NewPoint("metric", 0.001, 1700000000).AppendCarbon(nil)))
+	for millis, ts := range map[uint]string{5: "1700000000.005", 50: "1700000000.050", 500: "1700000000.500", 999: "1700000000.999"} {
+		p := Point{Name: "metric", Value: 1, Timestamp: 1700000000, Millis: millis}
+		assert.Equal(t, "metric 1 "+ts+"\n", string(p.AppendCarbon(nil)))
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	c, err := NewConst("metric;tag=value", 12, 15, 1, false, 30, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, Point{Name: "metric", Tags: map[string]string{"tag": "value"}, Value: 30, Timestamp: 12,
+		raw: "metric;tag=value"}, c.Current())
+	assert.Equal(t, "metric;tag=value 30 12\n", string(c.Point()))
+	c, err = NewConst("metric;b=1;a=2", 12, 15, 1, false, 30, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "metric;b=1;a=2 30 12\n", string(c.Point()), "the tags order is kept")
+}
+
+func TestPoints(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(1)
+	g, err := New("random", "metric", 1, 100, 1, false, 10, 3, 30)
+	require.NoError(t, err)
+	expected := new(bytes.Buffer)
+	for err == nil {
+		_, err = g.WriteTo(expected)
+		require.NoError(t, err)
+		err = g.Next()
+	}
+
+	g, err = New("random", "metric", 1, 100, 1, false, 10, 3, 30)
+	require.NoError(t, err)
+	var result []byte
+	for p := range Points(g) {
+		result = p.AppendCarbon(result)
+	}
+	assert.Equal(t, expected.String(), string(result))
+	assert.Less(t, bytes.Count(result, []byte{'\n'}), 101)
+
+	// stop in the middle
+	g, err = New("const", "metric", 1, 100, 1, false, 10, 0, 100)
+	require.NoError(t, err)
+	count := 0
+	for p := range Points(g) {
+		assert.Equal(t, uint(count+1), p.Timestamp)
+		count++
+		if count == 3 {
+			break
+		}
+	}
+	assert.Equal(t, 3, count)
+}
+
+func TestGeneratorsPoints(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(1)
+	gg, err := NewExpand("counter", "metric.{1..5}", 1, 20, 2, true, 10, 3, 50)
+	require.NoError(t, err)
+	expected := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(expected)
+	require.NoError(t, err)
+	dropped := gg.Dropped()
+	assert.NotZero(t, dropped)
+
+	gg, err = NewExpand("counter", "metric.{1..5}", 1, 20, 2, true, 10, 3, 50)
+	require.NoError(t, err)
+	var result []byte
+	for p := range gg.Points() {
+		result = p.AppendCarbon(result)
+	}
+	assert.Equal(t, expected.String(), string(result))
+	assert.Equal(t, dropped, gg.Dropped())
+
+	empty := Generators{}
+	for range empty.Points() {
+		t.Fatal("no points are expected")
+	}
+}
+
+func TestLazyGeneratorsPoints(t *testing.T) {
+	lg, err := NewLazy("const", "metric.{1..2500}", 1, 30, 10, false, 7, 0, 100)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = lg.WriteAllTo(buf)
+	require.NoError(t, err)
+
+	var result []byte
+	for p := range lg.Points() {
+		result = p.AppendCarbon(result)
+	}
+	assert.Equal(t, buf.String(), string(result))
+
+	count := 0
+	for range lg.Points() {
+		count++
+		if count == lazyBatch+1 {
+			break
+		}
+	}
+	assert.Equal(t, lazyBatch+1, count)
+}
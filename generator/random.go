@@ -1,30 +1,27 @@
 package generator
 
-import "math/rand"
-
 // Random works like Const, but each next value is calculated like value±deviation
 type Random struct {
 	base
+	// initial is the value the walk is started from, it's changed by Tune
+	initial float64
 }
 
 // NewRandom returns new generator for growing points. Without deviation it behaves like constant.
 func NewRandom(name string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) (*Random, error) {
-	if !probabilityIsCorrect(probabilityStart) {
-		return nil, ErrProbabilityStart
+	return newRandom(positionalSpec("random", name, start, stop, step, randomizeStart, value, deviation, probabilityStart))
+}
+
+// newRandom returns new Random for the spec
+func newRandom(s Spec) (*Random, error) {
+	if err := CheckProbability(s.Probability); err != nil {
+		return nil, err
 	}
 	c := &Random{
-		base: base{
-			name:          name,
-			generatorType: RandomType,
-			start:         start,
-			stop:          stop,
-			step:          step,
-			value:         value,
-			deviation:     deviation,
-			probability:   newProbability(probabilityStart),
-		},
+		base:    newBase(s, RandomType),
+		initial: s.Value,
 	}
-	c.RandomizeStart(randomizeStart)
+	c.RandomizeStart(s.Randomize)
 	return c, nil
 }
 
@@ -35,7 +32,19 @@ func (r *Random) Next() error {
 		return err
 	}
 	if r.Deviation() != 0 {
-		r.value += r.Deviation() * (1 - rand.Float64()*2)
+		r.value += r.Deviation() * (1 - randFloat64(r.rand)*2)
+	}
+	return nil
+}
+
+// Tune sets new parameters for the generator. The walk is started again from the value only when it differs from
+// the previous initial value, so tuning other parameters keeps the current value.
+func (r *Random) Tune(step uint, value, deviation float64, probability uint8) error {
+	if err := r.tune(step, deviation, probability); err != nil {
+		return err
+	}
+	if value != r.initial {
+		r.value, r.initial = value, value
 	}
 	return nil
 }
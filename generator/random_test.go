@@ -8,7 +8,7 @@ import (
 
 func TestRandomNew(t *testing.T) {
 	c, _ := NewRandom("metric.name", 12, 15, 1, false, 30, 0, 100)
-	expected := &Random{}
+	expected := &Random{initial: 30}
 	expected.base = base{
 		name:          "metric.name",
 		generatorType: RandomType,
@@ -57,3 +57,20 @@ func TestRandomNext(t *testing.T) {
 	assert.Equal(t, uint(16), r.time)
 	assert.NotEqual(t, float64(0), r.value)
 }
+
+func TestRandomTune(t *testing.T) {
+	r, err := NewRandom("metric.name", 12, 15, 1, false, 30, 0, 100)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Tune(5, 12, 1, 30))
+	assert.Equal(t, uint(5), r.step)
+	assert.Equal(t, float64(12), r.value)
+	assert.Equal(t, float64(1), r.deviation)
+	assert.Equal(t, uint8(30), r.probability.start)
+	assert.ErrorIs(t, r.Tune(5, 12, 1, 0), ErrProbabilityStart)
+
+	// the same value keeps the walk
+	r.value = 15
+	assert.NoError(t, r.Tune(10, 12, 1, 30))
+	assert.Equal(t, uint(10), r.step)
+	assert.Equal(t, float64(15), r.value)
+}
@@ -0,0 +1,67 @@
+package generator
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ErrTypeRegistered is returned when the type name is already taken
+var ErrTypeRegistered = fmt.Errorf("type is already registered")
+
+// Factory creates the Generator for the spec. It's called for each expanded name, and should validate the spec.
+type Factory func(Spec) (Generator, error)
+
+var (
+	registryMu sync.RWMutex
+	// registered keeps the types added by Register, the built-in types are in typesMap
+	registered      = map[string]Type{}
+	registeredNames []string
+	factories       = map[Type]Factory{
+		ConstType:   func(s Spec) (Generator, error) { return newConst(s) },
+		CounterType: func(s Spec) (Generator, error) { return newCounter(s) },
+		RandomType:  func(s Spec) (Generator, error) { return newRandom(s) },
+		ReplayType:  func(s Spec) (Generator, error) { return newReplay(s) },
+	}
+	nextType = endType
+)
+
+// Register adds the generator type with the name. After that the name is accepted by New, NewExpand, NewFromSpec,
+// and by the type of generators in the coal-mine config and flags. It's expected to be called from init functions.
+func Register(name string, factory Factory) error {
+	if name == "" || factory == nil {
+		return fmt.Errorf("%w: name and factory must be set", ErrWrongType)
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := typesMap[name]; ok {
+		return fmt.Errorf("%w: %s", ErrTypeRegistered, name)
+	}
+	if _, ok := registered[name]; ok {
+		return fmt.Errorf("%w: %s", ErrTypeRegistered, name)
+	}
+	if nextType == Type(255) {
+		return fmt.Errorf("%w: too many types, %s is not registered", ErrWrongType, name)
+	}
+	registered[name] = nextType
+	registeredNames = append(registeredNames, name)
+	factories[nextType] = factory
+	nextType++
+	return nil
+}
+
+// TypeNames returns names of the built-in and then registered types
+func TypeNames() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(types)+len(registeredNames))
+	names = append(names, types...)
+	return append(names, registeredNames...)
+}
+
+// getFactory returns the Factory for the type
+func getFactory(t Type) (Factory, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	f, ok := factories[t]
+	return f, ok
+}
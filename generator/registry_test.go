@@ -0,0 +1,56 @@
+package generator
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unregister removes the type added by Register, so the tests can be repeated
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	t, ok := registered[name]
+	if !ok {
+		return
+	}
+	delete(registered, name)
+	delete(factories, t)
+	registeredNames = slices.DeleteFunc(registeredNames, func(n string) bool { return n == name })
+	if t == nextType-1 {
+		nextType--
+	}
+}
+
+func TestRegister(t *testing.T) {
+	assert.ErrorIs(t, Register("const", func(s Spec) (Generator, error) { return newConst(s) }), ErrTypeRegistered)
+	assert.ErrorIs(t, Register("", func(s Spec) (Generator, error) { return newConst(s) }), ErrWrongType)
+	assert.ErrorIs(t, Register("nil-factory", nil), ErrWrongType)
+
+	// the registered type produces constants with doubled value
+	t.Cleanup(func() { unregister("double") })
+	require.NoError(t, Register("double", func(s Spec) (Generator, error) {
+		s.Value *= 2
+		return newConst(s)
+	}))
+	assert.ErrorIs(t, Register("double", func(s Spec) (Generator, error) { return newConst(s) }), ErrTypeRegistered)
+	assert.Equal(t, []string{"undefined", "const", "counter", "random", "replay", "double"}, TypeNames())
+
+	gt, err := GetType("double")
+	require.NoError(t, err)
+	assert.Equal(t, endType, gt)
+	assert.NoError(t, NewSpec("double", "metric").Validate())
+
+	g, err := New("double", "metric", 1, 1, 1, false, 2, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "metric 4 1\n", string(g.Point()))
+	gg, err := NewExpand("double", "metric.{1..2}", 1, 1, 1, false, 3, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "double", gg.TypeName())
+	assert.Equal(t, "metric.1 6 1\nmetric.2 6 1\n", string(gg.Point()))
+
+	_, err = New("undefined", "metric", 1, 1, 1, false, 2, 0, 100)
+	assert.ErrorIs(t, err, ErrNotImplemented)
+}
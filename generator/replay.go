@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrReplaySource is returned for replay sources, which can't be loaded
+var ErrReplaySource = errors.New("invalid replay source")
+
+// Replay produces values of the series loaded from the file. The series is rescaled to the range from start to
+// stop, or played with its own step when Spec.Loop is set or the range is empty like in the online modes. The noise
+// within ±deviation is added to each value, and the missing values of the series aren't sent.
+type Replay struct {
+	base
+	series *replaySeries
+	loop   bool
+	origin uint
+	points uint64
+}
+
+// newReplay returns new Replay for the spec, the source is loaded once and shared between generators
+func newReplay(s Spec) (*Replay, error) {
+	if err := CheckProbability(s.Probability); err != nil {
+		return nil, err
+	}
+	series, err := loadReplay(s.Source, s.log())
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{
+		base:   newBase(s, ReplayType),
+		series: series,
+		loop:   s.Loop,
+	}
+	r.RandomizeStart(s.Randomize)
+	r.origin = r.time
+	if r.step != 0 && r.origin < r.stop {
+		r.points = uint64((r.stop-r.origin)/r.step) + 1
+	}
+	r.setValue()
+	return r, nil
+}
+
+// Next sets value and time for the next point
+func (r *Replay) Next() error {
+	if err := r.nextTime(); err != nil {
+		return err
+	}
+	r.setValue()
+	return nil
+}
+
+// setValue sets the value of the series for the current time with the noise
+func (r *Replay) setValue() {
+	r.value = r.series.value(r.index())
+	if r.deviation != 0 && !math.IsNaN(r.value) {
+		r.value += r.deviation * (1 - randFloat64(r.rand)*2)
+	}
+}
+
+// index returns the index of the series value for the current time, -1 means there is no value
+func (r *Replay) index() int {
+	n := uint64(len(r.series.values))
+	offset := uint64(r.time - r.origin)
+	if r.points == 0 || r.loop {
+		i := offset / uint64(r.series.step)
+		if r.loop {
+			i %= n
+		}
+		if n <= i {
+			return -1
+		}
+		return int(i)
+	}
+	// the rescaled series, the points after the stop get the last value
+	i := offset / uint64(r.step) * n / r.points
+	return int(min(i, n-1))
+}
+
+// Point returns the metric in carbon format, e.g. 'metric.name 123.33 1234567890\n'
+func (r *Replay) Point() []byte {
+	buf := new(bytes.Buffer)
+	r.WriteTo(buf)
+	return buf.Bytes()
+}
+
+// WriteTo writes the current point unless it's missing in the series or dropped by probability
+func (r *Replay) WriteTo(w io.Writer) (int64, error) {
+	if r.drop() {
+		return 0, nil
+	}
+	n, err := w.Write(r.Current().AppendCarbon(nil))
+	return int64(n), err
+}
+
+// drop reports if the current point is missing in the series or dropped by probability
+func (r *Replay) drop() bool {
+	return math.IsNaN(r.value) || r.base.drop()
+}
+
+// Tune sets new parameters for the generator, the value isn't used
+func (r *Replay) Tune(step uint, value, deviation float64, probability uint8) error {
+	return r.tune(step, deviation, probability)
+}
+
+// replaySeries is the series regularized by its step, the missing values are NaN
+type replaySeries struct {
+	name   string
+	step   uint
+	values []float64
+}
+
+func (s *replaySeries) value(i int) float64 {
+	if i < 0 {
+		return math.NaN()
+	}
+	return s.values[i]
+}
+
+// replayEntry is the cached series with the modification time and the size of its file
+type replayEntry struct {
+	series  *replaySeries
+	modTime time.Time
+	size    int64
+}
+
+var (
+	replayMu    sync.Mutex
+	replayCache = map[string]replayEntry{}
+)
+
+// loadReplay returns the series from the source 'path' or 'path#series name'. Without the name, the first series of
+// the file is used. Loaded series are cached by the source, and the cache is invalidated when the modification time
+// or the size of the file is changed, so the edited file is loaded again on reload.
+func loadReplay(source string, log *slog.Logger) (*replaySeries, error) {
+	replayMu.Lock()
+	defer replayMu.Unlock()
+	if source == "" {
+		return nil, fmt.Errorf("%w: the source file must be set", ErrReplaySource)
+	}
+	path, name, _ := strings.Cut(source, "#")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReplaySource, err)
+	}
+	if e, ok := replayCache[source]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.series, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReplaySource, err)
+	}
+	points, err := parseReplay(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrReplaySource, path, err)
+	}
+	s, err := newReplaySeries(points, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrReplaySource, path, err)
+	}
+	replayCache[source] = replayEntry{series: s, modTime: info.ModTime(), size: info.Size()}
+	log.Debug("replay source is loaded", "source", source, "series", s.name, "step", s.step, "points", len(s.values))
+	return s, nil
+}
+
+// parseReplay detects the format of data and returns its points in order of the file. The formats are graphite-web
+// JSON, graphite-web CSV and carbon plain-text.
+func parseReplay(data []byte) ([]Point, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	if trimmed[0] == '[' {
+		return parseReplayJSON(trimmed)
+	}
+	firstLine, _, _ := bytes.Cut(trimmed, []byte{'\n'})
+	if bytes.Contains(firstLine, []byte{','}) {
+		return parseReplayCSV(trimmed)
+	}
+	return parseReplayCarbon(trimmed)
+}
+
+// parseReplayJSON parses '[{"target": "name", "datapoints": [[value, timestamp], ...]}, ...]'
+func parseReplayJSON(data []byte) ([]Point, error) {
+	var series []struct {
+		Target     string        `json:"target"`
+		Datapoints [][2]*float64 `json:"datapoints"`
+	}
+	if err := json.Unmarshal(data, &series); err != nil {
+		return nil, err
+	}
+	var points []Point
+	for _, s := range series {
+		for _, dp := range s.Datapoints {
+			if dp[1] == nil {
+				return nil, fmt.Errorf("timestamp of %s is null", s.Target)
+			}
+			value := math.NaN()
+			if dp[0] != nil {
+				value = *dp[0]
+			}
+			points = append(points, Point{Name: s.Target, Value: value, Timestamp: uint(*dp[1])})
+		}
+	}
+	return points, nil
+}
+
+// parseReplayCSV parses 'name,timestamp,value' lines. The timestamp is unix or '2006-01-02 15:04:05' in the local
+// time zone like graphite-web writes, the empty value is missing.
+func parseReplayCSV(data []byte) ([]Point, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = 3
+	var points []Point
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return points, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		ts, err := parseReplayTime(record[1])
+		if err != nil {
+			return nil, err
+		}
+		value := math.NaN()
+		if record[2] != "" {
+			if value, err = strconv.ParseFloat(record[2], 64); err != nil {
+				return nil, err
+			}
+		}
+		points = append(points, Point{Name: record[0], Value: value, Timestamp: ts})
+	}
+}
+
+func parseReplayTime(s string) (uint, error) {
+	if ts, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return uint(ts), nil
+	}
+	t, err := time.ParseInLocation(time.DateTime, s, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return uint(t.Unix()), nil
+}
+
+// parseReplayCarbon parses 'name value timestamp' lines
+func parseReplayCarbon(data []byte) ([]Point, error) {
+	var points []Point
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %q should be 'name value timestamp'", scanner.Text())
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, err
+		}
+		points = append(points, Point{Name: fields[0], Value: value, Timestamp: uint(ts)})
+	}
+	return points, scanner.Err()
+}
+
+// newReplaySeries returns the series with the name or the first one of points. The step is the minimal interval
+// between timestamps, the last value wins for duplicated timestamps.
+func newReplaySeries(points []Point, name string) (*replaySeries, error) {
+	if name == "" && len(points) != 0 {
+		name = points[0].Name
+	}
+	var selected []Point
+	for _, p := range points {
+		if p.Name == name {
+			selected = append(selected, p)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no points for series %q", name)
+	}
+	sort.SliceStable(selected, func(i, j int) bool { return selected[i].Timestamp < selected[j].Timestamp })
+	s := &replaySeries{name: name}
+	for i := 1; i < len(selected); i++ {
+		diff := selected[i].Timestamp - selected[i-1].Timestamp
+		if diff != 0 && (s.step == 0 || diff < s.step) {
+			s.step = diff
+		}
+	}
+	if s.step == 0 {
+		s.step = 1
+	}
+	first, last := selected[0].Timestamp, selected[len(selected)-1].Timestamp
+	s.values = make([]float64, (last-first)/s.step+1)
+	for i := range s.values {
+		s.values[i] = math.NaN()
+	}
+	for _, p := range selected {
+		s.values[(p.Timestamp-first)/s.step] = p.Value
+	}
+	return s, nil
+}
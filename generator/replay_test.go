@@ -0,0 +1,158 @@
+package generator
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Felixoid/coal-mine/receiver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeReplaySource(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func replayValues(t *testing.T, gg Generators) []float64 {
+	t.Helper()
+	var values []float64
+	for p := range gg.Points() {
+		values = append(values, p.Value)
+	}
+	return values
+}
+
+func TestParseReplay(t *testing.T) {
+	for format, content := range map[string]string{
+		"json":   `[{"target": "a", "datapoints": [[1, 60], [null, 120], [3, 180]]}, {"target": "b", "datapoints": [[5, 60]]}]`,
+		"csv":    "a,60,1\na,120,\na,180,3\nb,60,5\n",
+		"carbon": "a 1 60\na nan 120\n\na 3 180\nb 5 60\n",
+	} {
+		points, err := parseReplay([]byte(content))
+		require.NoError(t, err, format)
+		require.Len(t, points, 4, format)
+		assert.Equal(t, Point{Name: "a", Value: 1, Timestamp: 60}, points[0], format)
+		assert.True(t, math.IsNaN(points[1].Value), format)
+		assert.Equal(t, Point{Name: "b", Value: 5, Timestamp: 60}, points[3], format)
+	}
+
+	// graphite-web writes the datetime in the local time zone
+	points, err := parseReplay([]byte("a,2024-01-01 00:01:00,1\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint(time.Date(2024, 1, 1, 0, 1, 0, 0, time.Local).Unix()), points[0].Timestamp)
+
+	for _, content := range []string{"", "[{", `[{"target": "a", "datapoints": [[1, null]]}]`, "a,b\n", "a,x,1\n", "a 1\n", "a x 1\n"} {
+		_, err := parseReplay([]byte(content))
+		assert.Error(t, err, content)
+	}
+}
+
+func TestNewReplaySeries(t *testing.T) {
+	points := []Point{{Name: "a", Value: 1, Timestamp: 100}, {Name: "b", Value: 0, Timestamp: 0},
+		{Name: "a", Value: 4, Timestamp: 190}, {Name: "a", Value: 2, Timestamp: 130}, {Name: "a", Value: 3, Timestamp: 130}}
+	s, err := newReplaySeries(points, "")
+	require.NoError(t, err)
+	assert.Equal(t, "a", s.name)
+	assert.Equal(t, uint(30), s.step)
+	require.Len(t, s.values, 4)
+	assert.Equal(t, []float64{1, 3, 4}, []float64{s.values[0], s.values[1], s.values[3]}, "the last value of duplicates wins")
+	assert.True(t, math.IsNaN(s.values[2]))
+
+	s, err = newReplaySeries(points, "b")
+	require.NoError(t, err)
+	assert.Equal(t, &replaySeries{name: "b", step: 1, values: []float64{0}}, s)
+
+	_, err = newReplaySeries(points, "c")
+	assert.Error(t, err)
+}
+
+func TestReplay(t *testing.T) {
+	path := writeReplaySource(t, "series.txt", "other 0 0\nseries 1 1000\nseries 2 1010\nseries 3 1020\nseries 4 1030\n")
+	spec := func(options ...Option) Spec {
+		return NewSpec("replay", "metric", append([]Option{WithSource(path + "#series"), WithStep(10)}, options...)...)
+	}
+
+	// the range of 8 points is stretched, the point after the stop gets the last value
+	gg, err := NewExpandFromSpec(spec(WithRange(2000, 2070)))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 1, 2, 2, 3, 3, 4, 4, 4}, replayValues(t, gg))
+
+	// the range of 2 points is shrunk
+	gg, err = NewExpandFromSpec(spec(WithRange(2000, 2010)))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 3, 4}, replayValues(t, gg))
+
+	// the loop keeps the own step of the series
+	gg, err = NewExpandFromSpec(spec(WithRange(2000, 2090), WithStep(5), WithLoop(true)))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 1, 2, 2, 3, 3, 4, 4, 1, 1, 2, 2, 3, 3, 4, 4, 1, 1, 2, 2}, replayValues(t, gg))
+
+	// the empty range like in the online modes plays the series once with its own step
+	gg, err = NewExpandFromSpec(spec(WithRange(2000, 2000)))
+	require.NoError(t, err)
+	gg.SetStop(2100)
+	r := receiver.New(true)
+	_, err = gg.WriteAllTo(r)
+	require.NoError(t, err)
+	assert.Equal(t, receiver.Stats{Series: 1, Points: 4}, r.Stats())
+	assert.Equal(t, uint64(8), gg.Dropped(), "missing values are counted as dropped")
+
+	_, err = NewExpandFromSpec(NewSpec("replay", "metric"))
+	assert.ErrorIs(t, err, ErrReplaySource)
+	assert.ErrorIs(t, NewSpec("replay", "metric", WithSource(path+".missing")).Validate(), ErrReplaySource)
+	assert.NoError(t, spec().Validate())
+}
+
+func TestReplayDeviation(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	path := writeReplaySource(t, "series.json", `[{"target": "s", "datapoints": [[10, 0], [null, 60], [30, 120]]}]`)
+	spec := NewSpec("replay", "metric.{1..3}", WithSource(path), WithRange(0, 120), WithDeviation(1))
+	values := func() [][]float64 {
+		gg, err := NewExpandFromSpec(spec)
+		require.NoError(t, err)
+		result := make([][]float64, 3)
+		for p := range gg.Points() {
+			i := int(p.Name[len(p.Name)-1] - '1')
+			result[i] = append(result[i], p.Value)
+		}
+		return result
+	}
+	first := values()
+	assert.Equal(t, first, values(), "seeded values are reproducible")
+	for i, series := range first {
+		require.Len(t, series, 3, "the missing value isn't sent")
+		assert.InDelta(t, 10, series[0], 1, i)
+		assert.InDelta(t, 30, series[1], 1, i)
+		assert.InDelta(t, 30, series[2], 1, i)
+	}
+	assert.NotEqual(t, first[0], first[1], "each expanded series has own noise")
+}
+
+func TestLoadReplayChanged(t *testing.T) {
+	path := writeReplaySource(t, "changed.txt", "a 1 60\na 2 120\n")
+	s, err := loadReplay(path, discardLogger)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2}, s.values)
+	cached, err := loadReplay(path, discardLogger)
+	require.NoError(t, err)
+	assert.Same(t, s, cached, "the unchanged file is cached")
+
+	// the edited file is loaded again
+	require.NoError(t, os.WriteFile(path, []byte("a 3 60\na 4 120\n"), 0o644))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	s, err = loadReplay(path, discardLogger)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 4}, s.values)
+
+	require.NoError(t, os.Remove(path))
+	_, err = loadReplay(path, discardLogger)
+	assert.ErrorIs(t, err, ErrReplaySource)
+}
@@ -0,0 +1,226 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Felixoid/coal-mine/internal/storage"
+)
+
+var (
+	// ErrRollup is returned for retentions, which can't be used with the generator parameters
+	ErrRollup = errors.New("invalid rollup")
+	// ErrAggregation is returned for unknown aggregation methods
+	ErrAggregation = storage.ErrAggregation
+)
+
+// Retention is the precision and the amount of points of the archive like in storage-schemas.conf
+type Retention = storage.Retention
+
+// Aggregation is the method to aggregate the points into the lower precision one like in storage-aggregation.conf
+type Aggregation = storage.Aggregation
+
+// Aggregation methods
+const (
+	AggregationAverage = storage.Average
+	AggregationSum     = storage.Sum
+	AggregationLast    = storage.Last
+	AggregationMax     = storage.Max
+	AggregationMin     = storage.Min
+	AggregationAvgZero = storage.AvgZero
+	AggregationAbsMax  = storage.AbsMax
+	AggregationAbsMin  = storage.AbsMin
+)
+
+// ParseAggregation returns the Aggregation for the name like in storage-aggregation.conf
+func ParseAggregation(name string) (Aggregation, error) {
+	return storage.ParseAggregation(name)
+}
+
+// Rollup describes the resolution changing with the age of points like in whisper archives after the rollup. The
+// zero Rollup keeps the step for all points.
+type Rollup struct {
+	// Retentions are the archives from the highest precision, e.g. '10s:1d,1m:7d,1h:1y' in storage-schemas.conf. The
+	// first precision is the step of generated points, and the age is counted from the stop.
+	Retentions []Retention
+	// Aggregation is the method to aggregate the generated points into the lower precision ones, AggregationAverage
+	// by default
+	Aggregation Aggregation
+}
+
+// enabled reports if any retention is set
+func (r Rollup) enabled() bool {
+	return len(r.Retentions) != 0
+}
+
+// Check returns an error for invalid retentions or the unknown aggregation method. The retentions are checked like
+// by whisper: the precision decreases, each precision divides the next one, and the retention period increases.
+func (r Rollup) Check() error {
+	if !r.enabled() {
+		return nil
+	}
+	if err := storage.ValidateRetentions(r.Retentions); err != nil {
+		return fmt.Errorf("%w: %w", ErrRollup, err)
+	}
+	if r.Aggregation != 0 && !r.Aggregation.Valid() {
+		return fmt.Errorf("%w: %s", ErrAggregation, r.Aggregation)
+	}
+	return nil
+}
+
+// checkRollup returns ErrRollup if the step isn't the first precision of retentions, or the sub-second interval or
+// the jitter is set with retentions
+func (s Spec) checkRollup() error {
+	if !s.Rollup.enabled() {
+		return nil
+	}
+	if err := s.Rollup.Check(); err != nil {
+		return err
+	}
+	if s.Interval != 0 || s.Jitter != 0 {
+		return fmt.Errorf("%w: interval and jitter can't be used with retentions", ErrRollup)
+	}
+	if precision := uint(s.Rollup.Retentions[0].SecondsPerPoint); s.Step != precision {
+		return fmt.Errorf("%w: step %d is not the first precision %d", ErrRollup, s.Step, precision)
+	}
+	return nil
+}
+
+// rollupBounds returns the first timestamp of each retention band for the stop. The bounds are aligned down to the
+// precision of the next band, so its points aggregate whole intervals, and each band is at least its retention.
+func rollupBounds(retentions []Retention, stop uint) []uint {
+	bounds := make([]uint, len(retentions))
+	for i, r := range retentions {
+		var from uint
+		if period := uint(r.Duration()); period <= stop {
+			from = stop - period + 1
+		}
+		precision := uint(r.SecondsPerPoint)
+		if i+1 < len(retentions) {
+			precision = uint(retentions[i+1].SecondsPerPoint)
+		}
+		bounds[i] = from - from%precision
+		if i != 0 {
+			bounds[i] = min(bounds[i], bounds[i-1])
+		}
+	}
+	return bounds
+}
+
+// rollup is the Generator with the resolution changing with age. The points in the first retention are sent as is,
+// and the older ones are aggregated into the intervals of their retention precision. The points older than the last
+// retention aren't sent. The aggregated point is sent when the generator passes its interval.
+type rollup struct {
+	wrapper
+	rollup Rollup
+	step   uint
+	bounds []uint
+	// band is the retention of the aggregated interval, 0 when there is no interval
+	band     int
+	interval uint
+	point    Point
+	values   []float64
+	emitted  []Point
+}
+
+// newRollup wraps the generator created for the spec with its retentions
+func newRollup(g Generator, s Spec) *rollup {
+	r := s.Rollup
+	if r.Aggregation == 0 {
+		r.Aggregation = AggregationAverage
+	}
+	ro := &rollup{
+		wrapper: wrapper{Generator: g, name: s.Name},
+		rollup:  r,
+		step:    s.Step,
+		bounds:  rollupBounds(r.Retentions, s.Stop),
+	}
+	ro.emitter = ro
+	return ro
+}
+
+// retention returns the band of the timestamp and the start of the aggregated interval. The band is -1 for points
+// older than all retentions.
+func (r *rollup) retention(ts uint) (int, uint) {
+	for i, bound := range r.bounds {
+		if bound <= ts {
+			precision := uint(r.rollup.Retentions[i].SecondsPerPoint)
+			return i, ts - ts%precision
+		}
+	}
+	return -1, 0
+}
+
+// flush appends the aggregated point of the current interval to the emitted points
+func (r *rollup) flush() {
+	if r.band == 0 {
+		return
+	}
+	if len(r.values) != 0 {
+		p := r.point
+		total := int(uint(r.rollup.Retentions[r.band].SecondsPerPoint) / r.step)
+		p.Value = r.rollup.Aggregation.Aggregate(r.values, total)
+		p.Timestamp = r.interval
+		r.emitted = append(r.emitted, p)
+	}
+	r.band = 0
+	r.values = r.values[:0]
+}
+
+// emit returns the aggregated point of the passed interval and the current point of the first retention, and
+// reports if the current point is dropped by probability
+func (r *rollup) emit() ([]Point, bool) {
+	current := r.Generator.Current()
+	dropped := isDropped(r.Generator)
+	r.emitted = r.emitted[:0]
+	band, interval := r.retention(current.Timestamp)
+	if band != r.band || interval != r.interval {
+		r.flush()
+	}
+	switch {
+	case band == 0:
+		if !dropped {
+			r.emitted = append(r.emitted, current)
+		}
+	case 0 < band:
+		r.band, r.interval = band, interval
+		if !dropped {
+			r.point = current
+			r.values = append(r.values, current.Value)
+		}
+	}
+	return r.emitted, dropped
+}
+
+// Tune sets new parameters for the wrapped generator. The step is defined by retentions, so it isn't changed.
+func (r *rollup) Tune(_ uint, value, deviation float64, probability uint8) error {
+	return r.wrapper.Tune(r.step, value, deviation, probability)
+}
+
+// CountPointsRollup is CountPoints for the retentions. The points older than the last retention aren't counted, and
+// each aggregated interval is counted once.
+func CountPointsRollup(start, stop uint, rollup Rollup) uint64 {
+	if !rollup.enabled() {
+		return 0
+	}
+	step := uint(rollup.Retentions[0].SecondsPerPoint)
+	bounds := rollupBounds(rollup.Retentions, stop)
+	if stop < start {
+		// the single point is in the first retention
+		return 1
+	}
+	first := start
+	if first < bounds[0] {
+		first = start + (bounds[0]-start+step-1)/step*step
+	}
+	count := CountPoints(first, stop, step)
+	for i := 1; i < len(bounds); i++ {
+		lo, hi := max(bounds[i], start), bounds[i-1]
+		if hi <= lo {
+			continue
+		}
+		precision := uint(rollup.Retentions[i].SecondsPerPoint)
+		count += uint64((hi-1)/precision - lo/precision + 1)
+	}
+	return count
+}
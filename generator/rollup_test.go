@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRetentions are '10s:1m,1m:5m,5m:30m'
+var testRetentions = []Retention{{SecondsPerPoint: 10, Points: 6}, {SecondsPerPoint: 60, Points: 5}, {SecondsPerPoint: 300, Points: 6}}
+
+func testRollup(aggregation Aggregation) Rollup {
+	return Rollup{Retentions: testRetentions, Aggregation: aggregation}
+}
+
+func rollupPoints(t *testing.T, spec Spec) []Point {
+	t.Helper()
+	gg, err := NewExpandFromSpec(spec)
+	require.NoError(t, err)
+	var points []Point
+	for p := range gg.Points() {
+		points = append(points, p)
+	}
+	return points
+}
+
+func TestRollupCheck(t *testing.T) {
+	rollup := Rollup{Retentions: testRetentions[:2], Aggregation: AggregationSum}
+	assert.NoError(t, Rollup{}.Check())
+	assert.NoError(t, rollup.Check())
+	assert.NoError(t, NewSpec("const", "metric", WithRollup(rollup)).Validate())
+
+	for _, retentions := range [][]Retention{
+		{{SecondsPerPoint: 60, Points: 10}, {SecondsPerPoint: 10, Points: 100}},
+		{{SecondsPerPoint: 10, Points: 0}},
+		{{SecondsPerPoint: 10, Points: 10}, {SecondsPerPoint: 15, Points: 100}},
+		{{SecondsPerPoint: 10, Points: 10}, {SecondsPerPoint: 60, Points: 1}},
+		{{SecondsPerPoint: 10, Points: 3}, {SecondsPerPoint: 60, Points: 100}},
+	} {
+		assert.ErrorIs(t, Rollup{Retentions: retentions}.Check(), ErrRollup, retentions)
+	}
+	assert.ErrorIs(t, Rollup{Retentions: rollup.Retentions, Aggregation: 100}.Check(), ErrAggregation)
+	for _, spec := range []Spec{
+		NewSpec("const", "metric", WithRollup(rollup), WithStep(60)),
+		NewSpec("const", "metric", WithRollup(rollup), WithInterval(10*time.Second)),
+		NewSpec("const", "metric", WithRollup(rollup), WithJitter(time.Second, "")),
+	} {
+		assert.ErrorIs(t, spec.Validate(), ErrRollup)
+		_, err := NewFromSpec(spec)
+		assert.ErrorIs(t, err, ErrRollup)
+	}
+}
+
+func TestRollupBounds(t *testing.T) {
+	rollup := testRollup(0)
+	assert.Equal(t, []uint{3540, 3300, 1800}, rollupBounds(rollup.Retentions, 3600))
+	assert.Equal(t, []uint{0, 0, 0}, rollupBounds(rollup.Retentions, 30))
+}
+
+func TestRollup(t *testing.T) {
+	rollup := testRollup(AggregationSum)
+	points := rollupPoints(t, NewSpec("const", "metric", WithRange(0, 3600), WithValue(1), WithDeviation(0),
+		WithRollup(rollup)))
+	var timestamps []uint
+	var values []float64
+	for _, p := range points {
+		timestamps = append(timestamps, p.Timestamp)
+		values = append(values, p.Value)
+	}
+	assert.Equal(t, []uint{1800, 2100, 2400, 2700, 3000, 3300, 3360, 3420, 3480,
+		3540, 3550, 3560, 3570, 3580, 3590, 3600, 3610}, timestamps)
+	assert.Equal(t, []float64{30, 30, 30, 30, 30, 6, 6, 6, 6, 1, 1, 1, 1, 1, 1, 1, 1}, values)
+	assert.Equal(t, uint64(len(points)), CountPointsRollup(0, 3600, rollup))
+}
+
+func TestRollupConsistency(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	for _, method := range []Aggregation{AggregationAverage, AggregationMax, AggregationLast} {
+		rollup := testRollup(method)
+		spec := NewSpec("random", "metric", WithRange(1000, 3600), WithValue(10), WithDeviation(5), WithStep(10))
+		raw := rollupPoints(t, spec)
+		rolled := rollupPoints(t, NewSpec("random", "metric", WithRange(1000, 3600), WithValue(10),
+			WithDeviation(5), WithRollup(rollup)))
+		require.Len(t, rolled, int(CountPointsRollup(1000, 3600, rollup)))
+
+		r := newRollup(nil, NewSpec("random", "metric", WithRange(1000, 3600), WithRollup(rollup)))
+		intervals := make(map[uint][]float64)
+		for _, p := range raw {
+			if band, interval := r.retention(p.Timestamp); 0 < band {
+				intervals[interval] = append(intervals[interval], p.Value)
+			}
+		}
+		for _, p := range rolled {
+			if band, _ := r.retention(p.Timestamp); band == 0 {
+				continue
+			}
+			values := intervals[p.Timestamp]
+			require.NotEmpty(t, values, p)
+			assert.InDelta(t, method.Aggregate(values, len(values)), p.Value, 1e-9, "%s %s", method, p)
+		}
+		assert.Equal(t, raw[len(raw)-8:], rolled[len(rolled)-8:], "the latest points are the same")
+	}
+}
+
+func TestRollupGaps(t *testing.T) {
+	rollup := testRollup(0)
+	timestamps, dropped := gapsTimestamps(t, NewSpec("const", "metric", WithRange(0, 3600), WithRollup(rollup),
+		WithGaps(Gaps{Outages: []Window{{Start: 1800, Stop: 2000}}})))
+	assert.Len(t, timestamps["metric"], 16)
+	assert.NotContains(t, timestamps["metric"], uint(1800))
+	assert.Equal(t, uint64(1), dropped)
+}
+
+func TestRollupProbability(t *testing.T) {
+	rollup := testRollup(AggregationSum)
+	gg, err := NewExpandFromSpec(NewSpec("const", "metric", WithRange(0, 3600), WithValue(1), WithDeviation(0),
+		WithProbability(50), WithRollup(rollup)))
+	require.NoError(t, err)
+	var points []Point
+	for p := range gg.Points() {
+		points = append(points, p)
+	}
+	require.Len(t, points, 13)
+	assert.Equal(t, 15.0, points[0].Value, "a half of points is aggregated")
+	assert.Equal(t, uint64(181), gg.Dropped())
+}
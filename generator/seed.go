@@ -0,0 +1,96 @@
+package generator
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+)
+
+// seed is used to derive rand.Source for each generator. Without seed the global math/rand is used.
+var seed atomic.Pointer[int64]
+
+// SetSeed makes the generation reproducible. Each generator created after the call has own rand.Source derived from
+// the seed and the metric name, so the same names with the same parameters produce the same points.
+func SetSeed(s int64) {
+	seed.Store(&s)
+}
+
+// ResetSeed returns the package to the global math/rand
+func ResetSeed() {
+	seed.Store(nil)
+}
+
+// newSource returns the source for the metric name, or nil when the seed isn't set
+func newSource(name string) *splitMix64 {
+	s := seed.Load()
+	if s == nil {
+		return nil
+	}
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, *s)
+	h.Write([]byte(name))
+	return &splitMix64{h.Sum64()}
+}
+
+// newRand returns *rand.Rand for the source, or nil to use the global math/rand
+func newRand(source *splitMix64) *rand.Rand {
+	if source == nil {
+		return nil
+	}
+	return rand.New(source)
+}
+
+// randFloat64 returns rand.Float64 from r, or from the global source if r is nil
+func randFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.Float64()
+	}
+	return r.Float64()
+}
+
+// randNormFloat64 returns rand.NormFloat64 from r, or from the global source if r is nil
+func randNormFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.NormFloat64()
+	}
+	return r.NormFloat64()
+}
+
+// randExpFloat64 returns rand.ExpFloat64 from r, or from the global source if r is nil
+func randExpFloat64(r *rand.Rand) float64 {
+	if r == nil {
+		return rand.ExpFloat64()
+	}
+	return r.ExpFloat64()
+}
+
+// randIntn returns rand.Intn from r, or from the global source if r is nil
+func randIntn(r *rand.Rand, n int) int {
+	if r == nil {
+		return rand.Intn(n)
+	}
+	return r.Intn(n)
+}
+
+// splitMix64 is the tiny rand.Source64. The default rand.Source takes about 5KiB, which is too much for millions of
+// generators.
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (s *splitMix64) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+func (s *splitMix64) Seed(seed int64) {
+	s.state = uint64(seed)
+}
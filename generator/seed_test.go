@@ -0,0 +1,63 @@
+package generator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seededPoints(t *testing.T, typeName, name string) []byte {
+	gg, err := NewExpand(typeName, name, 1700000000, 1700003600, 60, true, 100, 10, 60)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(buf)
+	require.NoError(t, err)
+	return buf.Bytes()
+}
+
+func seriesLines(points []byte, prefix string) []byte {
+	buf := new(bytes.Buffer)
+	for _, line := range bytes.SplitAfter(points, []byte{'\n'}) {
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			buf.Write(line)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestSetSeed(t *testing.T) {
+	defer ResetSeed()
+	assert.Nil(t, newSource("metric"))
+
+	SetSeed(42)
+	for _, typeName := range types {
+		if typeName == "undefined" || typeName == "replay" {
+			// replay requires the source, it's checked in TestReplayDeviation
+			continue
+		}
+		first := seededPoints(t, typeName, "metric.{1..10}")
+		assert.Equal(t, first, seededPoints(t, typeName, "metric.{1..10}"), typeName)
+		// the source depends on the name only, not on the neighbours
+		single := seededPoints(t, typeName, "metric.3")
+		assert.Equal(t, single, seriesLines(seededPoints(t, typeName, "metric.{3..5}"), "metric.3 "), typeName)
+	}
+	first := seededPoints(t, "random", "metric.{1..10}")
+
+	SetSeed(43)
+	assert.NotEqual(t, first, seededPoints(t, "random", "metric.{1..10}"))
+
+	ResetSeed()
+	assert.Nil(t, newSource("metric"))
+}
+
+func TestSplitMix64(t *testing.T) {
+	s := &splitMix64{}
+	// the reference values for the zero state
+	assert.Equal(t, uint64(0xe220a8397b1dcdaf), s.Uint64())
+	assert.Equal(t, uint64(0x6e789e6aa1b965f4), s.Uint64())
+	s.Seed(0)
+	assert.Equal(t, uint64(0xe220a8397b1dcdaf), s.Uint64())
+	assert.LessOrEqual(t, int64(0), s.Int63())
+}
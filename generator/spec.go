@@ -0,0 +1,264 @@
+package generator
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Spec is the set of parameters shared by all generator types
+type Spec struct {
+	// Type is the name of the generator type, e.g. 'const'
+	Type string
+	// Name is the metric name. For NewExpandFromSpec and NewLazyFromSpec it's expanded like in shell
+	Name string
+	// Start is the timestamp of the first point
+	Start uint
+	// Stop is the timestamp of the last point, one more point after it is produced as well
+	Stop uint
+	// Step is the interval between points in seconds
+	Step uint
+	// Interval is the step with sub-second precision, e.g. 500ms. When it's set, the Step is used only for the
+	// whole groups, like the online mode scheduling, and timestamps of points have milliseconds.
+	Interval time.Duration
+	// Jitter is the deviation of each step, the timestamps of points with jitter have milliseconds
+	Jitter time.Duration
+	// JitterDistribution is JitterUniform (default) in [step-jitter,step+jitter] or JitterNormal with the jitter as
+	// the standard deviation
+	JitterDistribution string
+	// Randomize shifts the start with [0,step)
+	Randomize bool
+	// Value is the first value, its meaning depends on the generator type
+	Value float64
+	// Deviation is the deviation of values, its meaning depends on the generator type
+	Deviation float64
+	// Probability is the probability of points to be sent in [1,100]
+	Probability uint8
+	// Source is the file with the series for the replay type, 'path' or 'path#series name'
+	Source string
+	// Loop makes the replay type repeat the series with its own step instead of rescaling it to the range
+	Loop bool
+	// Gaps are the outages, silence periods and delays of points
+	Gaps Gaps
+	// Disorder are the duplicated, reordered and skewed timestamps of points
+	Disorder Disorder
+	// Rollup is the resolution changing with the age of points, the Step must be its first precision
+	Rollup Rollup
+	// Logger is used for messages about the generators of the spec, nothing is logged when it's nil
+	Logger *slog.Logger
+	// group is the expandable name the Name is expanded from, it's shared by generators of the group
+	group string
+}
+
+// DefaultStep is the Spec.Step set by NewSpec
+const DefaultStep = 60
+
+// DefaultProbability is the Spec.Probability set by NewSpec, all points are sent
+const DefaultProbability = 100
+
+// Option changes the Spec
+type Option func(*Spec)
+
+// NewSpec returns the Spec with DefaultStep and DefaultProbability, and then applies options
+func NewSpec(typeName, name string, options ...Option) Spec {
+	s := Spec{Type: typeName, Name: name, Step: DefaultStep, Probability: DefaultProbability}
+	for _, o := range options {
+		o(&s)
+	}
+	return s
+}
+
+// WithRange sets the start and stop timestamps
+func WithRange(start, stop uint) Option {
+	return func(s *Spec) {
+		s.Start = start
+		s.Stop = stop
+	}
+}
+
+// WithStep sets the step in seconds
+func WithStep(step uint) Option {
+	return func(s *Spec) {
+		s.Step = step
+	}
+}
+
+// WithInterval sets the step with sub-second precision
+func WithInterval(interval time.Duration) Option {
+	return func(s *Spec) {
+		s.Interval = interval
+	}
+}
+
+// WithJitter sets the jitter of steps and its distribution
+func WithJitter(jitter time.Duration, distribution string) Option {
+	return func(s *Spec) {
+		s.Jitter = jitter
+		s.JitterDistribution = distribution
+	}
+}
+
+// WithRandomize toggles the randomized start
+func WithRandomize(randomize bool) Option {
+	return func(s *Spec) {
+		s.Randomize = randomize
+	}
+}
+
+// WithValue sets the value
+func WithValue(value float64) Option {
+	return func(s *Spec) {
+		s.Value = value
+	}
+}
+
+// WithDeviation sets the deviation
+func WithDeviation(deviation float64) Option {
+	return func(s *Spec) {
+		s.Deviation = deviation
+	}
+}
+
+// WithProbability sets the probability
+func WithProbability(probability uint8) Option {
+	return func(s *Spec) {
+		s.Probability = probability
+	}
+}
+
+// WithSource sets the source file of the replayed series
+func WithSource(source string) Option {
+	return func(s *Spec) {
+		s.Source = source
+	}
+}
+
+// WithLoop toggles the looped replay
+func WithLoop(loop bool) Option {
+	return func(s *Spec) {
+		s.Loop = loop
+	}
+}
+
+// WithGaps sets the gaps
+func WithGaps(gaps Gaps) Option {
+	return func(s *Spec) {
+		s.Gaps = gaps
+	}
+}
+
+// WithDisorder sets the disorder of timestamps
+func WithDisorder(disorder Disorder) Option {
+	return func(s *Spec) {
+		s.Disorder = disorder
+	}
+}
+
+// WithRollup sets the retentions and the aggregation method, the step is set to the first precision
+func WithRollup(rollup Rollup) Option {
+	return func(s *Spec) {
+		s.Rollup = rollup
+		if rollup.enabled() {
+			s.Step = uint(rollup.Retentions[0].SecondsPerPoint)
+		}
+	}
+}
+
+// WithLogger sets the logger for messages about the generators
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Spec) {
+		s.Logger = l
+	}
+}
+
+// log returns the logger of the spec or the discarding one
+func (s Spec) log() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return discardLogger
+}
+
+// groupName returns the expandable name of the group, the spec created before the expansion returns its name
+func (s Spec) groupName() string {
+	if s.group != "" {
+		return s.group
+	}
+	return s.Name
+}
+
+// positionalSpec returns the Spec for the arguments of the old constructors as is, without defaults
+func positionalSpec(typeName, name string, start, stop, step uint, randomizeStart bool, value, deviation float64, probabilityStart uint8) Spec {
+	return Spec{
+		Type:        typeName,
+		Name:        name,
+		Start:       start,
+		Stop:        stop,
+		Step:        step,
+		Randomize:   randomizeStart,
+		Value:       value,
+		Deviation:   deviation,
+		Probability: probabilityStart,
+	}
+}
+
+// Restorable reports if the state of generators for the spec is enough to continue them. The gaps, disorder and
+// retentions keep pending points outside of the wrapped generator, so such generators aren't restorable.
+func (s Spec) Restorable() bool {
+	return !s.Rollup.enabled() && !s.Gaps.enabled() && !s.Disorder.enabled()
+}
+
+// Validate returns an error if the type is unknown or the parameters are meaningless for it
+func (s Spec) Validate() error {
+	gt, err := GetType(s.Type)
+	if err != nil {
+		return err
+	}
+	if err := CheckProbability(s.Probability); err != nil {
+		return err
+	}
+	if s.Step == 0 && s.Interval == 0 {
+		return fmt.Errorf("%w: step is zero", ErrStep)
+	}
+	if err := CheckInterval(s.Interval, s.Jitter, s.JitterDistribution); err != nil {
+		return err
+	}
+	if err := s.Gaps.Check(); err != nil {
+		return err
+	}
+	if err := s.Disorder.Check(); err != nil {
+		return err
+	}
+	if err := s.checkRollup(); err != nil {
+		return err
+	}
+	switch gt {
+	case CounterType:
+		return CheckCounter(s.Value, s.Deviation)
+	case ReplayType:
+		_, err := loadReplay(s.Source, s.log())
+		return err
+	}
+	return nil
+}
+
+// newBase returns the base for the spec. The own rand.Source is created when the seed is set.
+func newBase(s Spec, t Type) base {
+	source := newSource(s.Name)
+	r := newRand(source)
+	return base{
+		name:               s.Name,
+		generatorType:      t,
+		start:              s.Start,
+		stop:               s.Stop,
+		step:               s.Step,
+		interval:           uint(s.Interval / time.Millisecond),
+		jitter:             uint(s.Jitter / time.Millisecond),
+		jitterDistribution: s.JitterDistribution,
+		value:              s.Value,
+		deviation:          s.Deviation,
+		probability:        newProbability(r, s.Probability),
+		rand:               r,
+		source:             source,
+	}
+}
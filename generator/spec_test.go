@@ -0,0 +1,78 @@
+package generator
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSpec(t *testing.T) {
+	assert.Equal(t, Spec{Type: "const", Name: "metric", Step: DefaultStep, Probability: DefaultProbability}, NewSpec("const", "metric"))
+	s := NewSpec("counter", "metric.{1..3}",
+		WithRange(10, 100),
+		WithStep(5),
+		WithRandomize(true),
+		WithValue(3),
+		WithDeviation(1.5),
+		WithProbability(40),
+	)
+	assert.Equal(t, Spec{
+		Type:        "counter",
+		Name:        "metric.{1..3}",
+		Start:       10,
+		Stop:        100,
+		Step:        5,
+		Randomize:   true,
+		Value:       3,
+		Deviation:   1.5,
+		Probability: 40,
+	}, s)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert.NoError(t, NewSpec("const", "metric").Validate())
+	assert.ErrorIs(t, NewSpec("invalid", "metric").Validate(), ErrWrongType)
+	assert.ErrorIs(t, NewSpec("random", "metric", WithProbability(0)).Validate(), ErrProbabilityStart)
+	assert.ErrorIs(t, NewSpec("counter", "metric", WithValue(-2), WithDeviation(1)).Validate(), ErrNewCounter)
+	assert.NoError(t, NewSpec("counter", "metric", WithValue(-2), WithDeviation(3)).Validate())
+}
+
+func TestSpecRestorable(t *testing.T) {
+	assert.True(t, NewSpec("const", "metric").Restorable())
+	assert.False(t, NewSpec("const", "metric", WithGaps(Gaps{Delay: 60})).Restorable())
+	assert.False(t, NewSpec("const", "metric", WithDisorder(Disorder{Shuffle: 120})).Restorable())
+	assert.False(t, NewSpec("const", "metric", WithRollup(Rollup{Retentions: []Retention{{SecondsPerPoint: 60, Points: 60}}})).Restorable())
+}
+
+func TestNewFromSpec(t *testing.T) {
+	for _, typeName := range []string{"const", "counter", "random"} {
+		s := NewSpec(typeName, "metric", WithRange(60, 600), WithValue(5))
+		g, err := NewFromSpec(s)
+		require.NoError(t, err)
+		old, err := New(typeName, "metric", 60, 600, DefaultStep, false, 5, 0, DefaultProbability)
+		require.NoError(t, err)
+		assert.Equal(t, old.Point(), g.Point(), typeName)
+	}
+	_, err := NewFromSpec(NewSpec("invalid", "metric"))
+	assert.ErrorIs(t, err, ErrWrongType)
+	_, err = NewFromSpec(NewSpec("const", "metric", WithProbability(101)))
+	assert.ErrorIs(t, err, ErrProbabilityStart)
+}
+
+func TestNewExpandFromSpec(t *testing.T) {
+	gg, err := NewExpandFromSpec(NewSpec("const", "metric.{1..3}", WithRange(60, 120), WithValue(1)))
+	require.NoError(t, err)
+	assert.Equal(t, 3, gg.Len())
+	assert.Equal(t, uint(DefaultStep), gg.Step())
+	buf := new(bytes.Buffer)
+	_, err = gg.WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "metric.1 1 60\nmetric.2 1 60\nmetric.3 1 60\n"+
+		"metric.1 1 120\nmetric.2 1 120\nmetric.3 1 120\n"+
+		"metric.1 1 180\nmetric.2 1 180\nmetric.3 1 180\n", buf.String())
+
+	_, err = NewExpandFromSpec(NewSpec("const", ""))
+	assert.ErrorIs(t, err, ErrEmptyGens)
+}
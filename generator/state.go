@@ -0,0 +1,94 @@
+package generator
+
+import (
+	"fmt"
+)
+
+// ErrWrongState is returned when the state can't be applied to the generator
+var ErrWrongState = fmt.Errorf("state doesn't match the generator")
+
+// State is the state of a generator, that is enough to continue the generation: the time and the value of the last
+// point, the current probability and the state of the seeded random source.
+type State struct {
+	Name        string  `json:"name"`
+	Time        uint    `json:"time"`
+	Millis      uint    `json:"millis,omitempty"`
+	Value       float64 `json:"value"`
+	Probability uint8   `json:"probability"`
+	Rand        *uint64 `json:"rand,omitempty"`
+}
+
+// Stater is implemented by generators, which state can be saved and restored
+type Stater interface {
+	// State returns the current state
+	State() State
+	// SetState restores the state. The zero Time keeps the current time of the generator.
+	SetState(State) error
+}
+
+// State returns the current state of the generator
+func (b *base) State() State {
+	s := State{
+		Name:        b.name,
+		Time:        b.time,
+		Millis:      b.ms,
+		Value:       b.value,
+		Probability: b.probability.current,
+	}
+	if b.source != nil {
+		r := b.source.state
+		s.Rand = &r
+	}
+	return s
+}
+
+// SetState restores the state of the generator. The random source is restored only if both are seeded.
+func (b *base) SetState(s State) error {
+	if s.Name != b.name {
+		return fmt.Errorf("%w: name %s is not %s", ErrWrongState, s.Name, b.name)
+	}
+	if 100 <= s.Probability {
+		return fmt.Errorf("%w: current probability %d is not in [0,100)", ErrWrongState, s.Probability)
+	}
+	if s.Time != 0 {
+		b.time, b.ms = s.Time, s.Millis
+	}
+	b.value = s.Value
+	b.probability.current = s.Probability
+	if b.source != nil && s.Rand != nil {
+		b.source.state = *s.Rand
+	}
+	return nil
+}
+
+// States returns states of all Generator implementing Stater
+func (gg *Generators) States() []State {
+	states := make([]State, 0, len(gg.gens))
+	for _, g := range gg.gens {
+		if s, ok := g.(Stater); ok {
+			states = append(states, s.State())
+		}
+	}
+	return states
+}
+
+// Restore sets states to Generator by their names. The generators without state are kept as is. It returns the
+// amount of restored generators.
+func (gg *Generators) Restore(states map[string]State) (int, error) {
+	restored := 0
+	for _, g := range gg.gens {
+		s, ok := g.(Stater)
+		if !ok {
+			continue
+		}
+		state, ok := states[s.State().Name]
+		if !ok {
+			continue
+		}
+		if err := s.SetState(state); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, nil
+}
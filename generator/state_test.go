@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestState(t *testing.T) {
+	defer ResetSeed()
+	SetSeed(42)
+	full, err := NewExpand("random", "metric.{1..3}", 1700000000, 1700001200, 60, true, 1, 10, 70)
+	require.NoError(t, err)
+	expected := new(bytes.Buffer)
+	_, err = full.WriteAllTo(expected)
+	require.NoError(t, err)
+
+	// the first half is written, and the second one continues from its state
+	first, err := NewExpand("random", "metric.{1..3}", 1700000000, 1700000600, 60, true, 1, 10, 70)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	_, err = first.WriteAllTo(buf)
+	require.NoError(t, err)
+	states := make(map[string]State)
+	for _, s := range first.States() {
+		require.NotNil(t, s.Rand)
+		states[s.Name] = s
+	}
+	require.Len(t, states, 3)
+
+	second, err := NewExpand("random", "metric.{1..3}", 1700000000, 1700001200, 60, true, 1, 10, 70)
+	require.NoError(t, err)
+	restored, err := second.Restore(states)
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored)
+	assert.Equal(t, first.States(), second.States())
+	require.NoError(t, second.Next())
+	_, err = second.WriteAllTo(buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected.String(), buf.String())
+}
+
+func TestSetState(t *testing.T) {
+	g, err := NewFromSpec(NewSpec("counter", "metric", WithRange(60, 120), WithValue(1)))
+	require.NoError(t, err)
+	s := g.(Stater)
+	state := s.State()
+	assert.Less(t, state.Probability, uint8(100))
+	// the current probability is randomized
+	state.Probability = 0
+	assert.Equal(t, State{Name: "metric", Time: 60, Value: 1}, state)
+
+	// the zero time keeps the current one
+	require.NoError(t, s.SetState(State{Name: "metric", Value: 10, Probability: 30}))
+	assert.Equal(t, State{Name: "metric", Time: 60, Value: 10, Probability: 30}, s.State())
+
+	assert.ErrorIs(t, s.SetState(State{Name: "other"}), ErrWrongState)
+	assert.ErrorIs(t, s.SetState(State{Name: "metric", Probability: 100}), ErrWrongState)
+
+	gg, err := NewExpand("const", "metric.{1..2}", 60, 120, 60, false, 1, 0, 100)
+	require.NoError(t, err)
+	restored, err := gg.Restore(map[string]State{"metric.2": {Name: "metric.2", Time: 120, Value: 5}, "metric.3": {}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, restored)
+	states := gg.States()
+	require.Len(t, states, 2)
+	assert.Equal(t, State{Name: "metric.2", Time: 120, Value: 5}, states[1])
+	assert.Equal(t, uint(60), states[0].Time)
+	_, err = gg.Restore(map[string]State{"metric.1": {Name: "metric.1", Probability: 200}})
+	assert.ErrorIs(t, err, ErrWrongState)
+
+	// milliseconds of sub-second intervals are kept
+	g, err = NewFromSpec(NewSpec("const", "metric", WithRange(60, 120), WithInterval(250*time.Millisecond)))
+	require.NoError(t, err)
+	require.NoError(t, g.Next())
+	assert.Equal(t, uint(250), g.(Stater).State().Millis)
+	require.NoError(t, g.(Stater).SetState(State{Name: "metric", Time: 61, Millis: 750}))
+	assert.Equal(t, Point{Name: "metric", Timestamp: 61, Millis: 750, raw: "metric"}, g.Current())
+}
@@ -0,0 +1,74 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// wrapper is embedded by the generators, which wrap the Generator and send other points than its current one. The
+// points are taken from the emitter, and the state, the stop time and new parameters are passed to the wrapped
+// generator.
+type wrapper struct {
+	Generator
+	name    string
+	emitter emitter
+}
+
+// Point returns the points to send at the current time in carbon format
+func (w *wrapper) Point() []byte {
+	buf := new(bytes.Buffer)
+	w.WriteTo(buf)
+	return buf.Bytes()
+}
+
+// WriteTo writes the points to send at the current time
+func (w *wrapper) WriteTo(wr io.Writer) (int64, error) {
+	points, _ := w.emitter.emit()
+	return writeEmitted(wr, points)
+}
+
+// State returns the state of the wrapped generator, the points kept by the wrapper aren't saved. See Spec.Restorable.
+func (w *wrapper) State() State {
+	if s, ok := w.Generator.(Stater); ok {
+		return s.State()
+	}
+	return State{Name: w.name}
+}
+
+// SetState restores the state of the wrapped generator
+func (w *wrapper) SetState(s State) error {
+	st, ok := w.Generator.(Stater)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a Stater", ErrWrongState, w.Generator)
+	}
+	return st.SetState(s)
+}
+
+// SetStopTime sets stop of the wrapped generator with millisecond precision if it's supported
+func (w *wrapper) SetStopTime(t time.Time) {
+	setStopTime(w.Generator, t)
+}
+
+// Tune sets new parameters for the wrapped generator
+func (w *wrapper) Tune(step uint, value, deviation float64, probability uint8) error {
+	t, ok := w.Generator.(Tuner)
+	if !ok {
+		return fmt.Errorf("%w: %T is not a Tuner", ErrNotImplemented, w.Generator)
+	}
+	return t.Tune(step, value, deviation, probability)
+}
+
+// writeEmitted writes the points in carbon format
+func writeEmitted(w io.Writer, points []Point) (int64, error) {
+	var b []byte
+	for _, p := range points {
+		b = p.AppendCarbon(b)
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := w.Write(b)
+	return int64(n), err
+}
@@ -0,0 +1,186 @@
+// Package storage implements the retentions of storage-schemas.conf and the aggregation methods of
+// storage-aggregation.conf shared by the whisper files, the generators with rollup and the verification.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrRetention is returned for invalid retention definitions
+	ErrRetention = errors.New("invalid retention")
+	// ErrAggregation is returned for unknown aggregation methods
+	ErrAggregation = errors.New("invalid aggregation method")
+)
+
+// Aggregation is the method to aggregate points of the higher precision into the lower precision one
+type Aggregation uint32
+
+// Aggregation methods with the same values as in the whisper file format
+const (
+	Average Aggregation = iota + 1
+	Sum
+	Last
+	Max
+	Min
+	AvgZero
+	AbsMax
+	AbsMin
+)
+
+var aggregationNames = []string{"", "average", "sum", "last", "max", "min", "avg_zero", "absmax", "absmin"}
+
+// ParseAggregation returns the Aggregation for the name like in storage-aggregation.conf
+func ParseAggregation(name string) (Aggregation, error) {
+	for i, n := range aggregationNames {
+		if i != 0 && n == name {
+			return Aggregation(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q is not in %v", ErrAggregation, name, aggregationNames[1:])
+}
+
+// Valid reports if the aggregation is one of the known methods
+func (a Aggregation) Valid() bool {
+	return a != 0 && int(a) < len(aggregationNames)
+}
+
+func (a Aggregation) String() string {
+	if !a.Valid() {
+		return "unknown(" + strconv.Itoa(int(a)) + ")"
+	}
+	return aggregationNames[a]
+}
+
+// Aggregate returns the aggregated known values. The amount of all points in the interval is used by avg_zero.
+func (a Aggregation) Aggregate(values []float64, total int) float64 {
+	switch a {
+	case Sum, Average, AvgZero:
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		switch a {
+		case Average:
+			return sum / float64(len(values))
+		case AvgZero:
+			return sum / float64(total)
+		}
+		return sum
+	case Last:
+		return values[len(values)-1]
+	case Max, AbsMax, Min, AbsMin:
+		result := values[0]
+		for _, v := range values[1:] {
+			switch {
+			case a == Max && v > result, a == Min && v < result,
+				a == AbsMax && math.Abs(v) > math.Abs(result), a == AbsMin && math.Abs(v) < math.Abs(result):
+				result = v
+			}
+		}
+		return result
+	}
+	return math.NaN()
+}
+
+// Retention is the precision and the amount of points of the archive
+type Retention struct {
+	SecondsPerPoint uint32
+	Points          uint32
+}
+
+// Duration returns the retention period in seconds
+func (r Retention) Duration() uint32 {
+	return r.SecondsPerPoint * r.Points
+}
+
+func (r Retention) String() string {
+	return strconv.FormatUint(uint64(r.SecondsPerPoint), 10) + ":" + strconv.FormatUint(uint64(r.Points), 10)
+}
+
+var unitSeconds = map[string]uint32{
+	"s": 1, "sec": 1, "second": 1, "seconds": 1,
+	"m": 60, "min": 60, "minute": 60, "minutes": 60,
+	"h": 3600, "hour": 3600, "hours": 3600,
+	"d": 86400, "day": 86400, "days": 86400,
+	"w": 604800, "week": 604800, "weeks": 604800,
+	"y": 31536000, "year": 31536000, "years": 31536000,
+}
+
+// parseDuration parses the duration like '10s' or '7d', the number without the unit is returned as is
+func parseDuration(s string) (uint32, bool, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return r < '0' || '9' < r })
+	if i == -1 {
+		n, err := strconv.ParseUint(s, 10, 32)
+		return uint32(n), false, err
+	}
+	n, err := strconv.ParseUint(s[:i], 10, 32)
+	if err != nil {
+		return 0, true, err
+	}
+	unit, ok := unitSeconds[s[i:]]
+	if !ok {
+		return 0, true, fmt.Errorf("unknown unit %q", s[i:])
+	}
+	return uint32(n) * unit, true, nil
+}
+
+// ParseRetentions parses the retentions like in storage-schemas.conf, e.g. '10s:1d,1m:7d,1h:1y' or '60:1440'. The
+// retentions are validated by ValidateRetentions.
+func ParseRetentions(s string) ([]Retention, error) {
+	var result []Retention
+	for _, def := range strings.Split(s, ",") {
+		def = strings.TrimSpace(def)
+		precision, period, ok := strings.Cut(def, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q should be 'precision:retention'", ErrRetention, def)
+		}
+		spp, _, err := parseDuration(precision)
+		if err != nil || spp == 0 {
+			return nil, fmt.Errorf("%w: precision of %q", ErrRetention, def)
+		}
+		points, isDuration, err := parseDuration(period)
+		if err != nil || points == 0 {
+			return nil, fmt.Errorf("%w: retention of %q", ErrRetention, def)
+		}
+		if isDuration {
+			points /= spp
+		}
+		result = append(result, Retention{SecondsPerPoint: spp, Points: points})
+	}
+	return result, ValidateRetentions(result)
+}
+
+// ValidateRetentions checks the retentions like whisper does: the precision decreases, each precision divides the
+// next one, and the retention period increases
+func ValidateRetentions(retentions []Retention) error {
+	if len(retentions) == 0 {
+		return fmt.Errorf("%w: no archives", ErrRetention)
+	}
+	for i, r := range retentions {
+		if r.SecondsPerPoint == 0 || r.Points == 0 {
+			return fmt.Errorf("%w: %s is empty", ErrRetention, r)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := retentions[i-1]
+		if r.SecondsPerPoint <= prev.SecondsPerPoint {
+			return fmt.Errorf("%w: precision of %s must be lower than of %s", ErrRetention, r, prev)
+		}
+		if r.SecondsPerPoint%prev.SecondsPerPoint != 0 {
+			return fmt.Errorf("%w: precision of %s must be divisible by %s", ErrRetention, r, prev)
+		}
+		if r.Duration() <= prev.Duration() {
+			return fmt.Errorf("%w: period of %s must be longer than of %s", ErrRetention, r, prev)
+		}
+		if prev.Points < r.SecondsPerPoint/prev.SecondsPerPoint {
+			return fmt.Errorf("%w: %s has not enough points to consolidate into %s", ErrRetention, prev, r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetentions(t *testing.T) {
+	rr, err := ParseRetentions("10s:1d, 1m:7d,1h:1y")
+	require.NoError(t, err)
+	assert.Equal(t, []Retention{{10, 8640}, {60, 10080}, {3600, 8760}}, rr)
+
+	rr, err = ParseRetentions("60:1440")
+	require.NoError(t, err)
+	assert.Equal(t, []Retention{{60, 1440}}, rr)
+
+	for _, s := range []string{"", "60", "0:10", "1x:1d", "1m:0", "1m:1d,1m:2d", "1m:1d,90s:7d", "1m:7d,1h:1d", "1m:30m,1h:1d"} {
+		_, err := ParseRetentions(s)
+		assert.ErrorIs(t, err, ErrRetention, s)
+	}
+}
+
+func TestParseAggregation(t *testing.T) {
+	a, err := ParseAggregation("avg_zero")
+	require.NoError(t, err)
+	assert.Equal(t, AvgZero, a)
+	assert.Equal(t, "avg_zero", a.String())
+	_, err = ParseAggregation("median")
+	assert.ErrorIs(t, err, ErrAggregation)
+	assert.False(t, Aggregation(100).Valid())
+	assert.Equal(t, "unknown(100)", Aggregation(100).String())
+}
+
+func TestAggregate(t *testing.T) {
+	values := []float64{1, -5, 3}
+	for method, expected := range map[string]float64{
+		"average": -1. / 3, "sum": -1, "last": 3, "max": 3, "min": -5, "avg_zero": -0.25, "absmax": -5, "absmin": 1,
+	} {
+		a, err := ParseAggregation(method)
+		require.NoError(t, err)
+		assert.Equal(t, method, a.String())
+		assert.InDelta(t, expected, a.Aggregate(values, 4), 1e-9, method)
+	}
+	assert.Equal(t, 1.0, AvgZero.Aggregate([]float64{2, 4}, 6))
+}
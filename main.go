@@ -24,7 +24,7 @@ import (
 )
 
 func main() {
-	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	signals := []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
 	signal.Notify(cmd.CatchedSignals, signals...)
 	cmd.Execute()
 }
@@ -0,0 +1,579 @@
+package receiver
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrPickle is returned for the pickle data, which can't be decoded as the carbon pickle format
+var ErrPickle = errors.New("unable to unpickle")
+
+// pickle opcodes used by python for lists of tuples with strings and numbers, protocols 0-5
+const (
+	opMark            = '('
+	opStop            = '.'
+	opPop             = '0'
+	opPopMark         = '1'
+	opDup             = '2'
+	opFloat           = 'F'
+	opInt             = 'I'
+	opBinInt          = 'J'
+	opBinInt1         = 'K'
+	opBinInt2         = 'M'
+	opLong            = 'L'
+	opNone            = 'N'
+	opString          = 'S'
+	opBinString       = 'T'
+	opShortBinString  = 'U'
+	opUnicode         = 'V'
+	opBinUnicode      = 'X'
+	opAppend          = 'a'
+	opGet             = 'g'
+	opBinGet          = 'h'
+	opLongBinGet      = 'j'
+	opList            = 'l'
+	opEmptyList       = ']'
+	opAppends         = 'e'
+	opPut             = 'p'
+	opBinPut          = 'q'
+	opLongBinPut      = 'r'
+	opTuple           = 't'
+	opEmptyTuple      = ')'
+	opBinFloat        = 'G'
+	opProto           = '\x80'
+	opTuple1          = '\x85'
+	opTuple2          = '\x86'
+	opTuple3          = '\x87'
+	opNewTrue         = '\x88'
+	opNewFalse        = '\x89'
+	opLong1           = '\x8a'
+	opLong4           = '\x8b'
+	opShortBinUnicode = '\x8c'
+	opBinUnicode8     = '\x8d'
+	opBinBytes8       = '\x8e'
+	opMemoize         = '\x94'
+	opFrame           = '\x95'
+	opBinBytes        = 'B'
+	opShortBinBytes   = 'C'
+)
+
+// pickleMark is the stack sentinel of the MARK opcode
+type pickleMark struct{}
+
+// pickleList is the mutable list, the memo may keep the pointer to it before items are appended
+type pickleList struct {
+	items []any
+}
+
+type unpickler struct {
+	data  []byte
+	pos   int
+	stack []any
+	memo  map[int]any
+}
+
+// unpickle decodes the carbon pickle payload, that is a list of (path, (timestamp, value)) tuples. The points which
+// don't match the format are returned as malformed descriptions.
+func unpickle(data []byte) ([]Point, []string, error) {
+	u := &unpickler{data: data, memo: make(map[int]any)}
+	v, err := u.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	var items []any
+	switch v := v.(type) {
+	case *pickleList:
+		items = v.items
+	case []any:
+		items = v
+	default:
+		return nil, nil, fmt.Errorf("%w: payload is %T, not a list", ErrPickle, v)
+	}
+	points := make([]Point, 0, len(items))
+	var malformed []string
+	for _, item := range items {
+		p, ok := picklePoint(item)
+		if !ok {
+			malformed = append(malformed, fmt.Sprint(pickleValue(item)))
+			continue
+		}
+		points = append(points, p)
+	}
+	return points, malformed, nil
+}
+
+// picklePoint converts the (path, (timestamp, value)) tuple to Point
+func picklePoint(item any) (Point, bool) {
+	t, ok := item.([]any)
+	if !ok || len(t) != 2 {
+		return Point{}, false
+	}
+	path, ok := t[0].(string)
+	if !ok || path == "" || strings.ContainsAny(path, " \n") {
+		return Point{}, false
+	}
+	datapoint, ok := t[1].([]any)
+	if !ok || len(datapoint) != 2 {
+		return Point{}, false
+	}
+	ts, ok := pickleNumber(datapoint[0])
+	if !ok || math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return Point{}, false
+	}
+	value, ok := pickleNumber(datapoint[1])
+	if !ok {
+		return Point{}, false
+	}
+	return Point{Path: path, Value: value, Timestamp: int64(ts)}, true
+}
+
+func pickleNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(v).Float64()
+		return f, true
+	case string:
+		// carbon accepts numbers as strings as well
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// pickleValueLimit is the maximal amount of values in the printable representation of a malformed item
+const pickleValueLimit = 1000
+
+// pickleValue replaces internal types for the printable representation. The list containing itself is printed as
+// '[...]' like in python, and the values after pickleValueLimit are printed as '...'.
+func pickleValue(v any) any {
+	budget := pickleValueLimit
+	return printableValue(v, make(map[*pickleList]bool), &budget)
+}
+
+func printableValue(v any, parents map[*pickleList]bool, budget *int) any {
+	if *budget <= 0 {
+		return "..."
+	}
+	*budget--
+	switch v := v.(type) {
+	case *pickleList:
+		if parents[v] {
+			return "[...]"
+		}
+		parents[v] = true
+		defer delete(parents, v)
+		return printableValue(v.items, parents, budget)
+	case []any:
+		result := make([]any, len(v))
+		for i := range v {
+			result[i] = printableValue(v[i], parents, budget)
+		}
+		return result
+	}
+	return v
+}
+
+func (u *unpickler) read(n int) ([]byte, error) {
+	if n < 0 || len(u.data)-u.pos < n {
+		return nil, fmt.Errorf("%w: unexpected end of data", ErrPickle)
+	}
+	b := u.data[u.pos : u.pos+n]
+	u.pos += n
+	return b, nil
+}
+
+func (u *unpickler) readLine() (string, error) {
+	for i := u.pos; i < len(u.data); i++ {
+		if u.data[i] == '\n' {
+			line := string(u.data[u.pos:i])
+			u.pos = i + 1
+			return line, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unexpected end of data", ErrPickle)
+}
+
+func (u *unpickler) readUint(n int) (uint64, error) {
+	b, err := u.read(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for i := n - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v, nil
+}
+
+func (u *unpickler) push(v any) {
+	u.stack = append(u.stack, v)
+}
+
+func (u *unpickler) pop() (any, error) {
+	if len(u.stack) == 0 {
+		return nil, fmt.Errorf("%w: stack underflow", ErrPickle)
+	}
+	v := u.stack[len(u.stack)-1]
+	u.stack = u.stack[:len(u.stack)-1]
+	return v, nil
+}
+
+func (u *unpickler) top() (any, error) {
+	if len(u.stack) == 0 {
+		return nil, fmt.Errorf("%w: stack underflow", ErrPickle)
+	}
+	return u.stack[len(u.stack)-1], nil
+}
+
+// popMark returns items after the last mark and removes them with the mark from the stack
+func (u *unpickler) popMark() ([]any, error) {
+	for i := len(u.stack) - 1; i >= 0; i-- {
+		if _, ok := u.stack[i].(pickleMark); ok {
+			items := append([]any(nil), u.stack[i+1:]...)
+			u.stack = u.stack[:i]
+			return items, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: mark is not found", ErrPickle)
+}
+
+func (u *unpickler) tuple(n int) error {
+	if len(u.stack) < n {
+		return fmt.Errorf("%w: stack underflow", ErrPickle)
+	}
+	t := append([]any(nil), u.stack[len(u.stack)-n:]...)
+	u.stack = u.stack[:len(u.stack)-n]
+	u.push(t)
+	return nil
+}
+
+func (u *unpickler) appendTo(items []any) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	l, ok := v.(*pickleList)
+	if !ok {
+		return fmt.Errorf("%w: append to %T", ErrPickle, v)
+	}
+	l.items = append(l.items, items...)
+	return nil
+}
+
+func (u *unpickler) get(key int) error {
+	v, ok := u.memo[key]
+	if !ok {
+		return fmt.Errorf("%w: memo %d is not found", ErrPickle, key)
+	}
+	u.push(v)
+	return nil
+}
+
+func (u *unpickler) put(key int) error {
+	v, err := u.top()
+	if err != nil {
+		return err
+	}
+	u.memo[key] = v
+	return nil
+}
+
+func (u *unpickler) pushString(n int) error {
+	b, err := u.read(n)
+	if err != nil {
+		return err
+	}
+	u.push(string(b))
+	return nil
+}
+
+// load executes opcodes until STOP and returns the top of the stack
+func (u *unpickler) load() (any, error) {
+	for {
+		b, err := u.read(1)
+		if err != nil {
+			return nil, err
+		}
+		switch op := b[0]; op {
+		case opStop:
+			return u.pop()
+		case opProto:
+			if _, err := u.read(1); err != nil {
+				return nil, err
+			}
+		case opFrame:
+			if _, err := u.read(8); err != nil {
+				return nil, err
+			}
+		case opMark:
+			u.push(pickleMark{})
+		case opPop:
+			if _, err := u.pop(); err != nil {
+				return nil, err
+			}
+		case opPopMark:
+			if _, err := u.popMark(); err != nil {
+				return nil, err
+			}
+		case opDup:
+			v, err := u.top()
+			if err != nil {
+				return nil, err
+			}
+			u.push(v)
+		case opNone:
+			u.push(nil)
+		case opNewTrue:
+			u.push(int64(1))
+		case opNewFalse:
+			u.push(int64(0))
+		case opInt:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			switch line {
+			case "00":
+				u.push(int64(0))
+			case "01":
+				u.push(int64(1))
+			default:
+				v, err := strconv.ParseInt(line, 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %w", ErrPickle, err)
+				}
+				u.push(v)
+			}
+		case opLong:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, ok := new(big.Int).SetString(strings.TrimSuffix(line, "L"), 10)
+			if !ok {
+				return nil, fmt.Errorf("%w: wrong long %q", ErrPickle, line)
+			}
+			u.push(bigValue(v))
+		case opBinInt:
+			v, err := u.readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			u.push(int64(int32(uint32(v))))
+		case opBinInt1:
+			v, err := u.readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			u.push(int64(v))
+		case opBinInt2:
+			v, err := u.readUint(2)
+			if err != nil {
+				return nil, err
+			}
+			u.push(int64(v))
+		case opLong1, opLong4:
+			size := 1
+			if op == opLong4 {
+				size = 4
+			}
+			n, err := u.readUint(size)
+			if err != nil {
+				return nil, err
+			}
+			b, err := u.read(int(n))
+			if err != nil {
+				return nil, err
+			}
+			u.push(bigValue(decodeLong(b)))
+		case opFloat:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			v, err := strconv.ParseFloat(line, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrPickle, err)
+			}
+			u.push(v)
+		case opBinFloat:
+			b, err := u.read(8)
+			if err != nil {
+				return nil, err
+			}
+			u.push(math.Float64frombits(binary.BigEndian.Uint64(b)))
+		case opString, opUnicode:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if op == opString {
+				s, err := strconv.Unquote(pythonQuoted(line))
+				if err != nil {
+					return nil, fmt.Errorf("%w: wrong string %q", ErrPickle, line)
+				}
+				line = s
+			} else {
+				line = unescapeUnicode(line)
+			}
+			u.push(line)
+		case opShortBinString, opShortBinBytes, opShortBinUnicode:
+			n, err := u.readUint(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := u.pushString(int(n)); err != nil {
+				return nil, err
+			}
+		case opBinString, opBinUnicode, opBinBytes:
+			n, err := u.readUint(4)
+			if err != nil {
+				return nil, err
+			}
+			if err := u.pushString(int(n)); err != nil {
+				return nil, err
+			}
+		case opBinUnicode8, opBinBytes8:
+			n, err := u.readUint(8)
+			if err != nil {
+				return nil, err
+			}
+			if n > uint64(len(u.data)) {
+				return nil, fmt.Errorf("%w: unexpected end of data", ErrPickle)
+			}
+			if err := u.pushString(int(n)); err != nil {
+				return nil, err
+			}
+		case opEmptyList:
+			u.push(&pickleList{})
+		case opList:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			u.push(&pickleList{items: items})
+		case opAppend:
+			v, err := u.pop()
+			if err != nil {
+				return nil, err
+			}
+			if err := u.appendTo([]any{v}); err != nil {
+				return nil, err
+			}
+		case opAppends:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			if err := u.appendTo(items); err != nil {
+				return nil, err
+			}
+		case opEmptyTuple:
+			u.push([]any{})
+		case opTuple:
+			items, err := u.popMark()
+			if err != nil {
+				return nil, err
+			}
+			u.push(items)
+		case opTuple1, opTuple2, opTuple3:
+			if err := u.tuple(int(op-opTuple1) + 1); err != nil {
+				return nil, err
+			}
+		case opGet, opPut:
+			line, err := u.readLine()
+			if err != nil {
+				return nil, err
+			}
+			key, err := strconv.Atoi(line)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrPickle, err)
+			}
+			if op == opGet {
+				err = u.get(key)
+			} else {
+				err = u.put(key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case opBinGet, opBinPut, opLongBinGet, opLongBinPut:
+			size := 1
+			if op == opLongBinGet || op == opLongBinPut {
+				size = 4
+			}
+			key, err := u.readUint(size)
+			if err != nil {
+				return nil, err
+			}
+			if op == opBinGet || op == opLongBinGet {
+				err = u.get(int(key))
+			} else {
+				err = u.put(int(key))
+			}
+			if err != nil {
+				return nil, err
+			}
+		case opMemoize:
+			if err := u.put(len(u.memo)); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported opcode 0x%02x at %d", ErrPickle, op, u.pos-1)
+		}
+	}
+}
+
+// decodeLong decodes the little-endian two's complement integer
+func decodeLong(b []byte) *big.Int {
+	v := new(big.Int)
+	if len(b) == 0 {
+		return v
+	}
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	v.SetBytes(be)
+	if b[len(b)-1]&0x80 != 0 {
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return v
+}
+
+// bigValue returns int64 for integers fitting into it
+func bigValue(v *big.Int) any {
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	return v
+}
+
+// pythonQuoted converts the python repr of the string to the go quoted string
+func pythonQuoted(s string) string {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		inner := strings.ReplaceAll(s[1:len(s)-1], `\'`, `'`)
+		return `"` + strings.ReplaceAll(inner, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+// unescapeUnicode decodes the raw-unicode-escape encoding of UNICODE opcode
+func unescapeUnicode(s string) string {
+	if !strings.Contains(s, `\u`) && !strings.Contains(s, `\U`) {
+		return s
+	}
+	if q, err := strconv.Unquote(`"` + strings.ReplaceAll(s, `"`, `\"`) + `"`); err == nil {
+		return q
+	}
+	return s
+}
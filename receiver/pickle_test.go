@@ -0,0 +1,65 @@
+package receiver
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pickled by python3 for protocols 0-5:
+// [("a.b", (1700000000, 1.5)), ("c;t=v", (1700000060.5, 2)), ("a.b", (1700000000, 10**20)), ("bad", 1)]
+var pickleFixtures = []string{
+	"286c70300a2856612e620a70310a2849313730303030303030300a46312e350a7470320a7470330a612856633b743d760a70340a2846313730303030303036302e350a49320a7470350a7470360a612867310a2849313730303030303030300a4c3130303030303030303030303030303030303030304c0a7470370a7470380a6128566261640a70390a49310a747031300a612e",
+	"5d710028285803000000612e627101284a00f15365473ff8000000000000747102747103285805000000633b743d767104284741d954fc4f2000004b02747105747106286801284a00f153654c3130303030303030303030303030303030303030304c0a74710774710828580300000062616471094b0174710a652e",
+	"80025d7100285803000000612e6271014a00f15365473ff80000000000008671028671035805000000633b743d7671044741d954fc4f2000004b0286710586710668014a00f153658a09000010632d5ec76b05867107867108580300000062616471094b0186710a652e",
+	"80035d7100285803000000612e6271014a00f15365473ff80000000000008671028671035805000000633b743d7671044741d954fc4f2000004b0286710586710668014a00f153658a09000010632d5ec76b05867107867108580300000062616471094b0186710a652e",
+	"80049554000000000000005d94288c03612e62944a00f15365473ff8000000000000869486948c05633b743d76944741d954fc4f2000004b028694869468014a00f153658a09000010632d5ec76b05869486948c03626164944b018694652e",
+	"80059554000000000000005d94288c03612e62944a00f15365473ff8000000000000869486948c05633b743d76944741d954fc4f2000004b028694869468014a00f153658a09000010632d5ec76b05869486948c03626164944b018694652e",
+}
+
+func TestUnpickle(t *testing.T) {
+	expected := []Point{
+		{Path: "a.b", Value: 1.5, Timestamp: 1700000000},
+		{Path: "c;t=v", Value: 2, Timestamp: 1700000060},
+		{Path: "a.b", Value: 1e20, Timestamp: 1700000000},
+	}
+	for protocol, fixture := range pickleFixtures {
+		data, err := hex.DecodeString(fixture)
+		require.NoError(t, err)
+		points, malformed, err := unpickle(data)
+		require.NoError(t, err, "protocol %d", protocol)
+		assert.Equal(t, expected, points, "protocol %d", protocol)
+		assert.Equal(t, []string{"[bad 1]"}, malformed, "protocol %d", protocol)
+	}
+
+	// python2 protocol 0 with str
+	points, malformed, err := unpickle([]byte("(lp0\n(S'x.y'\np1\n(I10\nF2.5\ntp2\ntp3\na."))
+	require.NoError(t, err)
+	assert.Empty(t, malformed)
+	assert.Equal(t, []Point{{Path: "x.y", Value: 2.5, Timestamp: 10}}, points)
+
+	// the list appended to itself
+	points, malformed, err = unpickle([]byte("]q\x00h\x00a."))
+	require.NoError(t, err)
+	assert.Empty(t, points)
+	assert.Equal(t, []string{"[[...]]"}, malformed)
+
+	// the list doubled 64 times is printed partially
+	data := []byte("]q\x00")
+	for i := 0; i < 64; i++ {
+		data = append(data, "(h\x00h\x00lq\x00"...)
+	}
+	points, malformed, err = unpickle(append(data, '.'))
+	require.NoError(t, err)
+	assert.Empty(t, points)
+	require.Len(t, malformed, 2)
+	assert.Less(t, len(malformed[0]), 10*pickleValueLimit)
+	assert.Contains(t, malformed[0], "...")
+
+	for _, data := range []string{"", "]", "K\x01.", "\xff", "e.", "]h\x05."} {
+		_, _, err := unpickle([]byte(data))
+		assert.ErrorIs(t, err, ErrPickle, "%q", data)
+	}
+}
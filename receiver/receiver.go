@@ -0,0 +1,410 @@
+// Package receiver provides the carbon receiver, which accepts points in plain-text and pickle formats and keeps the
+// statistic per series. It's a sink for the local verification of coal-mine and pipelines without carbon-cache.
+package receiver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrWrongAddress is returned for addresses, which can't be listened
+var ErrWrongAddress = errors.New("address should be set as 'tcp://host:port', 'udp://host:port' or 'pickle://host:port'")
+
+// maxSamples is the amount of malformed lines kept as examples
+const maxSamples = 10
+
+// maxPickleSize limits the size of the pickle payload like carbon does
+const maxPickleSize = 1 << 20
+
+// Point is the received point
+type Point struct {
+	Path      string
+	Value     float64
+	Timestamp int64
+}
+
+// Series is the statistic of received points for the metric path
+type Series struct {
+	Points     uint64 `json:"points"`
+	First      int64  `json:"first"`
+	Last       int64  `json:"last"`
+	Duplicates uint64 `json:"duplicates"`
+	OutOfOrder uint64 `json:"out_of_order"`
+}
+
+// Stats is the total statistic of the Receiver
+type Stats struct {
+	Series     int      `json:"series"`
+	Points     uint64   `json:"points"`
+	Malformed  uint64   `json:"malformed"`
+	Duplicates uint64   `json:"duplicates"`
+	OutOfOrder uint64   `json:"out_of_order"`
+	Samples    []string `json:"malformed_samples,omitempty"`
+}
+
+type series struct {
+	Series
+	values map[int64]float64
+}
+
+// Receiver counts points per series, and detects malformed lines, duplicated and out-of-order timestamps. It
+// implements io.Writer for the plain-text format, so it can be used instead of a buffer in tests.
+type Receiver struct {
+	keepPoints bool
+
+	mu        sync.Mutex
+	series    map[string]*series
+	stats     Stats
+	partial   []byte
+	listeners []io.Closer
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns the Receiver. With keepPoints all received values are kept, and Points returns them. Then duplicates
+// are detected for any previously received timestamp, otherwise only for the last one of the series.
+func New(keepPoints bool) *Receiver {
+	return &Receiver{
+		keepPoints: keepPoints,
+		series:     make(map[string]*series),
+		conns:      make(map[net.Conn]struct{}),
+	}
+}
+
+// Add accounts the point
+func (r *Receiver) Add(p Point) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(p)
+}
+
+func (r *Receiver) add(p Point) {
+	r.stats.Points++
+	s, ok := r.series[p.Path]
+	if !ok {
+		s = &series{Series: Series{First: p.Timestamp, Last: p.Timestamp}}
+		if r.keepPoints {
+			s.values = make(map[int64]float64)
+		}
+		r.series[p.Path] = s
+		r.stats.Series++
+	}
+	duplicate := s.Points != 0 && p.Timestamp == s.Last
+	if r.keepPoints {
+		_, duplicate = s.values[p.Timestamp]
+		s.values[p.Timestamp] = p.Value
+	}
+	s.Points++
+	switch {
+	case duplicate:
+		s.Duplicates++
+		r.stats.Duplicates++
+	case p.Timestamp < s.Last:
+		s.OutOfOrder++
+		r.stats.OutOfOrder++
+	}
+	s.First = min(s.First, p.Timestamp)
+	s.Last = max(s.Last, p.Timestamp)
+}
+
+func (r *Receiver) addMalformed(sample string) {
+	r.stats.Malformed++
+	if len(r.stats.Samples) < maxSamples {
+		r.stats.Samples = append(r.stats.Samples, sample)
+	}
+}
+
+// ParseLine parses the carbon plain-text line 'path value timestamp'. The timestamp may be fractional, it's truncated
+// to seconds like carbon does.
+func ParseLine(line []byte) (Point, error) {
+	fields := bytes.Fields(line)
+	if len(fields) != 3 {
+		return Point{}, fmt.Errorf("line should have 3 fields, has %d", len(fields))
+	}
+	value, err := strconv.ParseFloat(string(fields[1]), 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("wrong value: %w", err)
+	}
+	ts, err := strconv.ParseFloat(string(fields[2]), 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("wrong timestamp: %w", err)
+	}
+	if math.IsNaN(ts) || math.IsInf(ts, 0) {
+		return Point{}, fmt.Errorf("wrong timestamp: %s", fields[2])
+	}
+	return Point{Path: string(fields[0]), Value: value, Timestamp: int64(ts)}, nil
+}
+
+// addLine accounts the line, the empty lines are ignored
+func (r *Receiver) addLine(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+	p, err := ParseLine(line)
+	if err != nil {
+		r.addMalformed(string(line))
+		return
+	}
+	r.add(p)
+}
+
+// Write accounts complete plain-text lines of p. The incomplete line is kept until the next Write or Flush.
+func (r *Receiver) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data := p
+	if len(r.partial) != 0 {
+		data = append(r.partial, p...)
+		r.partial = nil
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i == -1 {
+			break
+		}
+		r.addLine(data[:i])
+		data = data[i+1:]
+	}
+	if len(data) != 0 {
+		r.partial = append([]byte(nil), data...)
+	}
+	return len(p), nil
+}
+
+// Flush accounts the incomplete line kept by Write
+func (r *Receiver) Flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.partial) != 0 {
+		r.addLine(r.partial)
+		r.partial = nil
+	}
+}
+
+// ReadPlain accounts plain-text lines from rd until EOF. The last line without the newline is accounted as well.
+func (r *Receiver) ReadPlain(rd io.Reader) error {
+	br := bufio.NewReader(rd)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			r.mu.Lock()
+			r.addLine(bytes.TrimSuffix(line, []byte{'\n'}))
+			r.mu.Unlock()
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ReadPickle accounts carbon pickle messages from rd until EOF. Each message is the 4 bytes big-endian length and the
+// pickled list of (path, (timestamp, value)) tuples. The undecodable messages are accounted as malformed.
+func (r *Receiver) ReadPickle(rd io.Reader) error {
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(rd, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxPickleSize {
+			return fmt.Errorf("%w: message size %d is more than %d", ErrPickle, size, maxPickleSize)
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(rd, payload); err != nil {
+			return err
+		}
+		points, malformed, err := unpickle(payload)
+		r.mu.Lock()
+		if err != nil {
+			r.addMalformed(err.Error())
+		}
+		for _, m := range malformed {
+			r.addMalformed(m)
+		}
+		for _, p := range points {
+			r.add(p)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// Listen starts accepting points on the address 'tcp://host:port', 'udp://host:port' or 'pickle://host:port', the
+// last one is TCP with the pickle format. It returns the listened address, e.g. for the port 0.
+func (r *Receiver) Listen(address string) (net.Addr, error) {
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s", ErrWrongAddress, address)
+	}
+	switch u.Scheme {
+	case "udp":
+		conn, err := net.ListenPacket("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		r.track(conn)
+		go r.serveUDP(conn)
+		return conn.LocalAddr(), nil
+	case "tcp", "pickle":
+		listener, err := net.Listen("tcp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		r.track(listener)
+		read := r.ReadPlain
+		if u.Scheme == "pickle" {
+			read = r.ReadPickle
+		}
+		go r.serveTCP(listener, read)
+		return listener.Addr(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrWrongAddress, address)
+}
+
+func (r *Receiver) track(c io.Closer) {
+	r.mu.Lock()
+	r.listeners = append(r.listeners, c)
+	r.wg.Add(1)
+	r.mu.Unlock()
+}
+
+func (r *Receiver) serveUDP(conn net.PacketConn) {
+	defer r.wg.Done()
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		for _, line := range bytes.Split(buf[:n], []byte{'\n'}) {
+			r.addLine(line)
+		}
+		r.mu.Unlock()
+	}
+}
+
+func (r *Receiver) serveTCP(listener net.Listener, read func(io.Reader) error) {
+	defer r.wg.Done()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		r.conns[conn] = struct{}{}
+		r.wg.Add(1)
+		r.mu.Unlock()
+		go func() {
+			defer r.wg.Done()
+			read(conn)
+			conn.Close()
+			r.mu.Lock()
+			delete(r.conns, conn)
+			r.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops listeners, closes connections and waits until they are finished
+func (r *Receiver) Close() error {
+	r.mu.Lock()
+	var errs []error
+	for _, l := range r.listeners {
+		errs = append(errs, l.Close())
+	}
+	r.listeners = nil
+	r.closed = true
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Stats returns the total statistic
+func (r *Receiver) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.stats
+	s.Samples = append([]string(nil), r.stats.Samples...)
+	return s
+}
+
+// Series returns the statistic for the path
+func (r *Receiver) Series(path string) (Series, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[path]
+	if !ok {
+		return Series{}, false
+	}
+	return s.Series, true
+}
+
+// Paths returns sorted paths of all received series
+func (r *Receiver) Paths() []string {
+	r.mu.Lock()
+	paths := make([]string, 0, len(r.series))
+	for path := range r.series {
+		paths = append(paths, path)
+	}
+	r.mu.Unlock()
+	sort.Strings(paths)
+	return paths
+}
+
+// Points returns points of the series sorted by timestamp with the last received value for each timestamp. It
+// returns nil if the Receiver doesn't keep points.
+func (r *Receiver) Points(path string) []Point {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[path]
+	if !ok || s.values == nil {
+		return nil
+	}
+	points := make([]Point, 0, len(s.values))
+	for ts, v := range s.values {
+		points = append(points, Point{Path: path, Value: v, Timestamp: ts})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+	return points
+}
+
+// Reset removes all received series and statistic
+func (r *Receiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series = make(map[string]*series)
+	r.stats = Stats{}
+	r.partial = nil
+}
+
+// String returns the point in carbon plain-text format
+func (p Point) String() string {
+	return strings.Join([]string{p.Path, strconv.FormatFloat(p.Value, 'f', -1, 64), strconv.FormatInt(p.Timestamp, 10)}, " ")
+}
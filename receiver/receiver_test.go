@@ -0,0 +1,110 @@
+package receiver
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	p, err := ParseLine([]byte("metric.name 1.5 1700000000"))
+	require.NoError(t, err)
+	assert.Equal(t, Point{Path: "metric.name", Value: 1.5, Timestamp: 1700000000}, p)
+	assert.Equal(t, "metric.name 1.5 1700000000", p.String())
+	p, err = ParseLine([]byte("metric;tag=value  -2\t1700000000.75"))
+	require.NoError(t, err)
+	assert.Equal(t, Point{Path: "metric;tag=value", Value: -2, Timestamp: 1700000000}, p)
+
+	for _, line := range []string{"metric 1", "metric 1 2 3", "metric one 1", "metric 1 now", "metric 1 NaN"} {
+		_, err := ParseLine([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestReceiverWrite(t *testing.T) {
+	r := New(false)
+	fmt.Fprint(r, "a 1 60\nb 1 60\na 2 120\na 3 1")
+	// the incomplete line is accounted on the next Write
+	assert.Equal(t, uint64(3), r.Stats().Points)
+	// without kept points only the last timestamp is checked for duplicates
+	fmt.Fprint(r, "20\n\nbroken line\na 4 60\na 5 60\r\n")
+	r.Flush()
+
+	s := r.Stats()
+	assert.Equal(t, Stats{Series: 2, Points: 6, Malformed: 1, Duplicates: 1, OutOfOrder: 2, Samples: []string{"broken line"}}, s)
+	series, ok := r.Series("a")
+	require.True(t, ok)
+	assert.Equal(t, Series{Points: 5, First: 60, Last: 120, Duplicates: 1, OutOfOrder: 2}, series)
+	_, ok = r.Series("c")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"a", "b"}, r.Paths())
+	assert.Nil(t, r.Points("a"))
+
+	r.Reset()
+	assert.Equal(t, Stats{}, r.Stats())
+	assert.Empty(t, r.Paths())
+}
+
+func TestReceiverKeepPoints(t *testing.T) {
+	r := New(true)
+	require.NoError(t, r.ReadPlain(strings.NewReader("a 1 60\na 2 120\na 3 60\na 4 180\na 5 150")))
+	series, ok := r.Series("a")
+	require.True(t, ok)
+	// any previously received timestamp is the duplicate
+	assert.Equal(t, Series{Points: 5, First: 60, Last: 180, Duplicates: 1, OutOfOrder: 1}, series)
+	assert.Equal(t, []Point{{"a", 3, 60}, {"a", 2, 120}, {"a", 5, 150}, {"a", 4, 180}}, r.Points("a"))
+}
+
+func pickleMessage(t *testing.T, fixture string) []byte {
+	data, err := hex.DecodeString(fixture)
+	require.NoError(t, err)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), data...)
+}
+
+func TestReceiverListen(t *testing.T) {
+	r := New(false)
+	defer r.Close()
+	for _, address := range []string{"", "tcp://", "http://127.0.0.1:0", "127.0.0.1:0"} {
+		_, err := r.Listen(address)
+		assert.ErrorIs(t, err, ErrWrongAddress, address)
+	}
+
+	tcp, err := r.Listen("tcp://127.0.0.1:0")
+	require.NoError(t, err)
+	udp, err := r.Listen("udp://127.0.0.1:0")
+	require.NoError(t, err)
+	pickle, err := r.Listen("pickle://127.0.0.1:0")
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", tcp.String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, "tcp.a 1 60\ntcp.a 2 120\n")
+	require.NoError(t, conn.Close())
+
+	conn, err = net.Dial("udp", udp.String())
+	require.NoError(t, err)
+	fmt.Fprint(conn, "udp.a 1 60\nudp.b 1 60\n")
+	require.NoError(t, conn.Close())
+
+	conn, err = net.Dial("tcp", pickle.String())
+	require.NoError(t, err)
+	_, err = conn.Write(pickleMessage(t, pickleFixtures[2]))
+	require.NoError(t, err)
+	_, err = conn.Write(pickleMessage(t, "80025d71002e"))
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	assert.Eventually(t, func() bool { return r.Stats().Points == 7 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, r.Close())
+	s := r.Stats()
+	assert.Equal(t, 5, s.Series)
+	assert.Equal(t, uint64(1), s.Malformed)
+	assert.Equal(t, uint64(1), s.Duplicates)
+}
@@ -0,0 +1,441 @@
+// Package whisper implements the subset of the graphite whisper format to create files with retentions, write points
+// in bulk with the propagation to rollup archives, and fetch them back.
+package whisper
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/Felixoid/coal-mine/internal/storage"
+)
+
+var (
+	// ErrRetention is returned for invalid retention definitions
+	ErrRetention = storage.ErrRetention
+	// ErrAggregation is returned for unknown aggregation methods
+	ErrAggregation = storage.ErrAggregation
+	// ErrFormat is returned for files, which aren't whisper
+	ErrFormat = errors.New("invalid whisper file")
+	// ErrRange is returned by Fetch for the empty or the future time range
+	ErrRange = errors.New("invalid time range")
+)
+
+const (
+	metadataSize    = 16
+	archiveInfoSize = 12
+	pointSize       = 12
+)
+
+// AggregationMethod is the method to aggregate points of the higher precision archive into the lower precision one
+type AggregationMethod = storage.Aggregation
+
+// Aggregation methods with the same values as in the whisper file format
+const (
+	Average = storage.Average
+	Sum     = storage.Sum
+	Last    = storage.Last
+	Max     = storage.Max
+	Min     = storage.Min
+	AvgZero = storage.AvgZero
+	AbsMax  = storage.AbsMax
+	AbsMin  = storage.AbsMin
+)
+
+// ParseAggregation returns the AggregationMethod for the name like in storage-aggregation.conf
+func ParseAggregation(name string) (AggregationMethod, error) {
+	return storage.ParseAggregation(name)
+}
+
+// Retention is the precision and the size of the archive
+type Retention = storage.Retention
+
+// ParseRetentions parses the retentions like in storage-schemas.conf, e.g. '10s:1d,1m:7d,1h:1y' or '60:1440'. The
+// retentions are validated as by whisper: the precision decreases, each precision divides the next one, and the
+// retention period increases.
+func ParseRetentions(s string) ([]Retention, error) {
+	return storage.ParseRetentions(s)
+}
+
+// ValidateRetentions checks the retentions like ParseRetentions does
+func ValidateRetentions(retentions []Retention) error {
+	return storage.ValidateRetentions(retentions)
+}
+
+type archive struct {
+	Retention
+	offset uint32
+}
+
+// Whisper is the opened whisper file
+type Whisper struct {
+	file         *os.File
+	aggregation  AggregationMethod
+	maxRetention uint32
+	xFilesFactor float32
+	archives     []archive
+}
+
+// FileSize returns the size of the whisper file with retentions, the files are created with all archives allocated
+func FileSize(retentions []Retention) int64 {
+	size := int64(metadataSize + archiveInfoSize*len(retentions))
+	for _, r := range retentions {
+		size += int64(r.Points) * pointSize
+	}
+	return size
+}
+
+// Create creates the whisper file with retentions. The file must not exist.
+func Create(path string, retentions []Retention, aggregation AggregationMethod, xFilesFactor float32) (*Whisper, error) {
+	if err := ValidateRetentions(retentions); err != nil {
+		return nil, err
+	}
+	if !aggregation.Valid() {
+		return nil, fmt.Errorf("%w: %d", ErrAggregation, aggregation)
+	}
+	if xFilesFactor < 0 || 1 < xFilesFactor {
+		return nil, fmt.Errorf("%w: xFilesFactor %g is not in [0,1]", ErrRetention, xFilesFactor)
+	}
+	w := &Whisper{aggregation: aggregation, xFilesFactor: xFilesFactor}
+	offset := uint32(metadataSize + archiveInfoSize*len(retentions))
+	for _, r := range retentions {
+		w.archives = append(w.archives, archive{Retention: r, offset: offset})
+		offset += r.Points * pointSize
+		w.maxRetention = max(w.maxRetention, r.Duration())
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	w.file = f
+	header := make([]byte, 0, metadataSize+archiveInfoSize*len(retentions))
+	header = binary.BigEndian.AppendUint32(header, uint32(aggregation))
+	header = binary.BigEndian.AppendUint32(header, w.maxRetention)
+	header = binary.BigEndian.AppendUint32(header, math.Float32bits(xFilesFactor))
+	header = binary.BigEndian.AppendUint32(header, uint32(len(retentions)))
+	for _, a := range w.archives {
+		header = binary.BigEndian.AppendUint32(header, a.offset)
+		header = binary.BigEndian.AppendUint32(header, a.SecondsPerPoint)
+		header = binary.BigEndian.AppendUint32(header, a.Points)
+	}
+	if _, err := f.WriteAt(header, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(int64(offset)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// Open opens the existing whisper file for reading and writing
+func Open(path string) (*Whisper, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	w, err := readHeader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return w, nil
+}
+
+func readHeader(f *os.File) (*Whisper, error) {
+	metadata := make([]byte, metadataSize)
+	if _, err := f.ReadAt(metadata, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+	w := &Whisper{
+		file:         f,
+		aggregation:  AggregationMethod(binary.BigEndian.Uint32(metadata)),
+		maxRetention: binary.BigEndian.Uint32(metadata[4:]),
+		xFilesFactor: math.Float32frombits(binary.BigEndian.Uint32(metadata[8:])),
+	}
+	count := binary.BigEndian.Uint32(metadata[12:])
+	if count == 0 || 1024 < count {
+		return nil, fmt.Errorf("%w: %d archives", ErrFormat, count)
+	}
+	infos := make([]byte, archiveInfoSize*count)
+	if _, err := f.ReadAt(infos, metadataSize); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFormat, err)
+	}
+	for i := uint32(0); i < count; i++ {
+		info := infos[i*archiveInfoSize:]
+		w.archives = append(w.archives, archive{
+			offset:    binary.BigEndian.Uint32(info),
+			Retention: Retention{SecondsPerPoint: binary.BigEndian.Uint32(info[4:]), Points: binary.BigEndian.Uint32(info[8:])},
+		})
+	}
+	return w, nil
+}
+
+// Close closes the file
+func (w *Whisper) Close() error {
+	return w.file.Close()
+}
+
+// Retentions returns retentions of archives
+func (w *Whisper) Retentions() []Retention {
+	result := make([]Retention, len(w.archives))
+	for i, a := range w.archives {
+		result[i] = a.Retention
+	}
+	return result
+}
+
+// Aggregation returns the aggregation method
+func (w *Whisper) Aggregation() AggregationMethod {
+	return w.aggregation
+}
+
+// XFilesFactor returns the ratio of known points required to propagate the value to the lower precision archive
+func (w *Whisper) XFilesFactor() float32 {
+	return w.xFilesFactor
+}
+
+// Point is the point of the whisper file
+type Point struct {
+	Timestamp uint32
+	Value     float64
+}
+
+// baseTimestamp returns the timestamp of the first slot of the archive, zero means the archive is empty
+func (w *Whisper) baseTimestamp(a *archive) (uint32, error) {
+	b := make([]byte, 4)
+	if _, err := w.file.ReadAt(b, int64(a.offset)); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+// slotOffset returns the file offset of the interval in the archive
+func (a *archive) slotOffset(base, interval uint32) int64 {
+	if base == 0 {
+		return int64(a.offset)
+	}
+	distance := (int64(interval) - int64(base)) / int64(a.SecondsPerPoint)
+	slot := distance % int64(a.Points)
+	if slot < 0 {
+		slot += int64(a.Points)
+	}
+	return int64(a.offset) + slot*pointSize
+}
+
+// readRange reads count slots starting from the interval, the slots with other timestamps are returned as NaN
+func (w *Whisper) readRange(a *archive, base, interval uint32, count int) ([]float64, error) {
+	values := make([]float64, count)
+	if base == 0 {
+		for i := range values {
+			values[i] = math.NaN()
+		}
+		return values, nil
+	}
+	b := make([]byte, pointSize)
+	for i := range values {
+		ts := interval + uint32(i)*a.SecondsPerPoint
+		if _, err := w.file.ReadAt(b, a.slotOffset(base, ts)); err != nil {
+			return nil, err
+		}
+		values[i] = math.NaN()
+		if binary.BigEndian.Uint32(b) == ts {
+			values[i] = math.Float64frombits(binary.BigEndian.Uint64(b[4:]))
+		}
+	}
+	return values, nil
+}
+
+// writePoints writes aligned points into the archive, the first written point defines the base of the empty archive
+func (w *Whisper) writePoints(a *archive, points []Point) error {
+	if len(points) == 0 {
+		return nil
+	}
+	base, err := w.baseTimestamp(a)
+	if err != nil {
+		return err
+	}
+	if base == 0 {
+		base = points[0].Timestamp
+	}
+	b := make([]byte, pointSize)
+	for _, p := range points {
+		binary.BigEndian.PutUint32(b, p.Timestamp)
+		binary.BigEndian.PutUint64(b[4:], math.Float64bits(p.Value))
+		if _, err := w.file.WriteAt(b, a.slotOffset(base, p.Timestamp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alignPoints aligns points to the archive precision. The points of the same interval are aggregated by the method,
+// or the last one is kept for the nil method like carbon does. The total is the amount of the higher precision points
+// in the interval, it's used by avg_zero the same way as by propagate.
+func alignPoints(points []Point, step uint32, method *AggregationMethod, total int) []Point {
+	var result []Point
+	var values []float64
+	flush := func() {
+		if len(values) == 0 {
+			return
+		}
+		v := values[len(values)-1]
+		if method != nil {
+			v = method.Aggregate(values, total)
+		}
+		result[len(result)-1].Value = v
+		values = values[:0]
+	}
+	for _, p := range points {
+		interval := p.Timestamp - p.Timestamp%step
+		if len(result) == 0 || result[len(result)-1].Timestamp != interval {
+			flush()
+			result = append(result, Point{Timestamp: interval})
+		}
+		values = append(values, p.Value)
+	}
+	flush()
+	return result
+}
+
+// propagate aggregates the intervals of the higher archive into the lower one, if the ratio of known points is not
+// less than xFilesFactor. It returns written points of the lower archive.
+func (w *Whisper) propagate(higher, lower *archive, intervals []uint32) ([]Point, error) {
+	base, err := w.baseTimestamp(higher)
+	if err != nil {
+		return nil, err
+	}
+	count := int(lower.SecondsPerPoint / higher.SecondsPerPoint)
+	var points []Point
+	for _, interval := range intervals {
+		values, err := w.readRange(higher, base, interval, count)
+		if err != nil {
+			return nil, err
+		}
+		known := values[:0]
+		for _, v := range values {
+			if !math.IsNaN(v) {
+				known = append(known, v)
+			}
+		}
+		if len(known) == 0 || float32(len(known))/float32(count) < w.xFilesFactor {
+			continue
+		}
+		points = append(points, Point{Timestamp: interval, Value: w.aggregation.Aggregate(known, count)})
+	}
+	return points, w.writePoints(lower, points)
+}
+
+// UpdateMany writes points relative to now. Each point is written to the highest precision archive, which retention
+// covers it, the points of the same interval are kept like carbon does: the last one for the first archive, and
+// aggregated for lower ones. Then the written intervals are propagated to the lower precision archives. The points
+// older than the maximum retention are skipped.
+func (w *Whisper) UpdateMany(points []Point, now uint32) error {
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	var propagated []Point
+	for i := range w.archives {
+		a := &w.archives[i]
+		var direct []Point
+		rest := sorted[:0]
+		for _, p := range sorted {
+			if int64(now)-int64(p.Timestamp) < int64(a.Duration()) {
+				direct = append(direct, p)
+				continue
+			}
+			rest = append(rest, p)
+		}
+		sorted = rest
+		var method *AggregationMethod
+		total := 1
+		if i != 0 {
+			method = &w.aggregation
+			total = int(a.SecondsPerPoint / w.archives[i-1].SecondsPerPoint)
+		}
+		direct = alignPoints(direct, a.SecondsPerPoint, method, total)
+		if err := w.writePoints(a, direct); err != nil {
+			return err
+		}
+		written := append(propagated, direct...)
+		if i+1 == len(w.archives) || len(written) == 0 {
+			propagated = nil
+			continue
+		}
+		lower := &w.archives[i+1]
+		var intervals []uint32
+		seen := make(map[uint32]bool)
+		for _, p := range written {
+			interval := p.Timestamp - p.Timestamp%lower.SecondsPerPoint
+			if !seen[interval] {
+				seen[interval] = true
+				intervals = append(intervals, interval)
+			}
+		}
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+		var err error
+		if propagated, err = w.propagate(a, lower, intervals); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Series is the result of Fetch, the unknown values are NaN
+type Series struct {
+	From   uint32
+	Until  uint32
+	Step   uint32
+	Values []float64
+}
+
+// Points returns known points of the series
+func (s *Series) Points() []Point {
+	var points []Point
+	for i, v := range s.Values {
+		if !math.IsNaN(v) {
+			points = append(points, Point{Timestamp: s.From + uint32(i)*s.Step, Value: v})
+		}
+	}
+	return points
+}
+
+// Fetch returns points from the highest precision archive covering the time range relative to now, like whisper.py
+// does: intervals are (from, until], and the range is limited by now and the maximum retention.
+func (w *Whisper) Fetch(from, until, now uint32) (*Series, error) {
+	until = min(until, now)
+	if now > w.maxRetention {
+		from = max(from, now-w.maxRetention)
+	}
+	if from >= until {
+		return nil, fmt.Errorf("%w: from %d is not less than until %d", ErrRange, from, until)
+	}
+	a := &w.archives[len(w.archives)-1]
+	for i := range w.archives {
+		if now-from <= w.archives[i].Duration() {
+			a = &w.archives[i]
+			break
+		}
+	}
+	step := a.SecondsPerPoint
+	fromInterval := from - from%step + step
+	untilInterval := until - until%step + step
+	if fromInterval == untilInterval {
+		untilInterval += step
+	}
+	base, err := w.baseTimestamp(a)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	values, err := w.readRange(a, base, fromInterval, int((untilInterval-fromInterval)/step))
+	if err != nil {
+		return nil, err
+	}
+	return &Series{From: fromInterval, Until: untilInterval, Step: step, Values: values}, nil
+}
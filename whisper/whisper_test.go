@@ -0,0 +1,142 @@
+package whisper
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func create(t *testing.T, retentions string, aggregation AggregationMethod, xff float32) (*Whisper, string) {
+	t.Helper()
+	rr, err := ParseRetentions(retentions)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "metric.wsp")
+	w, err := Create(path, rr, aggregation, xff)
+	require.NoError(t, err)
+	return w, path
+}
+
+func TestCreateOpen(t *testing.T) {
+	w, path := create(t, "1m:1h,5m:1d", Sum, 0.25)
+	require.NoError(t, w.Close())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(16+2*12+(60+288)*12), info.Size())
+	assert.Equal(t, info.Size(), FileSize(w.Retentions()))
+
+	_, err = Create(path, w.Retentions(), Sum, 0.25)
+	assert.ErrorIs(t, err, os.ErrExist)
+
+	w, err = Open(path)
+	require.NoError(t, err)
+	defer w.Close()
+	assert.Equal(t, []Retention{{SecondsPerPoint: 60, Points: 60}, {SecondsPerPoint: 300, Points: 288}}, w.Retentions())
+	assert.Equal(t, Sum, w.Aggregation())
+	assert.Equal(t, float32(0.25), w.XFilesFactor())
+
+	empty := filepath.Join(t.TempDir(), "empty.wsp")
+	require.NoError(t, os.WriteFile(empty, nil, 0o644))
+	_, err = Open(empty)
+	assert.ErrorIs(t, err, ErrFormat)
+}
+
+func TestUpdateMany(t *testing.T) {
+	w, _ := create(t, "1m:1h,5m:1d", Sum, 0.5)
+	defer w.Close()
+	now := uint32(1_000_000_200)
+	var points []Point
+	// 10 minutes of points with a step of 30s, the last one of each minute is kept in the first archive
+	for ts := now - 600; ts < now; ts += 30 {
+		points = append(points, Point{Timestamp: ts, Value: float64(ts%600) / 30})
+	}
+	require.NoError(t, w.UpdateMany(points, now))
+
+	s, err := w.Fetch(now-600, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(60), s.Step)
+	assert.Equal(t, now-600+60, s.From)
+	require.Len(t, s.Values, 10)
+	assert.True(t, math.IsNaN(s.Values[9]), "the interval of now is empty")
+	for i, v := range s.Values[:9] {
+		assert.Equal(t, float64(2*i+3), v, i)
+	}
+
+	// the rollup is the sum of minutes, the intervals are [999999600, 999999900, 1000000200)
+	s, err = w.Fetch(now-7200, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(300), s.Step)
+	assert.Equal(t, []Point{
+		{Timestamp: 999_999_600, Value: 1 + 3 + 5 + 7 + 9},
+		{Timestamp: 999_999_900, Value: 11 + 13 + 15 + 17 + 19},
+	}, s.Points())
+}
+
+func TestUpdateManyXFilesFactor(t *testing.T) {
+	w, _ := create(t, "1m:1h,5m:1d", Average, 0.5)
+	defer w.Close()
+	now := uint32(1_000_000_200)
+	// two minutes of five aren't enough to propagate
+	require.NoError(t, w.UpdateMany([]Point{{999_999_600, 1}, {999_999_660, 3}}, now))
+	s, err := w.Fetch(now-7200, now, now)
+	require.NoError(t, err)
+	assert.Empty(t, s.Points())
+
+	// the next update propagates the whole interval
+	require.NoError(t, w.UpdateMany([]Point{{999_999_720, 5}}, now))
+	s, err = w.Fetch(now-7200, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{999_999_600, 3}}, s.Points())
+}
+
+func TestUpdateManyRetentions(t *testing.T) {
+	w, _ := create(t, "1m:10m,5m:1h", Max, 0)
+	defer w.Close()
+	now := uint32(1_000_000_200)
+	points := []Point{
+		// too old
+		{now - 3600, 100},
+		// directly into the second archive, aggregated by max
+		{999_997_200, 7}, {999_997_260, 9}, {999_997_320, 8},
+		// the first archive, propagated
+		{now - 120, 1}, {now - 60, 2},
+	}
+	require.NoError(t, w.UpdateMany(points, now))
+	s, err := w.Fetch(now-3600, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{999_997_200, 9}, {999_999_900, 2}}, s.Points())
+
+	s, err = w.Fetch(now-300, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{now - 120, 1}, {now - 60, 2}}, s.Points())
+
+	_, err = w.Fetch(now, now+60, now)
+	assert.ErrorIs(t, err, ErrRange)
+}
+
+func TestUpdateManyAvgZero(t *testing.T) {
+	w, _ := create(t, "1m:10m,5m:1h", AvgZero, 0)
+	defer w.Close()
+	now := uint32(1_000_000_200)
+	// two minutes of five directly into the second archive, the missing minutes are zeros
+	require.NoError(t, w.UpdateMany([]Point{{999_997_200, 4}, {999_997_260, 6}}, now))
+	s, err := w.Fetch(now-3600, now, now)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{999_997_200, 2}}, s.Points())
+}
+
+func TestUpdateManyWrap(t *testing.T) {
+	w, _ := create(t, "1m:5m", Average, 0)
+	defer w.Close()
+	var ts uint32 = 999_999_960
+	for i := range 12 {
+		ts += 60
+		require.NoError(t, w.UpdateMany([]Point{{ts, float64(i)}}, ts))
+	}
+	s, err := w.Fetch(ts-300, ts, ts)
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{ts - 240, 7}, {ts - 180, 8}, {ts - 120, 9}, {ts - 60, 10}, {ts, 11}}, s.Points())
+}